@@ -0,0 +1,45 @@
+package dataflow
+
+import (
+	"context"
+	"slices"
+)
+
+// Scopes of the operations on products. Credentials are granted a set of scopes.
+const (
+	ScopeRead  = "products:read"
+	ScopeWrite = "products:write"
+)
+
+// Principal represents an authenticated client.
+type Principal struct {
+	// Name of the client, like the name of an API key or the subject of a token.
+	Subject string
+
+	// Scheme of the credential, that authenticated the client, like "ApiKey".
+	// It is set by the HTTP server.
+	Scheme string
+
+	// Scopes granted to the client.
+	Scopes []string
+}
+
+// HasScope returns true if the principal is granted scope.
+func (p *Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+// principalKey is the context key of the principal.
+type principalKey struct{}
+
+// NewContextWithPrincipal returns a new context with the given principal.
+func NewContextWithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the principal of the request.
+// Returns nil if the request is not authenticated.
+func PrincipalFromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
@@ -5,15 +5,34 @@ import "context"
 // A cache is used as an optimization tool. It is used for easier data access.
 // If the cache has a value that we are looking up,
 // we don't need ask other services to give that.
-// We save IDs of the Products in a cache, while storing the Products in a database.
+// We save fingerprints of the Products in a cache, while storing the Products in a database.
 // When we want to update the database at another time,
-// we ask the cache first about which IDs it has. The Products of IDs in the cache
-// will not be updated. Otherwise we go and update the Product and cache with fresh data.
+// we ask the cache first about the fingerprints of the IDs. Products with the same
+// fingerprint are unchanged and will not be written. Otherwise we go and update
+// the Product and cache with fresh data.
 
-// Cache represents the cache methods for ProductIDs.
+// Cache represents the cache methods for Product fingerprints.
 // A Cache interface might be implemented concretely using Redis, memcached or in-memory.
 
 type Cache interface {
-	Set(ctx context.Context, id uint32) error
+	// Stores the fingerprint of a product id. The pipeline stores the CacheEntry of a product,
+	// which holds its fingerprint.
+	Set(ctx context.Context, id uint32, fingerprint string) error
+
+	// Reports whether a product id is in the cache.
 	Exists(ctx context.Context, id uint32) (bool, error)
+
+	// Retrieves the fingerprint of a product id.
+	// Returns an empty string if the id is not in the cache.
+	Get(ctx context.Context, id uint32) (string, error)
+
+	// Stores a number of fingerprints, keyed by product id, at once.
+	SetMany(ctx context.Context, fingerprints map[uint32]string) error
+
+	// Retrieves the fingerprints of a number of product ids at once.
+	// The result has the same order as ids, with an empty string for each missing id.
+	GetMany(ctx context.Context, ids []uint32) ([]string, error)
+
+	// Removes a number of product ids at once. Missing ids are ignored.
+	DeleteMany(ctx context.Context, ids []uint32) error
 }
@@ -1,18 +1,38 @@
 package cassandra
 
 import (
+	"cmp"
+	"fmt"
+	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/gocql/gocql"
 )
 
+// DefaultWriteConcurrency is the number of concurrent writes of a batch.
+const DefaultWriteConcurrency = 32
+
+// DefaultReadConcurrency is the number of concurrent reads of a batch lookup.
+const DefaultReadConcurrency = 32
+
 // DB represents the database connection.
 type DB struct {
 	session *gocql.Session
+
+	// Number of concurrent writes used by ProductService.CreateProducts.
+	WriteConcurrency int
+
+	// Number of concurrent reads used by ProductService.FindProductsByIDs.
+	ReadConcurrency int
+
+	// Logger of failed queries and of the driver. Defaults to slog.Default().
+	Logger *slog.Logger
 }
 
 // NewDB returns a new instance of DB associated with the given connection parameters.
 func NewDB(host, keyspace, user, pass string) (*DB, error) {
+	db := &DB{WriteConcurrency: DefaultWriteConcurrency, ReadConcurrency: DefaultReadConcurrency, Logger: slog.Default()}
 
 	// Instantiate a cluster object.
 	cluster := gocql.NewCluster(host)
@@ -28,14 +48,49 @@ func NewDB(host, keyspace, user, pass string) (*DB, error) {
 	cluster.ProtoVersion = 4
 	cluster.Timeout = 2 * time.Second
 	cluster.ConnectTimeout = 5 * time.Second
+
+	// Route each query to a replica, that owns its partition.
+	cluster.PoolConfig.HostSelectionPolicy = gocql.TokenAwareHostPolicy(gocql.RoundRobinHostPolicy())
+
+	// Record the latency of queries and batches.
+	cluster.QueryObserver = observer{db: db}
+	cluster.BatchObserver = observer{db: db}
+
+	// Send the messages of the driver to the logger of the DB.
+	cluster.Logger = driverLogger{db: db}
+
 	session, err := cluster.CreateSession()
 	if err != nil {
 		return nil, err
 	}
+	db.session = session
 
-	return &DB{session: session}, nil
+	return db, nil
 }
 
 func (db *DB) Close() {
 	db.session.Close()
 }
+
+// logger returns the logger of the DB, or the default logger if it is not set.
+func (db *DB) logger() *slog.Logger {
+	return cmp.Or(db.Logger, slog.Default())
+}
+
+// driverLogger adapts the logger of a DB to the logger interface of the driver.
+type driverLogger struct {
+	db *DB
+}
+
+// Print implements gocql.StdLogger.
+func (l driverLogger) Print(v ...any) { l.log(fmt.Sprint(v...)) }
+
+// Printf implements gocql.StdLogger.
+func (l driverLogger) Printf(format string, v ...any) { l.log(fmt.Sprintf(format, v...)) }
+
+// Println implements gocql.StdLogger.
+func (l driverLogger) Println(v ...any) { l.log(fmt.Sprintln(v...)) }
+
+func (l driverLogger) log(msg string) {
+	l.db.logger().Info(strings.TrimSpace(msg), "component", "gocql")
+}
@@ -19,6 +19,25 @@ func TestDB(t *testing.T) {
 	defer MustCloseDB(t, db)
 }
 
+// Ensure a failed query is logged to the default logger, if the DB has no logger.
+func TestDB_NilLogger(t *testing.T) {
+	// Start containers for test.
+	ctx := context.Background()
+	cdbc, cassandraConnectionHost := container.MustDeployCassandra(ctx)
+	defer container.MustCleanCassandraContainer(ctx, cdbc)
+
+	db := MustOpenDB(t, cassandraConnectionHost)
+	defer MustCloseDB(t, db)
+	db.Logger = nil
+
+	// A canceled query fails, which is logged by the DB.
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := cassandra.NewProductService(db).FindProductByID(canceled, 1); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
 // MustOpenDB returns a new DB. Fatal on error.
 func MustOpenDB(tb testing.TB, connectionHost string) *cassandra.DB {
 	tb.Helper()
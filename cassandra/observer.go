@@ -0,0 +1,103 @@
+package cassandra
+
+import (
+	"cmp"
+	"context"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/narslan/pipeline"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer records the spans of queries.
+var tracer = otel.Tracer("github.com/narslan/pipeline/cassandra")
+
+// queryDuration is the latency of queries and batches, by operation and table.
+var queryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "dataflow_cassandra_query_duration_seconds",
+	Help:    "Latency of Cassandra queries by operation and table.",
+	Buckets: prometheus.DefBuckets,
+}, []string{"operation", "table"})
+
+// tableRe matches the table of a CQL statement.
+var tableRe = regexp.MustCompile(`(?i)\b(?:FROM|INTO|UPDATE)\s+([\w.]+)`)
+
+// observer records the latency of each query attempt and batch of a session.
+// Each of them is traced as a child span of the span in the context of the query.
+// Failed attempts are logged.
+type observer struct {
+	db *DB
+}
+
+// ObserveQuery implements gocql.QueryObserver.
+func (o observer) ObserveQuery(ctx context.Context, q gocql.ObservedQuery) {
+	op, table := statementLabels(q.Statement)
+	queryDuration.WithLabelValues(op, table).Observe(q.End.Sub(q.Start).Seconds())
+	observeSpan(ctx, op, table, q.Start, q.End, q.Err,
+		semconv.DBQueryText(q.Statement), attribute.Int("db.cassandra.attempt", q.Attempt))
+	if q.Err != nil {
+		o.logger(ctx).WarnContext(ctx, "query failed",
+			"operation", op, "table", table, "attempt", q.Attempt, "error", q.Err)
+	}
+}
+
+// ObserveBatch implements gocql.BatchObserver. A batch is labeled by the table of its first statement.
+func (o observer) ObserveBatch(ctx context.Context, b gocql.ObservedBatch) {
+	var table string
+	if len(b.Statements) > 0 {
+		_, table = statementLabels(b.Statements[0])
+	}
+	queryDuration.WithLabelValues("batch", table).Observe(b.End.Sub(b.Start).Seconds())
+	observeSpan(ctx, "batch", table, b.Start, b.End, b.Err, attribute.Int("db.operation.batch.size", len(b.Statements)))
+	if b.Err != nil {
+		o.logger(ctx).WarnContext(ctx, "batch failed",
+			"table", table, "statements", len(b.Statements), "error", b.Err)
+	}
+}
+
+// logger returns the logger in the context of a query, like the one of an HTTP request,
+// or the logger of the DB.
+func (o observer) logger(ctx context.Context) *slog.Logger {
+	return cmp.Or(dataflow.LoggerFromContext(ctx), o.db.logger())
+}
+
+// observeSpan records a span of a query, that ran from start to end.
+func observeSpan(ctx context.Context, op, table string, start, end time.Time, err error, attrs ...attribute.KeyValue) {
+	if !trace.SpanFromContext(ctx).SpanContext().IsValid() {
+		return
+	}
+
+	_, span := tracer.Start(ctx, strings.ToUpper(op)+" "+table,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithTimestamp(start),
+		trace.WithAttributes(semconv.DBSystemCassandra, semconv.DBOperationName(op), semconv.DBCollectionName(table)),
+		trace.WithAttributes(attrs...),
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End(trace.WithTimestamp(end))
+}
+
+// statementLabels returns the operation and table of a CQL statement, like "select" and "products".
+// Statements are not used as labels, since projections and IN lists vary them.
+func statementLabels(stmt string) (op, table string) {
+	if f := strings.Fields(stmt); len(f) > 0 {
+		op = strings.ToLower(f[0])
+	}
+	if m := tableRe.FindStringSubmatch(stmt); m != nil {
+		table = m[1]
+	}
+	return op, table
+}
@@ -2,10 +2,20 @@ package cassandra
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
+	"strings"
+	"time"
 
 	"github.com/narslan/pipeline"
 	"github.com/gocql/gocql"
+	"golang.org/x/sync/errgroup"
+)
+
+// Limits of the page size of ListProducts.
+const (
+	DefaultListLimit = 100
+	MaxListLimit     = 1000
 )
 
 // Ensure service implements interface.
@@ -21,25 +31,22 @@ func NewProductService(db *DB) *ProductService {
 	return &ProductService{db: db}
 }
 
-// FindProductByID retrieves a product by ID.
-// Returns ENOTFOUND if product does not exist.
-func (s *ProductService) FindProductByID(ctx context.Context, id uint32) (*dataflow.Product, error) {
+// FindProductByID retrieves a product by ID. If fields are given, only their columns are read.
+// Returns ENOTFOUND if product does not exist, or EINVALID if a field is unknown.
+func (s *ProductService) FindProductByID(ctx context.Context, id uint32, fields ...string) (*dataflow.Product, error) {
 
-	// Prepare query string.
-	qryStmt := "SELECT id, title, price, category, brand, url, description  FROM products WHERE id = ?"
+	// Pick the columns of the projection.
+	fields, err := dataflow.NormalizeProductFields(fields)
+	if err != nil {
+		return nil, err
+	}
 
-	var (
-		pid         uint32
-		title       string
-		price       float32
-		category    string
-		brand       string
-		url         string
-		description string
-	)
+	// Prepare query string.
+	qryStmt := "SELECT " + strings.Join(fields, ", ") + " FROM products WHERE id = ?"
 
 	// Execute query to fetch user rows.
-	err := s.db.session.Query(qryStmt, id).WithContext(ctx).Scan(&pid, &title, &price, &category, &brand, &url, &description)
+	var p dataflow.Product
+	err = s.db.session.Query(qryStmt, id).WithContext(ctx).Scan(columns(&p, fields)...)
 
 	if err != nil {
 
@@ -51,19 +58,58 @@ func (s *ProductService) FindProductByID(ctx context.Context, id uint32) (*dataf
 
 	}
 
-	return &dataflow.Product{
-		ID:          pid,
-		Title:       title,
-		Price:       price,
-		Category:    category,
-		Brand:       brand,
-		URL:         url,
-		Description: description,
-	}, nil
+	return &p, nil
 
 }
 
+// FindProductsByIDs retrieves a number of products by ID.
+// Each product is a partition of its own. Instead of an IN query, that makes a single
+// coordinator fetch all partitions, the products are read concurrently.
+// If fields are given, only their columns are read.
+// Found products are returned in the order of ids. Missing products are left out.
+func (s *ProductService) FindProductsByIDs(ctx context.Context, ids []uint32, fields ...string) ([]*dataflow.Product, error) {
+
+	// Validate the projection once, rather than for each lookup.
+	if _, err := dataflow.NormalizeProductFields(fields); err != nil {
+		return nil, err
+	}
+
+	// Execute lookups with bounded concurrency.
+	limit := s.db.ReadConcurrency
+	if limit <= 0 {
+		limit = DefaultReadConcurrency
+	}
+	found := make([]*dataflow.Product, len(ids))
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(limit)
+	for i, id := range ids {
+		g.Go(func() error {
+			p, err := s.FindProductByID(ctx, id, fields...)
+			if dataflow.ErrorCode(err) == dataflow.ENOTFOUND {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			found[i] = p
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	// Leave out missing products.
+	ps := make([]*dataflow.Product, 0, len(ids))
+	for _, p := range found {
+		if p != nil {
+			ps = append(ps, p)
+		}
+	}
+	return ps, nil
+}
+
 // CreateProduct creates a new product.
+// Returns ECONFLICT if a product with the same ID exists.
 func (s *ProductService) CreateProduct(ctx context.Context, p *dataflow.Product) error {
 
 	//Validate input
@@ -72,9 +118,299 @@ func (s *ProductService) CreateProduct(ctx context.Context, p *dataflow.Product)
 		return err
 	}
 
-	// Prepare insert statement.
-	insSt := `INSERT INTO products(id, title, price, category, brand, url, description) VALUES(?,?,?,?,?,?,?)`
+	return s.create(ctx, p)
+}
+
+// CreateProducts creates a number of products. Existing products are replaced, without
+// reading them, so their lookup rows of a previous category or brand are left to UnlistProducts.
+// Each product is a partition of its own, so the products are not grouped into
+// a multi-partition batch. They are written concurrently instead, and the token-aware
+// host policy sends each write straight to a replica of its partition.
+func (s *ProductService) CreateProducts(ctx context.Context, ps []*dataflow.Product) error {
+
+	//Validate input before writing anything.
+	for _, p := range ps {
+		if err := p.Validate(); err != nil {
+			return err
+		}
+	}
+
+	// Execute inserts with bounded concurrency.
+	limit := s.db.WriteConcurrency
+	if limit <= 0 {
+		limit = DefaultWriteConcurrency
+	}
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(limit)
+	for _, p := range ps {
+		g.Go(func() error {
+			return s.replace(ctx, p, dataflow.ProductListing{})
+		})
+	}
+	return g.Wait()
+}
+
+// UpdateProduct updates a product by ID. Returns the new product state, even if there was an error.
+// Returns ENOTFOUND if product does not exist.
+func (s *ProductService) UpdateProduct(ctx context.Context, id uint32, upd dataflow.ProductUpdate) (*dataflow.Product, error) {
+
+	// Fetch the current product state.
+	p, err := s.FindProductByID(ctx, id)
+	if err != nil {
+		return p, err
+	}
+
+	// Update fields and validate the new state.
+	prev := dataflow.ProductListing{Category: p.Category, Brand: p.Brand}
+	upd.Apply(p)
+	if err := p.Validate(); err != nil {
+		return p, err
+	}
+
+	return p, s.replace(ctx, p, prev)
+}
+
+// UnlistProducts deletes the lookup rows of products under a previous category or brand.
+// Like CreateProducts, it writes the products concurrently.
+func (s *ProductService) UnlistProducts(ctx context.Context, prev map[uint32]dataflow.ProductListing) error {
+
+	// Execute deletes with bounded concurrency.
+	limit := s.db.WriteConcurrency
+	if limit <= 0 {
+		limit = DefaultWriteConcurrency
+	}
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(limit)
+	for id, l := range prev {
+		g.Go(func() error {
+			b := s.db.session.NewBatch(gocql.UnloggedBatch).WithContext(ctx)
+			unlist(b, id, l)
+			if b.Size() == 0 {
+				return nil
+			} else if err := s.db.session.ExecuteBatch(b); err != nil {
+				return dataflow.Errorf(dataflow.EINTERNAL, "unlisting of %d failed with err: %v", id, err)
+			}
+			return nil
+		})
+	}
+	return g.Wait()
+}
+
+// DeleteProduct permanently deletes a product by ID.
+// Returns ENOTFOUND if product does not exist.
+func (s *ProductService) DeleteProduct(ctx context.Context, id uint32) error {
+
+	// A delete of a missing row succeeds in Cassandra, so look up the product first.
+	// Its category and brand are needed to delete the lookup rows.
+	p, err := s.FindProductByID(ctx, id, "category", "brand")
+	if err != nil {
+		return err
+	}
+
+	// Delete the product row and its lookup rows together.
+	b := s.db.session.NewBatch(gocql.LoggedBatch).WithContext(ctx)
+	b.Query(`DELETE FROM products WHERE id = ?`, id)
+	b.Query(`DELETE FROM products_by_category WHERE category = ? AND id = ?`, p.Category, id)
+	b.Query(`DELETE FROM products_by_brand WHERE brand = ? AND id = ?`, p.Brand, id)
+	if err := s.db.session.ExecuteBatch(b); err != nil {
+		return dataflow.Errorf(dataflow.EINTERNAL, "delete of %d failed with err: %v", id, err)
+	}
+	return nil
+}
+
+// FindProductIDs retrieves the IDs of all products.
+// The rows are fetched page by page.
+func (s *ProductService) FindProductIDs(ctx context.Context) ([]uint32, error) {
+	iter := s.db.session.Query(`SELECT id FROM products`).WithContext(ctx).Iter()
 
-	// Execute query to insert product values.
-	return s.db.session.Query(insSt, p.ID, p.Title, p.Price, p.Category, p.Brand, p.URL, p.Description).WithContext(ctx).Exec()
+	var (
+		ids []uint32
+		id  uint32
+	)
+	for iter.Scan(&id) {
+		ids = append(ids, id)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, dataflow.Errorf(dataflow.EINTERNAL, "query of product ids failed with err: %v", err)
+	}
+	return ids, nil
+}
+
+// ListProducts retrieves a page of products. Products of a category or brand are read
+// from the lookup tables in order of their IDs, other products in token order of their IDs.
+// The cursor is the encoded paging state of Cassandra. If fields are given, only their columns are read.
+// Returns EINVALID if the cursor is malformed or a field is unknown.
+func (s *ProductService) ListProducts(ctx context.Context, filter dataflow.ProductFilter) ([]*dataflow.Product, string, error) {
+
+	// Pick the columns of the projection.
+	fields, err := dataflow.NormalizeProductFields(filter.Fields)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Decode the paging state of the previous page.
+	state, err := base64.RawURLEncoding.DecodeString(filter.Cursor)
+	if err != nil {
+		return nil, "", dataflow.Errorf(dataflow.EINVALID, "Invalid cursor.")
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultListLimit
+	} else if limit > MaxListLimit {
+		limit = MaxListLimit
+	}
+
+	// Pick the table, whose partitions match the filter.
+	qryStmt := "SELECT " + strings.Join(fields, ", ") + " FROM "
+	var args []any
+	switch {
+	case filter.Category != "" && filter.Brand != "":
+		// Filtering is limited to a single category partition.
+		qryStmt += "products_by_category WHERE category = ? AND brand = ? ALLOW FILTERING"
+		args = append(args, filter.Category, filter.Brand)
+	case filter.Category != "":
+		qryStmt += "products_by_category WHERE category = ?"
+		args = append(args, filter.Category)
+	case filter.Brand != "":
+		qryStmt += "products_by_brand WHERE brand = ?"
+		args = append(args, filter.Brand)
+	default:
+		qryStmt += "products"
+	}
+
+	// Setting a paging state disables automatic paging, so the iterator returns a single page.
+	iter := s.db.session.Query(qryStmt, args...).WithContext(ctx).PageSize(limit).PageState(state).Iter()
+	next := iter.PageState()
+
+	ps := make([]*dataflow.Product, 0, limit)
+	scanner := iter.Scanner()
+	for scanner.Next() {
+		var p dataflow.Product
+		if err := scanner.Scan(columns(&p, fields)...); err != nil {
+			return nil, "", dataflow.Errorf(dataflow.EINTERNAL, "scan of products failed with err: %v", err)
+		}
+		ps = append(ps, &p)
+	}
+	if err := scanner.Err(); err != nil {
+		var reqErr gocql.RequestError
+		if len(state) > 0 && errors.As(err, &reqErr) && (reqErr.Code() == gocql.ErrCodeInvalid || reqErr.Code() == gocql.ErrCodeProtocol) {
+			return nil, "", dataflow.Errorf(dataflow.EINVALID, "Invalid cursor.")
+		}
+		return nil, "", dataflow.Errorf(dataflow.EINTERNAL, "query of products failed with err: %v", err)
+	}
+
+	return ps, base64.RawURLEncoding.EncodeToString(next), nil
+}
+
+// columns returns the scan destinations in p of the columns of fields.
+// The columns of the product tables are named like the fields.
+func columns(p *dataflow.Product, fields []string) []any {
+	dest := make([]any, len(fields))
+	for i, f := range fields {
+		switch f {
+		case "id":
+			dest[i] = &p.ID
+		case "title":
+			dest[i] = &p.Title
+		case "price":
+			dest[i] = &p.Price
+		case "category":
+			dest[i] = &p.Category
+		case "brand":
+			dest[i] = &p.Brand
+		case "url":
+			dest[i] = &p.URL
+		case "description":
+			dest[i] = &p.Description
+		case "version":
+			dest[i] = &p.Version
+		case "updated_at":
+			dest[i] = &p.UpdatedAt
+		}
+	}
+	return dest
+}
+
+// Statements of the rows of a product.
+const (
+	insertProductStmt           = `INSERT INTO products(id, title, price, category, brand, url, description, version, updated_at) VALUES(?,?,?,?,?,?,?,?,?)`
+	insertProductByCategoryStmt = `INSERT INTO products_by_category(category, id, title, price, brand, url, description, version, updated_at) VALUES(?,?,?,?,?,?,?,?,?)`
+	insertProductByBrandStmt    = `INSERT INTO products_by_brand(brand, id, title, price, category, url, description, version, updated_at) VALUES(?,?,?,?,?,?,?,?,?)`
+)
+
+// create writes a new product row by a lightweight transaction, that returns ECONFLICT
+// for an existing product, and then its rows in the lookup tables.
+func (s *ProductService) create(ctx context.Context, p *dataflow.Product) error {
+	version := newVersion(p)
+
+	// Create the product row, unless it exists. A new product has no stale lookup rows.
+	applied, err := s.db.session.Query(insertProductStmt+` IF NOT EXISTS`,
+		p.ID, p.Title, p.Price, p.Category, p.Brand, p.URL, p.Description, version, p.UpdatedAt).WithContext(ctx).MapScanCAS(map[string]any{})
+	if err != nil {
+		return dataflow.Errorf(dataflow.EINTERNAL, "insert of %d failed with err: %v", p.ID, err)
+	} else if !applied {
+		return dataflow.Errorf(dataflow.ECONFLICT, "product with id: %d already exists", p.ID)
+	}
+
+	b := s.db.session.NewBatch(gocql.UnloggedBatch).WithContext(ctx)
+	list(b, p, version)
+	if err := s.db.session.ExecuteBatch(b); err != nil {
+		return dataflow.Errorf(dataflow.EINTERNAL, "insert of %d failed with err: %v", p.ID, err)
+	}
+	return nil
+}
+
+// replace writes a product row and its rows in the lookup tables, without reading the
+// existing product. The lookup rows of the previous category or brand in prev are deleted,
+// if they changed. Empty fields of prev are skipped.
+// The rows are partitions of their own, so they are written by an unlogged batch. A failed
+// batch may leave some of them written, until the product is written again.
+func (s *ProductService) replace(ctx context.Context, p *dataflow.Product, prev dataflow.ProductListing) error {
+	version := newVersion(p)
+
+	b := s.db.session.NewBatch(gocql.UnloggedBatch).WithContext(ctx)
+	b.Query(insertProductStmt, p.ID, p.Title, p.Price, p.Category, p.Brand, p.URL, p.Description, version, p.UpdatedAt)
+	list(b, p, version)
+
+	// Delete stale lookup rows.
+	if prev.Category == p.Category {
+		prev.Category = ""
+	}
+	if prev.Brand == p.Brand {
+		prev.Brand = ""
+	}
+	unlist(b, p.ID, prev)
+
+	if err := s.db.session.ExecuteBatch(b); err != nil {
+		return dataflow.Errorf(dataflow.EINTERNAL, "insert of %d failed with err: %v", p.ID, err)
+	}
+	return nil
+}
+
+// newVersion sets a new version and the update time of a product, and returns the version.
+// The version is a time-based UUID, so concurrent writes never share a version. The update
+// time is the time of the version. Cassandra stores timestamps in milliseconds.
+func newVersion(p *dataflow.Product) gocql.UUID {
+	version := gocql.TimeUUID()
+	p.Version = version.String()
+	p.UpdatedAt = version.Time().UTC().Truncate(time.Millisecond)
+	return version
+}
+
+// list adds the inserts of the lookup rows of a product to a batch.
+func list(b *gocql.Batch, p *dataflow.Product, version gocql.UUID) {
+	b.Query(insertProductByCategoryStmt, p.Category, p.ID, p.Title, p.Price, p.Brand, p.URL, p.Description, version, p.UpdatedAt)
+	b.Query(insertProductByBrandStmt, p.Brand, p.ID, p.Title, p.Price, p.Category, p.URL, p.Description, version, p.UpdatedAt)
+}
+
+// unlist adds the deletes of the lookup rows of a product under a listing to a batch.
+// Empty fields of the listing are skipped.
+func unlist(b *gocql.Batch, id uint32, l dataflow.ProductListing) {
+	if l.Category != "" {
+		b.Query(`DELETE FROM products_by_category WHERE category = ? AND id = ?`, l.Category, id)
+	}
+	if l.Brand != "" {
+		b.Query(`DELETE FROM products_by_brand WHERE brand = ? AND id = ?`, l.Brand, id)
+	}
 }
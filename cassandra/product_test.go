@@ -2,7 +2,10 @@ package cassandra_test
 
 import (
 	"context"
+	"fmt"
 	"reflect"
+	"slices"
+	"sync"
 	"testing"
 
 	dataflow "github.com/narslan/pipeline"
@@ -53,6 +56,13 @@ func TestProductService_CreateProduct(t *testing.T) {
 			t.Fatal(err)
 		}
 
+		// Ensure the version and update time are set.
+		if p.Version == "" {
+			t.Fatal("expected version")
+		} else if p.UpdatedAt.IsZero() {
+			t.Fatal("expected update time")
+		}
+
 		// Fetch product from database and compare.
 		if other, err := c.FindProductByID(context.Background(), 1); err != nil {
 			t.Fatal(err)
@@ -61,6 +71,50 @@ func TestProductService_CreateProduct(t *testing.T) {
 		}
 	})
 
+	// Ensure an error is returned if the product already exists.
+	t.Run("ErrConflict", func(t *testing.T) {
+		db := MustOpenDB(t, cassandraConnectionHost)
+		defer MustCloseDB(t, db)
+
+		s := cassandra.NewProductService(db)
+		p := &dataflow.Product{ID: 5, Title: "title5", Price: 1.0, Category: "bilgisayar", Brand: "brand1"}
+		if err := s.CreateProduct(context.Background(), p); err != nil {
+			t.Fatal(err)
+		} else if err := s.CreateProduct(context.Background(), p); dataflow.ErrorCode(err) != dataflow.ECONFLICT {
+			t.Fatalf("unexpected error: %#v", err)
+		}
+	})
+
+	// Ensure only one of concurrent creates of the same product succeeds.
+	t.Run("ErrConflictConcurrent", func(t *testing.T) {
+		db := MustOpenDB(t, cassandraConnectionHost)
+		defer MustCloseDB(t, db)
+
+		s := cassandra.NewProductService(db)
+		errs := make([]error, 4)
+		var wg sync.WaitGroup
+		for i := range errs {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs[i] = s.CreateProduct(context.Background(), &dataflow.Product{ID: 6, Title: "title6", Price: 1.0, Category: "bilgisayar", Brand: "brand1"})
+			}()
+		}
+		wg.Wait()
+
+		var created int
+		for _, err := range errs {
+			if err == nil {
+				created++
+			} else if dataflow.ErrorCode(err) != dataflow.ECONFLICT {
+				t.Fatalf("unexpected error: %#v", err)
+			}
+		}
+		if created != 1 {
+			t.Fatalf("expected 1 create, got %d", created)
+		}
+	})
+
 	// Ensure an error is returned if product id is not set.
 	t.Run("ErrIDRequired", func(t *testing.T) {
 		db := MustOpenDB(t, cassandraConnectionHost)
@@ -107,6 +161,93 @@ func TestProductService_CreateProduct(t *testing.T) {
 	})
 }
 
+func TestProductService_CreateProducts(t *testing.T) {
+	// Start containers for test.
+	ctx := context.Background()
+	cdbc, cassandraConnectionHost := container.MustDeployCassandra(ctx)
+	defer container.MustCleanCassandraContainer(ctx, cdbc)
+
+	// Ensure a number of products can be created at once.
+	t.Run("OK", func(t *testing.T) {
+		db := MustOpenDB(t, cassandraConnectionHost)
+		defer MustCloseDB(t, db)
+
+		s := cassandra.NewProductService(db)
+
+		ps := make([]*dataflow.Product, 0, 100)
+		for i := range 100 {
+			ps = append(ps, &dataflow.Product{
+				ID:       uint32(100 + i),
+				Title:    fmt.Sprintf("title%d", 100+i),
+				Price:    42.0,
+				Category: "bilgisayar",
+				Brand:    "brand1",
+			})
+		}
+
+		if err := s.CreateProducts(context.Background(), ps); err != nil {
+			t.Fatal(err)
+		}
+
+		// Fetch products from database and compare.
+		for _, p := range ps {
+			if other, err := s.FindProductByID(context.Background(), p.ID); err != nil {
+				t.Fatal(err)
+			} else if !reflect.DeepEqual(p, other) {
+				t.Fatalf("mismatch: %#v != %#v", p, other)
+			}
+		}
+	})
+
+	// Ensure no product is written, if one of them is invalid.
+	t.Run("ErrInvalid", func(t *testing.T) {
+		db := MustOpenDB(t, cassandraConnectionHost)
+		defer MustCloseDB(t, db)
+
+		s := cassandra.NewProductService(db)
+		err := s.CreateProducts(context.Background(), []*dataflow.Product{
+			{ID: 300, Title: "title300", Price: 1.0, Category: "bilgisayar", Brand: "brand1"},
+			{ID: 301},
+		})
+		if dataflow.ErrorCode(err) != dataflow.EINVALID {
+			t.Fatalf("unexpected error: %#v", err)
+		}
+
+		if _, err := s.FindProductByID(context.Background(), 300); dataflow.ErrorCode(err) != dataflow.ENOTFOUND {
+			t.Fatalf("unexpected error: %#v", err)
+		}
+	})
+}
+
+func TestProductService_FindProductsByIDs(t *testing.T) {
+	// Start containers for test.
+	ctx := context.Background()
+	cdbc, cassandraConnectionHost := container.MustDeployCassandra(ctx)
+	defer container.MustCleanCassandraContainer(ctx, cdbc)
+
+	// Ensure found products are returned in the order of ids, without missing ones.
+	t.Run("OK", func(t *testing.T) {
+		db := MustOpenDB(t, cassandraConnectionHost)
+		defer MustCloseDB(t, db)
+
+		s := cassandra.NewProductService(db)
+
+		for _, id := range []uint32{700, 701} {
+			p := &dataflow.Product{ID: id, Title: "title", Price: 1.0, Category: "bilgisayar", Brand: "brand1"}
+			if err := s.CreateProduct(context.Background(), p); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		ps, err := s.FindProductsByIDs(context.Background(), []uint32{701, 799, 700})
+		if err != nil {
+			t.Fatal(err)
+		} else if len(ps) != 2 || ps[0].ID != 701 || ps[1].ID != 700 {
+			t.Fatalf("unexpected products: %v", ps)
+		}
+	})
+}
+
 func TestProductService_FindProduct(t *testing.T) {
 	// Ensure an error is returned if fetching a non-existent product.
 	// Start containers for test.
@@ -114,6 +255,35 @@ func TestProductService_FindProduct(t *testing.T) {
 	cdbc, cassandraConnectionHost := container.MustDeployCassandra(ctx)
 	defer container.MustCleanCassandraContainer(ctx, cdbc)
 
+	// Ensure only the columns of a projection are read.
+	t.Run("Fields", func(t *testing.T) {
+		db := MustOpenDB(t, cassandraConnectionHost)
+		defer MustCloseDB(t, db)
+		s := cassandra.NewProductService(db)
+
+		p := &dataflow.Product{ID: 900, Title: "title900", Price: 2.5, Category: "bilgisayar", Brand: "brand1", Description: "long"}
+		if err := s.CreateProduct(context.Background(), p); err != nil {
+			t.Fatal(err)
+		}
+
+		want := &dataflow.Product{ID: 900, Price: 2.5}
+		if other, err := s.FindProductByID(context.Background(), 900, "price"); err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(other, want) {
+			t.Fatalf("mismatch: %#v != %#v", other, want)
+		}
+
+		if ps, _, err := s.ListProducts(context.Background(), dataflow.ProductFilter{Category: "bilgisayar", Fields: []string{"price"}}); err != nil {
+			t.Fatal(err)
+		} else if len(ps) != 1 || !reflect.DeepEqual(ps[0], want) {
+			t.Fatalf("unexpected products: %v", ps)
+		}
+
+		if _, err := s.FindProductByID(context.Background(), 900, "colour"); dataflow.ErrorCode(err) != dataflow.EINVALID {
+			t.Fatalf("unexpected error: %#v", err)
+		}
+	})
+
 	t.Run("ErrNotFound", func(t *testing.T) {
 		db := MustOpenDB(t, cassandraConnectionHost)
 		defer MustCloseDB(t, db)
@@ -125,3 +295,278 @@ func TestProductService_FindProduct(t *testing.T) {
 		}
 	})
 }
+
+func TestProductService_UpdateProduct(t *testing.T) {
+	// Start containers for test.
+	ctx := context.Background()
+	cdbc, cassandraConnectionHost := container.MustDeployCassandra(ctx)
+	defer container.MustCleanCassandraContainer(ctx, cdbc)
+
+	// Ensure only the fields of the update are changed.
+	t.Run("OK", func(t *testing.T) {
+		db := MustOpenDB(t, cassandraConnectionHost)
+		defer MustCloseDB(t, db)
+
+		s := cassandra.NewProductService(db)
+
+		p := &dataflow.Product{ID: 800, Title: "title800", Price: 1.0, Category: "bilgisayar", Brand: "brand1", URL: "https://url1.com"}
+		if err := s.CreateProduct(context.Background(), p); err != nil {
+			t.Fatal(err)
+		}
+
+		price := float32(2.5)
+		want := *p
+		want.Price = price
+		if got, err := s.UpdateProduct(context.Background(), 800, dataflow.ProductUpdate{Price: &price}); err != nil {
+			t.Fatal(err)
+		} else if got.Version == p.Version {
+			t.Fatalf("version did not change: %s", got.Version)
+		} else if got.UpdatedAt.Before(p.UpdatedAt) {
+			t.Fatalf("update time went back: %v < %v", got.UpdatedAt, p.UpdatedAt)
+		} else if want.Version, want.UpdatedAt = got.Version, got.UpdatedAt; !reflect.DeepEqual(got, &want) {
+			t.Fatalf("mismatch: %#v != %#v", got, &want)
+		}
+
+		if other, err := s.FindProductByID(context.Background(), 800); err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(other, &want) {
+			t.Fatalf("mismatch: %#v != %#v", other, &want)
+		}
+	})
+
+	// Ensure the new state is validated.
+	t.Run("ErrInvalid", func(t *testing.T) {
+		db := MustOpenDB(t, cassandraConnectionHost)
+		defer MustCloseDB(t, db)
+
+		s := cassandra.NewProductService(db)
+
+		p := &dataflow.Product{ID: 801, Title: "title801", Price: 1.0, Category: "bilgisayar", Brand: "brand1"}
+		if err := s.CreateProduct(context.Background(), p); err != nil {
+			t.Fatal(err)
+		}
+
+		title := ""
+		if _, err := s.UpdateProduct(context.Background(), 801, dataflow.ProductUpdate{Title: &title}); dataflow.ErrorCode(err) != dataflow.EINVALID {
+			t.Fatalf("unexpected error: %#v", err)
+		}
+	})
+
+	// Ensure an error is returned if updating a non-existent product.
+	t.Run("ErrNotFound", func(t *testing.T) {
+		db := MustOpenDB(t, cassandraConnectionHost)
+		defer MustCloseDB(t, db)
+
+		s := cassandra.NewProductService(db)
+		if _, err := s.UpdateProduct(context.Background(), 20, dataflow.ProductUpdate{}); dataflow.ErrorCode(err) != dataflow.ENOTFOUND {
+			t.Fatalf("unexpected error: %#v", err)
+		}
+	})
+}
+
+func TestProductService_DeleteProduct(t *testing.T) {
+	// Start containers for test.
+	ctx := context.Background()
+	cdbc, cassandraConnectionHost := container.MustDeployCassandra(ctx)
+	defer container.MustCleanCassandraContainer(ctx, cdbc)
+
+	// Ensure a product can be deleted and is no longer listed.
+	t.Run("OK", func(t *testing.T) {
+		db := MustOpenDB(t, cassandraConnectionHost)
+		defer MustCloseDB(t, db)
+
+		s := cassandra.NewProductService(db)
+
+		for _, id := range []uint32{400, 401} {
+			p := &dataflow.Product{ID: id, Title: "title", Price: 1.0, Category: "bilgisayar", Brand: "brand1"}
+			if err := s.CreateProduct(context.Background(), p); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := s.DeleteProduct(context.Background(), 400); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := s.FindProductByID(context.Background(), 400); dataflow.ErrorCode(err) != dataflow.ENOTFOUND {
+			t.Fatalf("unexpected error: %#v", err)
+		}
+
+		ids, err := s.FindProductIDs(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		} else if slices.Contains(ids, 400) || !slices.Contains(ids, 401) {
+			t.Fatalf("unexpected ids: %v", ids)
+		}
+	})
+
+	// Ensure an error is returned if deleting a non-existent product.
+	t.Run("ErrNotFound", func(t *testing.T) {
+		db := MustOpenDB(t, cassandraConnectionHost)
+		defer MustCloseDB(t, db)
+
+		s := cassandra.NewProductService(db)
+		if err := s.DeleteProduct(context.Background(), 20); dataflow.ErrorCode(err) != dataflow.ENOTFOUND {
+			t.Fatalf("unexpected error: %#v", err)
+		}
+	})
+}
+
+func TestProductService_ListProducts(t *testing.T) {
+	// Start containers for test.
+	ctx := context.Background()
+	cdbc, cassandraConnectionHost := container.MustDeployCassandra(ctx)
+	defer container.MustCleanCassandraContainer(ctx, cdbc)
+
+	// Ensure all products are listed exactly once, page by page.
+	t.Run("OK", func(t *testing.T) {
+		db := MustOpenDB(t, cassandraConnectionHost)
+		defer MustCloseDB(t, db)
+
+		s := cassandra.NewProductService(db)
+
+		for i := range 5 {
+			p := &dataflow.Product{ID: uint32(500 + i), Title: "title", Price: 1.0, Category: "bilgisayar", Brand: "brand1"}
+			if err := s.CreateProduct(context.Background(), p); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var listed []uint32
+		filter := dataflow.ProductFilter{Limit: 2}
+		for {
+			ps, next, err := s.ListProducts(context.Background(), filter)
+			if err != nil {
+				t.Fatal(err)
+			} else if len(ps) > 2 {
+				t.Fatalf("page too large: %d", len(ps))
+			}
+			for _, p := range ps {
+				listed = append(listed, p.ID)
+			}
+			if next == "" {
+				break
+			}
+			filter.Cursor = next
+		}
+
+		slices.Sort(listed)
+		if want := []uint32{500, 501, 502, 503, 504}; !reflect.DeepEqual(listed, want) {
+			t.Fatalf("listed mismatch; expected %v, got %v", want, listed)
+		}
+	})
+
+	// Ensure an error is returned if the cursor is malformed.
+	t.Run("ErrInvalidCursor", func(t *testing.T) {
+		db := MustOpenDB(t, cassandraConnectionHost)
+		defer MustCloseDB(t, db)
+
+		s := cassandra.NewProductService(db)
+		if _, _, err := s.ListProducts(context.Background(), dataflow.ProductFilter{Cursor: "%%%"}); dataflow.ErrorCode(err) != dataflow.EINVALID {
+			t.Fatalf("unexpected error: %#v", err)
+		}
+	})
+}
+
+func TestProductService_ListProducts_Filter(t *testing.T) {
+	// Start containers for test.
+	ctx := context.Background()
+	cdbc, cassandraConnectionHost := container.MustDeployCassandra(ctx)
+	defer container.MustCleanCassandraContainer(ctx, cdbc)
+
+	// Ensure products are listed by category and brand, also after they moved.
+	t.Run("OK", func(t *testing.T) {
+		db := MustOpenDB(t, cassandraConnectionHost)
+		defer MustCloseDB(t, db)
+
+		s := cassandra.NewProductService(db)
+
+		for _, p := range []*dataflow.Product{
+			{ID: 600, Title: "title600", Price: 1.0, Category: "bilgisayar", Brand: "brand1"},
+			{ID: 601, Title: "title601", Price: 1.0, Category: "bilgisayar", Brand: "brand2"},
+			{ID: 602, Title: "title602", Price: 1.0, Category: "telefon", Brand: "brand1"},
+		} {
+			if err := s.CreateProduct(context.Background(), p); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// Move the first product into another category.
+		category := "telefon"
+		if _, err := s.UpdateProduct(context.Background(), 600, dataflow.ProductUpdate{Category: &category}); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, tt := range []struct {
+			filter dataflow.ProductFilter
+			want   []uint32
+		}{
+			{dataflow.ProductFilter{Category: "bilgisayar"}, []uint32{601}},
+			{dataflow.ProductFilter{Category: "telefon"}, []uint32{600, 602}},
+			{dataflow.ProductFilter{Brand: "brand1"}, []uint32{600, 602}},
+			{dataflow.ProductFilter{Category: "telefon", Brand: "brand2"}, []uint32{}},
+		} {
+			ps, _, err := s.ListProducts(context.Background(), tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids := make([]uint32, 0, len(ps))
+			for _, p := range ps {
+				ids = append(ids, p.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Fatalf("filter %#v: expected %v, got %v", tt.filter, tt.want, ids)
+			}
+		}
+
+		// Ensure lookup rows are removed together with the product.
+		if err := s.DeleteProduct(context.Background(), 602); err != nil {
+			t.Fatal(err)
+		} else if ps, _, err := s.ListProducts(context.Background(), dataflow.ProductFilter{Brand: "brand1"}); err != nil {
+			t.Fatal(err)
+		} else if len(ps) != 1 || ps[0].ID != 600 {
+			t.Fatalf("unexpected products: %v", ps)
+		}
+	})
+
+	// Ensure a replaced product is listed under its previous brand, until it is unlisted.
+	t.Run("Unlist", func(t *testing.T) {
+		db := MustOpenDB(t, cassandraConnectionHost)
+		defer MustCloseDB(t, db)
+
+		s := cassandra.NewProductService(db)
+
+		p := &dataflow.Product{ID: 610, Title: "title610", Price: 1.0, Category: "kamera", Brand: "brand3"}
+		if err := s.CreateProducts(context.Background(), []*dataflow.Product{p}); err != nil {
+			t.Fatal(err)
+		}
+		moved := *p
+		moved.Brand = "brand4"
+		if err := s.CreateProducts(context.Background(), []*dataflow.Product{&moved}); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, tt := range []struct {
+			unlist map[uint32]dataflow.ProductListing
+			want   []uint32
+		}{
+			{nil, []uint32{610}},
+			{map[uint32]dataflow.ProductListing{610: {Brand: "brand3"}}, []uint32{}},
+		} {
+			if err := s.UnlistProducts(context.Background(), tt.unlist); err != nil {
+				t.Fatal(err)
+			}
+			ps, _, err := s.ListProducts(context.Background(), dataflow.ProductFilter{Brand: "brand3"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids := make([]uint32, 0, len(ps))
+			for _, p := range ps {
+				ids = append(ids, p.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, ids)
+			}
+		}
+	})
+}
@@ -0,0 +1,48 @@
+package dataflow
+
+import (
+	"context"
+	"time"
+)
+
+// Checkpoint statuses.
+const (
+	CheckpointRunning  = "running"
+	CheckpointComplete = "complete"
+)
+
+// Checkpoint represents the progress of the pipeline on a single source.
+// A resumed run skips sources that are complete and unchanged,
+// and continues partially processed sources after the last processed line.
+type Checkpoint struct {
+	// Key of the source.
+	Key string `json:"key"`
+
+	// Metadata of the source, used to detect changes between runs.
+	ETag string `json:"etag,omitempty"`
+	Size int64  `json:"size,omitempty"`
+
+	// Number of lines processed so far and the byte offset after the last of them.
+	// For compressed sources the offset counts decompressed bytes.
+	Line   int64 `json:"line"`
+	Offset int64 `json:"offset"`
+
+	// Compression format of the source, if it is compressed.
+	Encoding string `json:"encoding,omitempty"`
+
+	// Status of the source, either running or complete.
+	Status string `json:"status"`
+
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CheckpointService represents a service for storing pipeline progress.
+type CheckpointService interface {
+
+	// Retrieves the checkpoint of a source.
+	// Returns ENOTFOUND if checkpoint does not exist.
+	FindCheckpoint(ctx context.Context, key string) (*Checkpoint, error)
+
+	// Creates or replaces the checkpoint of a source.
+	SaveCheckpoint(ctx context.Context, c *Checkpoint) error
+}
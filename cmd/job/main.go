@@ -1,20 +1,31 @@
 package main
 
 import (
+	"cmp"
 	"context"
+	"crypto/rand"
 	"errors"
 	"flag"
 	"fmt"
+	"log/slog"
 	"os"
 	"os/signal"
+	"regexp"
 	"runtime"
+	"strings"
 	"time"
 
 	"github.com/BurntSushi/toml"
+	"github.com/narslan/pipeline"
 	"github.com/narslan/pipeline/cassandra"
+	"github.com/narslan/pipeline/file"
+	"github.com/narslan/pipeline/http"
+	"github.com/narslan/pipeline/inmem"
 	"github.com/narslan/pipeline/pipeline"
 	"github.com/narslan/pipeline/redis"
 	"github.com/narslan/pipeline/s3"
+	"github.com/narslan/pipeline/tracing"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 // main is the entry point into our application. It doesn't return errors.
@@ -24,7 +35,7 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt)
-	go func() { <-c; cancel() }()
+	go func() { <-c; cancel(); signal.Stop(c) }()
 
 	// Instantiate a new type to represent our application.
 	m := NewMain()
@@ -46,14 +57,14 @@ func main() {
 	case err := <-errCh: // errCh receives nil if pipeline succefully finishes.
 		if err != nil {
 			// we can gracefully print error.
-			fmt.Println(err)
+			slog.Error("pipeline failed", "error", err)
 		}
-	case <-c:
-		fmt.Println("closing")
-		// Release resources.
-		m.Close()
 	case <-ctx.Done():
-		fmt.Println("caught interrupt")
+		slog.Info("caught interrupt")
+		// Wait for the pipeline to save its progress. Interrupt again to exit immediately.
+		if err := <-errCh; err != nil && err != context.Canceled {
+			slog.Error("pipeline failed", "error", err)
+		}
 		m.Close()
 	}
 
@@ -64,11 +75,17 @@ func (m *Main) ParseFlags(ctx context.Context, args []string) error {
 	//It fails if config file is not supplied.
 	flag.StringVar(&m.ConfigPath, "config", "", "config path")
 	flag.IntVar(&m.NumCPU, "concurrency", 0, "number of concurrent goroutines")
+	flag.BoolVar(&m.Resume, "resume", false, "continue from the checkpoints of a previous run")
+	flag.Var(&m.Sources, "source", "source key, glob or prefix like s3://bucket/prefix/*.jsonl, file://path or https://host/path (repeatable)")
+	flag.StringVar(&m.Match, "match", "", "regular expression, that discovered keys must match")
+	flag.BoolVar(&m.Snapshot, "snapshot", false, "treat the sources as the full set of products and delete missing ones")
+	flag.StringVar(&m.MetricsAddr, "metrics-addr", "", "address to serve metrics on /metrics during the run, like :9100")
+	flag.StringVar(&m.MetricsFile, "metrics-file", "", "path to write the metrics to at the end of the run, in the text exposition format")
 
 	// Custom error handling
 	flag.Usage = func() {
 		fmt.Fprint(flag.CommandLine.Output(), "Supply a config file similar to:\n")
-		fmt.Printf("%s  -config path -concurrency 4\n   ", os.Args[0])
+		fmt.Printf("%s  -config path -concurrency 4 [-resume | -snapshot] [-source s3://bucket/prefix/*.jsonl] [-match regexp] [-metrics-addr :9100] [-metrics-file path]\n   ", os.Args[0])
 	}
 	flag.Parse()
 
@@ -81,6 +98,16 @@ func (m *Main) ParseFlags(ctx context.Context, args []string) error {
 		m.NumCPU = runtime.NumCPU()
 	}
 
+	// A resumed run does not see the products of lines processed before.
+	if m.Snapshot && m.Resume {
+		return errors.New("-snapshot can not be combined with -resume")
+	}
+
+	// Without sources, the product files of the default bucket are processed.
+	if len(m.Sources) == 0 {
+		m.Sources = Sources{DefaultSource}
+	}
+
 	// Read our TOML formatted configuration file.
 	config, err := ReadConfigFile(m.ConfigPath)
 	if os.IsNotExist(err) {
@@ -90,6 +117,14 @@ func (m *Main) ParseFlags(ctx context.Context, args []string) error {
 	}
 	m.Config = config
 
+	// Write structured logs as configured. Each run is told apart by its ID.
+	logger, err := newLogger(config.Log.Level, config.Log.Format)
+	if err != nil {
+		return err
+	}
+	m.Logger = logger.With("run_id", rand.Text())
+	slog.SetDefault(m.Logger)
+
 	return nil
 }
 
@@ -99,7 +134,81 @@ type Main struct {
 	Config     Config
 	ConfigPath string
 	NumCPU     int
+	Resume     bool
+	Snapshot   bool
+	Sources    Sources
+	Match      string
 	DB         *cassandra.DB
+
+	// Logger of the run. The logs of all services carry the ID of the run.
+	Logger *slog.Logger
+
+	// Metrics are served on MetricsAddr while the job runs,
+	// and written to MetricsFile once it is done.
+	MetricsAddr string
+	MetricsFile string
+}
+
+// DefaultSource is processed, if no source is given on the command line.
+const DefaultSource = "products-*.jsonl"
+
+// Sources represents a repeatable command line flag of sources.
+type Sources []string
+
+// String implements flag.Value.
+func (s *Sources) String() string {
+	return strings.Join(*s, ",")
+}
+
+// Set implements flag.Value.
+func (s *Sources) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// allURLs reports whether all sources have a URI scheme.
+func allURLs(sources []string) bool {
+	for _, src := range sources {
+		if pipeline.Scheme(src) == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// discover expands the sources into keys. Globs and prefixes ending with '/' are listed,
+// if their fetcher can list. Other sources are used as they are.
+// If a match expression is given, keys are filtered by it.
+func (m *Main) discover(ctx context.Context, r *pipeline.FetchRegistry) ([]string, error) {
+	var re *regexp.Regexp
+	if m.Match != "" {
+		var err error
+		if re, err = regexp.Compile(m.Match); err != nil {
+			return nil, err
+		}
+	}
+
+	keys := make([]string, 0)
+	for _, src := range m.Sources {
+		found := []string{src}
+		if r.CanList(src) && pipeline.IsPattern(src) {
+			var err error
+			if found, err = r.List(ctx, src); err != nil {
+				return nil, err
+			}
+		}
+
+		for _, key := range found {
+			if re == nil || re.MatchString(key) {
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no sources found for %s", m.Sources.String())
+	}
+	return keys, nil
 }
 
 // NewMain returns a new instance of Main.
@@ -107,7 +216,8 @@ func NewMain() *Main {
 	return &Main{
 
 		// This field is here to make Close method of the DB available for Main.
-		DB: &cassandra.DB{},
+		DB:     &cassandra.DB{},
+		Logger: slog.Default(),
 	}
 }
 
@@ -134,6 +244,61 @@ type Config struct {
 		Pass string `toml:"pass"`
 		DB   int    `toml:"db"`
 	} `toml:"redis"`
+
+	Pipeline struct {
+		// Path of the JSONL file, that rejected lines are appended to.
+		DeadLetter string `toml:"dead_letter"`
+		// Number of rejected lines tolerated before the run fails. Negative means no limit.
+		ErrorBudget int64 `toml:"error_budget"`
+		// Maximum number of products written to Cassandra at once.
+		BatchSize int `toml:"batch_size"`
+		// Maximum time a batch waits for more products, like "50ms".
+		BatchLinger time.Duration `toml:"batch_linger"`
+	} `toml:"pipeline"`
+
+	Checkpoint struct {
+		// Backend of the checkpoint store, either "file" or "redis". Empty disables checkpoints.
+		Backend string `toml:"backend"`
+		// Path of the checkpoint file for the file backend.
+		Path string `toml:"path"`
+	} `toml:"checkpoint"`
+
+	Cache struct {
+		// Backend of the fingerprint cache: "redis" (default), "memory" or "tiered".
+		// The tiered backend keeps recently used fingerprints in memory in front of Redis.
+		// They are checked against Redis, when the job starts.
+		Backend string `toml:"backend"`
+		// Maximum number of product IDs in memory.
+		Size int `toml:"size"`
+		// Path of the snapshot of the in-memory cache. Empty disables the snapshot.
+		Path string `toml:"path"`
+	} `toml:"cache"`
+
+	Search struct {
+		// Path of the search index snapshot, that the job updates. Empty disables the index.
+		Path string `toml:"path"`
+	} `toml:"search"`
+
+	// Spans are exported, if an exporter is set.
+	Tracing struct {
+		// Exporter of spans: "otlp", "stdout" or "none".
+		Exporter string `toml:"exporter"`
+		// Address of the OTLP/HTTP collector, like "localhost:4318".
+		Endpoint string `toml:"endpoint"`
+		// Send spans to the collector without TLS.
+		Insecure bool `toml:"insecure"`
+		// Path of the file, that the stdout exporter writes to. Empty writes to stdout.
+		Path string `toml:"path"`
+		// Ratio of sampled traces. Zero samples all traces.
+		SampleRatio float64 `toml:"sample_ratio"`
+	} `toml:"tracing"`
+
+	Log struct {
+		// Minimum level of logs: "debug", "info" (default), "warn" or "error".
+		Level slog.Level `toml:"level"`
+		// Format of logs: "json" (default) or "text".
+		Format string `toml:"format"`
+	} `toml:"log"`
 }
 
 // ReadConfigFile unmarshals config from file.
@@ -149,16 +314,24 @@ func ReadConfigFile(filename string) (Config, error) {
 
 // Run executes the main program, which starts the pipeline job.
 func (m *Main) Run(ctx context.Context, errCh chan<- error) {
+	start := time.Now()
+	logger := m.Logger
+
+	// Serve the metrics for scrapers during the run.
+	if addr := m.MetricsAddr; addr != "" {
+		go func() {
+			if err := http.ListenAndServeMetrics(addr); err != nil {
+				logger.Error("metrics server failed", "addr", addr, "error", err)
+			}
+		}()
+	}
 
-	defer timeTrack(time.Now(), "Pipeline")
-
-	fmt.Println("Executing Pipeline")
-	// Name of the files, that are on S3. They will get by S3Service.
-	files := []string{
-		"products-1.jsonl",
-		"products-2.jsonl",
-		"products-3.jsonl",
-		"products-4.jsonl"}
+	// Export the spans of the run. Pending spans are flushed once the pipeline is done.
+	tp := m.tracer()
+	if err := tp.Open(ctx); err != nil {
+		errCh <- err
+		return
+	}
 
 	// Set Cassandra connection params that comes from config file.
 	dbhost := m.Config.Cassandra.Host
@@ -167,64 +340,227 @@ func (m *Main) Run(ctx context.Context, errCh chan<- error) {
 	pass := m.Config.Cassandra.Pass
 
 	// Connect to Cassandra.
-	fmt.Println("Connecting Cassandra")
+	logger.Info("connecting to cassandra", "host", dbhost, "keyspace", keyspace)
 	db, err := cassandra.NewDB(dbhost, keyspace, user, pass)
 	if err != nil {
 		errCh <- err
+		return
 	}
+	db.Logger = logger
 
-	fmt.Println("Succefuly connected to Cassandra")
 	// Assign to the DB instance of main program, to be able to close database from the main program.
 	m.DB = db
 
 	// Instantiate Cassandra-backed service. This service manages operations on Cassandra.
 	productService := cassandra.NewProductService(m.DB)
 
-	// Set Redis connection params from config file.
-	addr := m.Config.Redis.Addr
-	rpass := m.Config.Redis.Pass
-	rdb := m.Config.Redis.DB
+	// Connect to Redis, if an address is set. Local runs can do without it.
+	var cache *redis.Cache
+	if addr := m.Config.Redis.Addr; addr != "" {
+		logger.Info("connecting to redis", "addr", addr)
+		if cache, err = redis.NewCache(addr, m.Config.Redis.Pass, m.Config.Redis.DB); err != nil {
+			errCh <- err
+			return
+		}
+		cache.Logger = logger
+	}
+
+	// Instantiate the cache service of product fingerprints.
+	var (
+		cacheService dataflow.Cache
+		local        *inmem.Cache
+	)
+	switch backend := m.Config.Cache.Backend; backend {
+	case "", "redis", "tiered":
+		if cache == nil {
+			errCh <- fmt.Errorf("cache backend %q requires a redis address", cmp.Or(backend, "redis"))
+			return
+		}
+		cacheService = redis.NewIDCacheService(cache)
+		if backend == "tiered" {
+			local = inmem.NewCache(m.Config.Cache.Size)
+			cacheService = inmem.NewTieredCache(local, cacheService)
+		}
+	case "memory":
+		local = inmem.NewCache(m.Config.Cache.Size)
+		cacheService = local
+	default:
+		errCh <- fmt.Errorf("unknown cache backend: %s", backend)
+		return
+	}
 
-	// Connect to Redis.
-	fmt.Println("Connecting to Redis")
-	cache, err := redis.NewCache(addr, rpass, rdb)
-	if err != nil {
-		errCh <- err
+	// Warm up the in-memory cache from the snapshot of the previous run.
+	if local != nil && m.Config.Cache.Path != "" {
+		if err := local.Load(m.Config.Cache.Path); err != nil {
+			errCh <- err
+			return
+		}
 	}
 
-	fmt.Println("Connected to Redis")
-	// Instantiate Redis-backed cache service. This service manages operations on the database.
-	cacheService := redis.NewIDCacheService(cache)
+	// Drop the fingerprints in memory, that were removed from Redis by writes of the microservice.
+	if tiered, ok := cacheService.(*inmem.TieredCache); ok {
+		if err := tiered.Sync(ctx); err != nil {
+			errCh <- err
+			return
+		}
+	}
 
-	// Start S3 service
+	// Start S3 service. The bucket is only needed for sources without a scheme.
 	bucket, ok := os.LookupEnv("AWS_S3_BUCKET")
-	if !ok {
+	if !ok && !allURLs(m.Sources) {
 		errCh <- errors.New("AWS_S3_BUCKET environment variable not found")
+		return
 	}
 
 	// Instantiate S3 fetcher, which retrieves file from S3.
 	s3Service, err := s3.NewS3FetchService(bucket)
 	if err != nil {
 		errCh <- err
+		return
 	}
+	s3Service.Logger = logger
+
+	// Register a fetcher for each supported scheme. Sources without a scheme are S3 keys.
+	fetchers := pipeline.NewFetchRegistry()
+	fetchers.Register("", s3Service)
+	fetchers.Register("s3", s3Service)
+	fetchers.Register("file", file.NewFetchService())
+	fetchers.Register("http", http.NewFetchService())
+	fetchers.Register("https", http.NewFetchService())
+
+	// Discover the keys of the sources.
+	files, err := m.discover(ctx, fetchers)
+	if err != nil {
+		errCh <- err
+		return
+	}
+	logger.Info("found sources", "count", len(files))
 
-	// Make a pipeline from s3Service and key names.
-	pipe := pipeline.NewPipeline(s3Service, m.NumCPU)
+	// Make a pipeline from the fetchers and key names.
+	pipe := pipeline.NewPipeline(fetchers, m.NumCPU)
+	pipe.Logger = logger
 
-	// Bind services to the pipeline.
+	// Bind services to the pipeline. With Redis, writes go through the product cache
+	// of the microservice, so they invalidate its entries.
 	pipe.ProductService = productService
+	if cache != nil {
+		pipe.ProductService = redis.NewProductService(cache, productService)
+	}
 	pipe.CacheService = cacheService
+	pipe.ErrorBudget = m.Config.Pipeline.ErrorBudget
+	pipe.BatchSize = m.Config.Pipeline.BatchSize
+	pipe.BatchLinger = m.Config.Pipeline.BatchLinger
+
+	// Track the progress of each source, if a checkpoint store is configured.
+	switch m.Config.Checkpoint.Backend {
+	case "file":
+		checkpoints, err := file.NewCheckpointService(m.Config.Checkpoint.Path)
+		if err != nil {
+			errCh <- err
+			return
+		}
+		pipe.Checkpoints = checkpoints
+	case "redis":
+		if cache == nil {
+			errCh <- errors.New("checkpoint backend \"redis\" requires a redis address")
+			return
+		}
+		pipe.Checkpoints = redis.NewCheckpointService(cache)
+	case "":
+	default:
+		errCh <- fmt.Errorf("unknown checkpoint backend: %s", m.Config.Checkpoint.Backend)
+		return
+	}
+	pipe.Resume = m.Resume
+	pipe.Snapshot = m.Snapshot
+
+	// Open the dead-letter file, if one is configured.
+	if path := m.Config.Pipeline.DeadLetter; path != "" {
+		deadLetters, err := file.NewDeadLetterSink(path)
+		if err != nil {
+			errCh <- err
+			return
+		}
+		defer deadLetters.Close()
+		pipe.DeadLetters = deadLetters
+	}
+
+	// Update the search index of previous runs, if one is configured.
+	var index *inmem.SearchIndex
+	if path := m.Config.Search.Path; path != "" {
+		index = inmem.NewSearchIndex()
+		if err := index.Load(path); err != nil {
+			errCh <- err
+			return
+		}
+		pipe.SearchService = index
+	}
+
+	// Kick start the pipeline.
+	err = pipe.Run(ctx, files...)
+
+	// Write the index of all saved products, so the microservice can load it.
+	if index != nil {
+		if serr := index.Save(m.Config.Search.Path); err == nil {
+			err = serr
+		}
+	}
+
+	// Write the in-memory cache for the next run.
+	if local != nil && m.Config.Cache.Path != "" {
+		if serr := local.Save(m.Config.Cache.Path); err == nil {
+			err = serr
+		}
+	}
+	if m.Snapshot && err == nil && pipe.Stats.Rejected.Load() > 0 {
+		logger.Warn("skipped deletion of missing products, because lines were rejected")
+	}
+	logger.Info("pipeline finished",
+		"rejected", pipe.Stats.Rejected.Load(),
+		"inserted", pipe.Stats.Inserted.Load(),
+		"updated", pipe.Stats.Updated.Load(),
+		"unchanged", pipe.Stats.Unchanged.Load(),
+		"deleted", pipe.Stats.Deleted.Load(),
+		"duration", time.Since(start),
+	)
+
+	// Dump the metrics of the run, so a textfile collector or pushgateway can pick them up.
+	if path := m.MetricsFile; path != "" {
+		if merr := prometheus.WriteToTextfile(path, prometheus.DefaultGatherer); err == nil {
+			err = merr
+		}
+	}
 
-	// Read JSONL files and return them as a channel of byte slice.
-	fmt.Println("Starting pipeline")
-	// Kick start the pipeline. Send the error or completion result in the errCh
-	errCh <- pipe.Run(context.TODO(), files...)
+	// Flush the spans, before the program exits.
+	if terr := tp.Close(context.WithoutCancel(ctx)); err == nil {
+		err = terr
+	}
+
+	// Send the error or completion result in the errCh
+	errCh <- err
 
 }
 
-// timeTrack tells how long it takes for a function to run.
-// Adapted from https://blog.stathat.com/2012/10/10/time_any_function_in_go.html
-func timeTrack(start time.Time, name string) {
-	elapsed := time.Since(start)
-	fmt.Printf("%s tooks %s", name, elapsed)
+// tracer returns the tracer provider of the job as configured.
+func (m *Main) tracer() *tracing.Provider {
+	tp := tracing.NewProvider("dataflow-job")
+	tp.Exporter = m.Config.Tracing.Exporter
+	tp.Endpoint = m.Config.Tracing.Endpoint
+	tp.Insecure = m.Config.Tracing.Insecure
+	tp.Path = m.Config.Tracing.Path
+	tp.SampleRatio = m.Config.Tracing.SampleRatio
+	return tp
+}
+
+// newLogger returns a logger, that writes logs of at least level to stderr in the given format.
+func newLogger(level slog.Level, format string) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: level}
+	switch format {
+	case "", "json":
+		return slog.New(slog.NewJSONHandler(os.Stderr, opts)), nil
+	case "text":
+		return slog.New(slog.NewTextHandler(os.Stderr, opts)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format: %s", format)
+	}
 }
@@ -4,12 +4,18 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"log/slog"
 	"os"
 	"os/signal"
+	"time"
 
 	"github.com/BurntSushi/toml"
+	"github.com/narslan/pipeline"
 	"github.com/narslan/pipeline/cassandra"
 	"github.com/narslan/pipeline/http"
+	"github.com/narslan/pipeline/inmem"
+	"github.com/narslan/pipeline/redis"
+	"github.com/narslan/pipeline/tracing"
 )
 
 // main is the entry point to our application.
@@ -34,7 +40,7 @@ func main() {
 	// Execute program.
 	if err := m.Run(ctx); err != nil {
 		m.Close()
-		fmt.Fprintln(os.Stderr, err)
+		slog.Error("microservice failed", "error", err)
 		os.Exit(1)
 	}
 
@@ -43,7 +49,7 @@ func main() {
 
 	// Clean up program.
 	if err := m.Close(); err != nil {
-		fmt.Fprintln(os.Stderr, err)
+		slog.Error("microservice failed to close", "error", err)
 		os.Exit(1)
 	}
 }
@@ -60,6 +66,21 @@ func (m *Main) Close() error {
 		m.DB.Close()
 	}
 
+	if m.Cache != nil {
+		if err := m.Cache.ShutDown(); err != nil {
+			return err
+		}
+	}
+
+	// Export the spans of the last requests.
+	if m.Tracing != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := m.Tracing.Close(ctx); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -89,6 +110,14 @@ func (m *Main) ParseFlags(ctx context.Context, args []string) error {
 	}
 	m.Config = config
 
+	// Write structured logs as configured.
+	logger, err := newLogger(config.Log.Level, config.Log.Format)
+	if err != nil {
+		return err
+	}
+	m.Logger = logger
+	slog.SetDefault(m.Logger)
+
 	return nil
 }
 
@@ -99,7 +128,12 @@ type Main struct {
 	ConfigPath string
 
 	DB         *cassandra.DB
+	Cache      *redis.Cache
 	HTTPServer *http.Server
+	Tracing    *tracing.Provider
+
+	// Logger of the services. The logs of a request carry its ID.
+	Logger *slog.Logger
 }
 
 // NewMain returns a new instance of Main.
@@ -110,6 +144,8 @@ func NewMain() *Main {
 		// This is here to make Close method of the DB available for Main, not beautiful to have here.
 		DB:         &cassandra.DB{},
 		HTTPServer: http.NewServer(),
+		Tracing:    tracing.NewProvider("dataflow-microservice"),
+		Logger:     slog.Default(),
 	}
 }
 
@@ -125,11 +161,97 @@ type Config struct {
 		User     string `toml:"user"`
 		Pass     string `toml:"pass"`
 	} `toml:"cassandra"`
+
+	// Products are cached in Redis, if an address is set.
+	Redis struct {
+		Addr string `toml:"addr"`
+		Pass string `toml:"pass"`
+		DB   int    `toml:"db"`
+		// Lifetime of a cached product, like "5m".
+		TTL time.Duration `toml:"ttl"`
+		// Lifetime of a cached miss, like "30s".
+		NotFoundTTL time.Duration `toml:"not_found_ttl"`
+		// Time, that a written product is not cached, like "5s".
+		InvalidationTTL time.Duration `toml:"invalidation_ttl"`
+	} `toml:"redis"`
+
+	// Fingerprint cache of the job. Writes remove the fingerprints of their products from Redis,
+	// unless the job keeps them only in its own memory. A job with the tiered backend drops the
+	// fingerprints in its memory, that are gone from Redis, when it starts. So writes during a run
+	// are only seen by the next run.
+	Cache struct {
+		Backend string `toml:"backend"`
+	} `toml:"cache"`
+
+	Search struct {
+		// Path of the search index snapshot written by the job. Empty disables search.
+		Path string `toml:"path"`
+		// Interval of checks for a new snapshot, like "1m". Zero loads it only at startup.
+		ReloadInterval time.Duration `toml:"reload_interval"`
+	} `toml:"search"`
+
+	// Requests are authenticated, if any credential is configured.
+	Auth struct {
+		// Static API keys.
+		APIKeys []struct {
+			Name   string   `toml:"name"`
+			Key    string   `toml:"key"`
+			Scopes []string `toml:"scopes"`
+		} `toml:"api_keys"`
+
+		// Shared secrets of signed requests.
+		HMACKeys []struct {
+			ID     string   `toml:"id"`
+			Secret string   `toml:"secret"`
+			Scopes []string `toml:"scopes"`
+		} `toml:"hmac_keys"`
+
+		// Path of the JSON Web Key Set, that verifies bearer tokens.
+		// Tokens must be issued for the domain of the [http] section.
+		JWKS string `toml:"jwks"`
+		// Issuer of bearer tokens. Empty accepts any issuer.
+		Issuer string `toml:"issuer"`
+	} `toml:"auth"`
+
+	// Requests are rate limited, if a backend is set.
+	RateLimit struct {
+		// Backend of the token buckets: "memory" limits each replica on its own,
+		// "redis" shares the buckets between replicas.
+		Backend string `toml:"backend"`
+		// Header of the client IP address, as set by a trusted proxy.
+		ClientIPHeader string `toml:"client_ip_header"`
+		// Limit of routes without a limit of their own.
+		Default dataflow.RateLimit `toml:"default"`
+		// Limits by route pattern, like "GET /product/{id}".
+		Routes map[string]dataflow.RateLimit `toml:"routes"`
+	} `toml:"ratelimit"`
+
+	// Spans are exported, if an exporter is set.
+	Tracing struct {
+		// Exporter of spans: "otlp", "stdout" or "none".
+		Exporter string `toml:"exporter"`
+		// Address of the OTLP/HTTP collector, like "localhost:4318".
+		Endpoint string `toml:"endpoint"`
+		// Send spans to the collector without TLS.
+		Insecure bool `toml:"insecure"`
+		// Path of the file, that the stdout exporter writes to. Empty writes to stdout.
+		Path string `toml:"path"`
+		// Ratio of sampled traces. Zero samples all traces.
+		SampleRatio float64 `toml:"sample_ratio"`
+	} `toml:"tracing"`
+
+	Log struct {
+		// Minimum level of logs: "debug", "info" (default), "warn" or "error".
+		Level slog.Level `toml:"level"`
+		// Format of logs: "json" (default) or "text".
+		Format string `toml:"format"`
+	} `toml:"log"`
 }
 
 // DefaultConfig returns a new instance of Config with defaults set.
 func DefaultConfig() Config {
 	var config Config
+	config.Search.ReloadInterval = time.Minute
 	return config
 }
 
@@ -147,6 +269,16 @@ func ReadConfigFile(filename string) (Config, error) {
 // Run executes the program.
 func (m *Main) Run(ctx context.Context) error {
 
+	// Export the spans of requests and queries.
+	m.Tracing.Exporter = m.Config.Tracing.Exporter
+	m.Tracing.Endpoint = m.Config.Tracing.Endpoint
+	m.Tracing.Insecure = m.Config.Tracing.Insecure
+	m.Tracing.Path = m.Config.Tracing.Path
+	m.Tracing.SampleRatio = m.Config.Tracing.SampleRatio
+	if err := m.Tracing.Open(ctx); err != nil {
+		return err
+	}
+
 	// Set Cassandra connection params from config file.
 	dbhost := m.Config.Cassandra.Host
 	keyspace := m.Config.Cassandra.Keyspace
@@ -161,16 +293,152 @@ func (m *Main) Run(ctx context.Context) error {
 	// Assign to the DB instance of main program.
 	// This is required, as main program should be able to close the db instance.
 	m.DB = db
+	m.DB.Logger = m.Logger
 	// Instantiate Cassandra-backed service.
-	productService := cassandra.NewProductService(m.DB)
+	var productService dataflow.ProductService = cassandra.NewProductService(m.DB)
+
+	// Serve lookups from the Redis cache, if one is configured.
+	if addr := m.Config.Redis.Addr; addr != "" {
+		cache, err := redis.NewCache(addr, m.Config.Redis.Pass, m.Config.Redis.DB)
+		if err != nil {
+			return err
+		}
+		m.Cache = cache
+		m.Cache.Logger = m.Logger
+
+		cached := redis.NewProductService(cache, productService)
+		if ttl := m.Config.Redis.TTL; ttl > 0 {
+			cached.TTL = ttl
+		}
+		if ttl := m.Config.Redis.NotFoundTTL; ttl > 0 {
+			cached.NotFoundTTL = ttl
+		}
+		if ttl := m.Config.Redis.InvalidationTTL; ttl > 0 {
+			cached.InvalidationTTL = ttl
+		}
+		if m.Config.Cache.Backend != "memory" {
+			cached.Fingerprints = redis.NewIDCacheService(cache)
+		}
+		productService = cached
+	}
 
 	m.HTTPServer.Address = m.Config.HTTP.Address
+	m.HTTPServer.Logger = m.Logger
 	// Attach underlying services to the HTTP server.
 	m.HTTPServer.ProductService = productService
 
+	// Authenticate requests by the configured credentials.
+	if err := m.setupAuth(); err != nil {
+		return err
+	}
+
+	// Limit the rate of requests of each client.
+	switch backend := m.Config.RateLimit.Backend; backend {
+	case "memory":
+		m.HTTPServer.RateLimiter = inmem.NewRateLimiter()
+	case "redis":
+		if m.Cache == nil {
+			return fmt.Errorf("ratelimit backend %q requires a redis address", backend)
+		}
+		m.HTTPServer.RateLimiter = redis.NewRateLimiter(m.Cache)
+	case "":
+	default:
+		return fmt.Errorf("unknown ratelimit backend: %s", backend)
+	}
+	m.HTTPServer.RateLimits = m.Config.RateLimit.Routes
+	m.HTTPServer.DefaultRateLimit = m.Config.RateLimit.Default
+	m.HTTPServer.ClientIPHeader = m.Config.RateLimit.ClientIPHeader
+
+	// Load the search index built by the job.
+	if path := m.Config.Search.Path; path != "" {
+		index := inmem.NewSearchIndex()
+		if err := index.Load(path); err != nil {
+			return err
+		}
+		m.HTTPServer.SearchService = index
+
+		if interval := m.Config.Search.ReloadInterval; interval > 0 {
+			go m.reloadSearchIndex(ctx, index, path, interval)
+		}
+	}
+
 	// Start the HTTP server.
 	return m.HTTPServer.Open()
 
 	//TODO: Enable internal debug endpoints.
 
 }
+
+// reloadSearchIndex loads the snapshot of the search index again, whenever the job wrote a new one.
+// It checks the snapshot in each interval, until ctx is done.
+func (m *Main) reloadSearchIndex(ctx context.Context, index *inmem.SearchIndex, path string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if ok, err := index.Reload(path); err != nil {
+				m.Logger.Warn("search index reload failed", "path", path, "error", err)
+			} else if ok {
+				m.Logger.Info("search index reloaded", "path", path)
+			}
+		}
+	}
+}
+
+// setupAuth attaches an authenticator to the HTTP server for each kind of configured credential.
+func (m *Main) setupAuth() error {
+	if keys := m.Config.Auth.APIKeys; len(keys) > 0 {
+		a := http.NewAPIKeyAuthenticator()
+		for _, k := range keys {
+			if k.Name == "" {
+				return fmt.Errorf("api key: name required")
+			} else if k.Key == "" {
+				return fmt.Errorf("api key %q: key required", k.Name)
+			}
+			a.AddKey(k.Key, &dataflow.Principal{Subject: k.Name, Scopes: k.Scopes})
+		}
+		m.HTTPServer.Authenticators = append(m.HTTPServer.Authenticators, a)
+	}
+
+	if keys := m.Config.Auth.HMACKeys; len(keys) > 0 {
+		a := http.NewHMACAuthenticator()
+		for _, k := range keys {
+			if k.Secret == "" {
+				return fmt.Errorf("hmac key %q: secret required", k.ID)
+			}
+			a.AddKey(k.ID, []byte(k.Secret), &dataflow.Principal{Subject: k.ID, Scopes: k.Scopes})
+		}
+		m.HTTPServer.Authenticators = append(m.HTTPServer.Authenticators, a)
+	}
+
+	if path := m.Config.Auth.JWKS; path != "" {
+		a := http.NewJWTAuthenticator()
+		if err := a.LoadJWKS(path); err != nil {
+			return err
+		}
+		a.Audience = m.Config.HTTP.Domain
+		a.Issuer = m.Config.Auth.Issuer
+		m.HTTPServer.Authenticators = append(m.HTTPServer.Authenticators, a)
+	}
+
+	if len(m.HTTPServer.Authenticators) == 0 {
+		m.Logger.Warn("no credentials configured, requests are not authenticated")
+	}
+	return nil
+}
+
+// newLogger returns a logger, that writes logs of at least level to stderr in the given format.
+func newLogger(level slog.Level, format string) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: level}
+	switch format {
+	case "", "json":
+		return slog.New(slog.NewJSONHandler(os.Stderr, opts)), nil
+	case "text":
+		return slog.New(slog.NewTextHandler(os.Stderr, opts)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format: %s", format)
+	}
+}
@@ -0,0 +1,34 @@
+package dataflow
+
+import (
+	"context"
+	"time"
+)
+
+// A dead letter is an input record that the pipeline could not process,
+// like a malformed JSON line or a product that fails validation.
+// Instead of aborting the whole run, such records are put aside into a sink,
+// so they can be inspected and replayed later.
+
+// DeadLetter represents a rejected input record.
+type DeadLetter struct {
+	// Key of the source, the record was read from.
+	Source string `json:"source"`
+
+	// Line number of the record in the source, starting at 1.
+	Line int64 `json:"line"`
+
+	// Raw content of the record.
+	Raw string `json:"raw"`
+
+	// Reason of the rejection.
+	Error string `json:"error"`
+
+	// Time of the rejection.
+	Time time.Time `json:"time"`
+}
+
+// DeadLetterSink represents a destination for rejected records.
+type DeadLetterSink interface {
+	Put(ctx context.Context, d *DeadLetter) error
+}
@@ -7,9 +7,21 @@ import (
 
 // Application error codes.
 const (
+	ECONFLICT = "conflict"
 	EINTERNAL = "internal"
 	EINVALID  = "invalid"
 	ENOTFOUND = "not_found"
+
+	// EUNAUTHORIZED is returned for a missing or invalid credential,
+	// EFORBIDDEN for a valid credential, that lacks the scope of an operation.
+	EUNAUTHORIZED = "unauthorized"
+	EFORBIDDEN    = "forbidden"
+
+	// ETOOMANYREQUESTS is returned, if a client exceeds its rate limit.
+	ETOOMANYREQUESTS = "too_many_requests"
+
+	// ENOTACCEPTABLE is returned, if no representation of a response is acceptable to the client.
+	ENOTACCEPTABLE = "not_acceptable"
 )
 
 // Error represents an application error.
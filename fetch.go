@@ -1,8 +1,48 @@
 package dataflow
 
-import "context"
+import (
+	"context"
+	"io"
+)
 
 // Fetch represents methods for data retrieval from remote resources.
 type Fetch interface {
 	Get(ctx context.Context, url string) ([]byte, error)
 }
+
+// StreamFetch represents methods for streaming data retrieval from remote resources.
+// Unlike Fetch, it does not buffer the whole resource in memory.
+// The caller is responsible for closing the returned reader.
+type StreamFetch interface {
+	Open(ctx context.Context, url string) (io.ReadCloser, error)
+}
+
+// ObjectInfo represents metadata of a remote resource.
+type ObjectInfo struct {
+	Key  string
+	ETag string
+	Size int64
+}
+
+// StatFetch is implemented by fetchers that can report metadata of a resource
+// without downloading it.
+type StatFetch interface {
+	Stat(ctx context.Context, url string) (*ObjectInfo, error)
+}
+
+// RangeFetch is implemented by fetchers that can stream a resource starting at a byte offset.
+type RangeFetch interface {
+	OpenAt(ctx context.Context, url string, offset int64) (io.ReadCloser, error)
+}
+
+// ListFetch is implemented by fetchers that can discover resources matching a glob pattern.
+type ListFetch interface {
+	List(ctx context.Context, pattern string) ([]string, error)
+}
+
+// EncodedReader is implemented by streams, that know the content encoding
+// of the resource, like "gzip" or "zstd".
+type EncodedReader interface {
+	io.ReadCloser
+	ContentEncoding() string
+}
@@ -0,0 +1,84 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/narslan/pipeline"
+)
+
+// Ensure service implements interface.
+var _ dataflow.CheckpointService = (*CheckpointService)(nil)
+
+// CheckpointService represents a checkpoint store backed by a local JSON file.
+// The whole file is rewritten on each save. It is meant for a modest number of sources.
+type CheckpointService struct {
+	mu          sync.Mutex
+	path        string
+	checkpoints map[string]*dataflow.Checkpoint
+}
+
+// NewCheckpointService returns a new instance of CheckpointService.
+// Checkpoints of previous runs are loaded from path, if the file exists.
+func NewCheckpointService(path string) (*CheckpointService, error) {
+	s := &CheckpointService{path: path, checkpoints: make(map[string]*dataflow.Checkpoint)}
+
+	buf, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(buf, &s.checkpoints); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// FindCheckpoint retrieves the checkpoint of a source.
+// Returns ENOTFOUND if checkpoint does not exist.
+func (s *CheckpointService) FindCheckpoint(ctx context.Context, key string) (*dataflow.Checkpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.checkpoints[key]
+	if !ok {
+		return nil, dataflow.Errorf(dataflow.ENOTFOUND, "checkpoint of %s is not found", key)
+	}
+	other := *c
+	return &other, nil
+}
+
+// SaveCheckpoint creates or replaces the checkpoint of a source.
+func (s *CheckpointService) SaveCheckpoint(ctx context.Context, c *dataflow.Checkpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	other := *c
+	s.checkpoints[c.Key] = &other
+
+	buf, err := json.MarshalIndent(s.checkpoints, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first and rename it,
+	// so a crash never leaves a truncated file behind.
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(buf); err != nil {
+		tmp.Close()
+		return err
+	} else if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
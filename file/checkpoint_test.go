@@ -0,0 +1,63 @@
+package file_test
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	dataflow "github.com/narslan/pipeline"
+	"github.com/narslan/pipeline/file"
+)
+
+func TestCheckpointService_SaveCheckpoint(t *testing.T) {
+	// Ensure checkpoints can be saved and loaded by a new instance.
+	t.Run("OK", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "checkpoints.json")
+
+		s, err := file.NewCheckpointService(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c := &dataflow.Checkpoint{
+			Key:       "products-1.jsonl",
+			ETag:      `"abc"`,
+			Size:      1024,
+			Line:      10,
+			Offset:    512,
+			Status:    dataflow.CheckpointRunning,
+			UpdatedAt: time.Unix(1, 0).UTC(),
+		}
+		if err := s.SaveCheckpoint(context.Background(), c); err != nil {
+			t.Fatal(err)
+		}
+
+		// Open the file again, as a resumed run does.
+		other, err := file.NewCheckpointService(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got, err := other.FindCheckpoint(context.Background(), c.Key); err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(got, c) {
+			t.Fatalf("mismatch: %#v != %#v", got, c)
+		}
+	})
+}
+
+func TestCheckpointService_FindCheckpoint(t *testing.T) {
+	// Ensure an error is returned if fetching a non-existent checkpoint.
+	t.Run("ErrNotFound", func(t *testing.T) {
+		s, err := file.NewCheckpointService(filepath.Join(t.TempDir(), "checkpoints.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := s.FindCheckpoint(context.Background(), "products-1.jsonl"); dataflow.ErrorCode(err) != dataflow.ENOTFOUND {
+			t.Fatalf("unexpected error: %#v", err)
+		}
+	})
+}
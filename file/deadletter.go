@@ -0,0 +1,52 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/narslan/pipeline"
+)
+
+// Ensure service implements interface.
+var _ dataflow.DeadLetterSink = (*DeadLetterSink)(nil)
+
+// DeadLetterSink represents a dead-letter sink backed by a local JSONL file.
+// Each rejected record is appended as a single line.
+type DeadLetterSink struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+// NewDeadLetterSink opens the file at path for appending.
+// The file is created if it does not exist.
+func NewDeadLetterSink(path string) (*DeadLetterSink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &DeadLetterSink{file: f, enc: json.NewEncoder(f)}, nil
+}
+
+// Put appends a rejected record to the file.
+func (s *DeadLetterSink) Put(ctx context.Context, d *dataflow.DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Encoder terminates each record with a newline.
+	return s.enc.Encode(d)
+}
+
+// Close flushes and closes the underlying file.
+func (s *DeadLetterSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.file.Sync(); err != nil {
+		s.file.Close()
+		return err
+	}
+	return s.file.Close()
+}
@@ -0,0 +1,61 @@
+package file_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	dataflow "github.com/narslan/pipeline"
+	"github.com/narslan/pipeline/file"
+)
+
+func TestDeadLetterSink_Put(t *testing.T) {
+	// Ensure rejected records are appended as JSON lines.
+	t.Run("OK", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "deadletter.jsonl")
+
+		s, err := file.NewDeadLetterSink(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := []*dataflow.DeadLetter{
+			{Source: "products-1.jsonl", Line: 3, Raw: `{"id":`, Error: "unexpected end of JSON input", Time: time.Unix(1, 0).UTC()},
+			{Source: "products-2.jsonl", Line: 7, Raw: `{"id":0}`, Error: "ID must be greater than 0.", Time: time.Unix(2, 0).UTC()},
+		}
+		for _, d := range want {
+			if err := s.Put(context.Background(), d); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := s.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		// Read the records back line by line.
+		var got []*dataflow.DeadLetter
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var d dataflow.DeadLetter
+			if err := json.Unmarshal(scanner.Bytes(), &d); err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, &d)
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("mismatch: %#v != %#v", got, want)
+		}
+	})
+}
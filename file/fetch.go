@@ -0,0 +1,120 @@
+package file
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/narslan/pipeline"
+)
+
+// Ensure that FetchService implements the fetch interfaces.
+var _ dataflow.Fetch = (*FetchService)(nil)
+var _ dataflow.StreamFetch = (*FetchService)(nil)
+var _ dataflow.StatFetch = (*FetchService)(nil)
+var _ dataflow.RangeFetch = (*FetchService)(nil)
+var _ dataflow.ListFetch = (*FetchService)(nil)
+
+// FetchService represents a fetcher for the local filesystem.
+// Sources are either plain paths or URLs like file:///path/to/file.
+type FetchService struct{}
+
+// NewFetchService returns a new instance of FetchService.
+func NewFetchService() *FetchService {
+	return &FetchService{}
+}
+
+// Get method reads a local file and return data of the file as byte slice.
+func (s *FetchService) Get(ctx context.Context, url string) ([]byte, error) {
+	buf, err := os.ReadFile(Path(url))
+	return buf, wrap(err)
+}
+
+// Open method opens a local file for streaming.
+func (s *FetchService) Open(ctx context.Context, url string) (io.ReadCloser, error) {
+	f, err := os.Open(Path(url))
+	if err != nil {
+		return nil, wrap(err)
+	}
+	return f, nil
+}
+
+// OpenAt method opens a local file for streaming, starting at offset.
+func (s *FetchService) OpenAt(ctx context.Context, url string, offset int64) (io.ReadCloser, error) {
+	f, err := os.Open(Path(url))
+	if err != nil {
+		return nil, wrap(err)
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// Stat method returns the size of a local file. The ETag is derived
+// from the size and the modification time of the file.
+func (s *FetchService) Stat(ctx context.Context, url string) (*dataflow.ObjectInfo, error) {
+	fi, err := os.Stat(Path(url))
+	if err != nil {
+		return nil, wrap(err)
+	}
+
+	etag := strconv.FormatInt(fi.ModTime().UnixNano(), 16) + "-" + strconv.FormatInt(fi.Size(), 16)
+	return &dataflow.ObjectInfo{Key: url, ETag: etag, Size: fi.Size()}, nil
+}
+
+// List method returns the files, that match a glob pattern like "data/*.jsonl".
+// A pattern ending with '/' matches every file under the directory.
+// If the pattern is a file:// URL, the files are returned as URLs too.
+func (s *FetchService) List(ctx context.Context, pattern string) ([]string, error) {
+	dir := Path(pattern)
+
+	var paths []string
+	if strings.HasSuffix(dir, "/") {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			} else if !d.IsDir() {
+				paths = append(paths, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, wrap(err)
+		}
+	} else {
+		var err error
+		if paths, err = filepath.Glob(dir); err != nil {
+			return nil, dataflow.Errorf(dataflow.EINVALID, "invalid pattern %q: %v", pattern, err)
+		}
+	}
+
+	keys := make([]string, 0, len(paths))
+	for _, path := range paths {
+		if strings.HasPrefix(pattern, "file://") {
+			path = "file://" + path
+		}
+		keys = append(keys, path)
+	}
+	return keys, nil
+}
+
+// Path returns the local path of a source. A source is either
+// a plain path or a file:// URL.
+func Path(url string) string {
+	path, _ := strings.CutPrefix(url, "file://")
+	return path
+}
+
+// wrap converts a missing file to a ENOTFOUND error.
+func wrap(err error) error {
+	if os.IsNotExist(err) {
+		return dataflow.Errorf(dataflow.ENOTFOUND, "%v", err)
+	}
+	return err
+}
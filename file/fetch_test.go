@@ -0,0 +1,115 @@
+package file_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	dataflow "github.com/narslan/pipeline"
+	"github.com/narslan/pipeline/file"
+)
+
+// MustWriteFile writes data to a file under dir and returns its path. Fatal on error.
+func MustWriteFile(tb testing.TB, dir, name, data string) string {
+	tb.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		tb.Fatal(err)
+	} else if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		tb.Fatal(err)
+	}
+	return path
+}
+
+func TestFetchService_Open(t *testing.T) {
+	dir := t.TempDir()
+	path := MustWriteFile(t, dir, "products-1.jsonl", "line1\nline2\n")
+	s := file.NewFetchService()
+
+	// Ensure plain paths and file:// URLs can be opened.
+	for _, url := range []string{path, "file://" + path} {
+		t.Run(url, func(t *testing.T) {
+			body, err := s.Open(context.Background(), url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer body.Close()
+
+			if got, err := io.ReadAll(body); err != nil {
+				t.Fatal(err)
+			} else if string(got) != "line1\nline2\n" {
+				t.Fatalf("content mismatch: %q", got)
+			}
+		})
+	}
+
+	// Ensure the file can be opened at an offset.
+	t.Run("OpenAt", func(t *testing.T) {
+		body, err := s.OpenAt(context.Background(), path, 6)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer body.Close()
+
+		if got, err := io.ReadAll(body); err != nil {
+			t.Fatal(err)
+		} else if string(got) != "line2\n" {
+			t.Fatalf("content mismatch: %q", got)
+		}
+	})
+
+	// Ensure an error is returned if the file does not exist.
+	t.Run("ErrNotFound", func(t *testing.T) {
+		if _, err := s.Open(context.Background(), filepath.Join(dir, "missing.jsonl")); dataflow.ErrorCode(err) != dataflow.ENOTFOUND {
+			t.Fatalf("unexpected error: %#v", err)
+		}
+	})
+}
+
+func TestFetchService_Stat(t *testing.T) {
+	path := MustWriteFile(t, t.TempDir(), "products-1.jsonl", "line1\n")
+	s := file.NewFetchService()
+
+	// Ensure the size is reported.
+	info, err := s.Stat(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	} else if info.Size != 6 || info.ETag == "" {
+		t.Fatalf("unexpected info: %#v", info)
+	}
+}
+
+func TestFetchService_List(t *testing.T) {
+	dir := t.TempDir()
+	a := MustWriteFile(t, dir, "products-1.jsonl", "")
+	b := MustWriteFile(t, dir, "products-2.jsonl", "")
+	c := MustWriteFile(t, dir, "nested/products-3.jsonl", "")
+	MustWriteFile(t, dir, "readme.txt", "")
+
+	s := file.NewFetchService()
+
+	testCases := []struct {
+		name    string
+		pattern string
+		want    []string
+	}{
+		{name: "Glob", pattern: filepath.Join(dir, "*.jsonl"), want: []string{a, b}},
+		{name: "URL", pattern: "file://" + filepath.Join(dir, "products-2.*"), want: []string{"file://" + b}},
+		{name: "Directory", pattern: filepath.Join(dir, "nested") + "/", want: []string{c}},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.name, func(t *testing.T) {
+			got, err := s.List(context.Background(), tC.pattern)
+			if err != nil {
+				t.Fatal(err)
+			} else if !reflect.DeepEqual(got, tC.want) {
+				t.Fatalf("mismatch: %#v != %#v", got, tC.want)
+			}
+		})
+	}
+}
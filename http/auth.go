@@ -0,0 +1,233 @@
+package http
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/narslan/pipeline"
+)
+
+// Authenticator authenticates requests by one kind of credential.
+type Authenticator interface {
+	// Scheme returns the authentication scheme of the credential, as challenged
+	// in the WWW-Authenticate header.
+	Scheme() string
+
+	// Authenticate returns the principal of a request. It returns nil, if the request
+	// carries no credential of its kind. Returns EUNAUTHORIZED if the credential is invalid.
+	Authenticate(r *http.Request) (*dataflow.Principal, error)
+}
+
+// authorize wraps a handler, so that it only serves principals, that are granted scope.
+// The principal is attached to the context of the request. Requests are not authenticated,
+// if the server has no authenticators.
+func (s *Server) authorize(scope string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(s.Authenticators) == 0 {
+			h(w, r)
+			return
+		}
+
+		p, err := s.authenticate(r)
+		if err != nil {
+			for _, a := range s.Authenticators {
+				w.Header().Add("WWW-Authenticate", a.Scheme())
+			}
+			Error(w, r, err)
+			return
+		} else if !p.HasScope(scope) {
+			Error(w, r, dataflow.Errorf(dataflow.EFORBIDDEN, "Credential lacks scope %s", scope))
+			return
+		}
+
+		h(w, r.WithContext(dataflow.NewContextWithPrincipal(r.Context(), p)))
+	}
+}
+
+// authenticate returns the principal of the first authenticator, that finds a credential.
+// The principal is a copy, that holds the scheme of the authenticator.
+// Returns EUNAUTHORIZED if the request has no valid credential.
+func (s *Server) authenticate(r *http.Request) (*dataflow.Principal, error) {
+	for _, a := range s.Authenticators {
+		if p, err := a.Authenticate(r); err != nil {
+			return nil, err
+		} else if p != nil {
+			other := *p
+			other.Scheme = a.Scheme()
+			return &other, nil
+		}
+	}
+	return nil, dataflow.Errorf(dataflow.EUNAUTHORIZED, "Missing credential")
+}
+
+// credential returns the credential of an authorization scheme from the Authorization header.
+// It returns false, if the header is of another scheme.
+func credential(r *http.Request, scheme string) (string, bool) {
+	s, v, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(s, scheme) {
+		return "", false
+	}
+	return strings.TrimSpace(v), true
+}
+
+// APIKeyAuthenticator authenticates requests by static API keys. The key is passed
+// in the X-API-Key header, or in the Authorization header with the ApiKey scheme.
+type APIKeyAuthenticator struct {
+	// Principals by the hash of their key. Looking up hashes keeps the time of
+	// a lookup independent of the characters of the key.
+	keys map[[sha256.Size]byte]*dataflow.Principal
+}
+
+// NewAPIKeyAuthenticator returns a new instance of APIKeyAuthenticator without keys.
+func NewAPIKeyAuthenticator() *APIKeyAuthenticator {
+	return &APIKeyAuthenticator{keys: make(map[[sha256.Size]byte]*dataflow.Principal)}
+}
+
+// AddKey grants a key the scopes of a principal.
+func (a *APIKeyAuthenticator) AddKey(key string, p *dataflow.Principal) {
+	a.keys[sha256.Sum256([]byte(key))] = p
+}
+
+// Scheme returns the ApiKey scheme.
+func (a *APIKeyAuthenticator) Scheme() string {
+	return "ApiKey"
+}
+
+// Authenticate returns the principal of the API key of the request.
+// Returns EUNAUTHORIZED if the key is unknown.
+func (a *APIKeyAuthenticator) Authenticate(r *http.Request) (*dataflow.Principal, error) {
+	key := r.Header.Get("X-API-Key")
+	if key == "" {
+		var ok bool
+		if key, ok = credential(r, a.Scheme()); !ok {
+			return nil, nil
+		}
+	}
+
+	p, ok := a.keys[sha256.Sum256([]byte(key))]
+	if !ok {
+		return nil, dataflow.Errorf(dataflow.EUNAUTHORIZED, "Invalid API key")
+	}
+	return p, nil
+}
+
+// MaxClockSkew is the maximum difference between the time of a signed request and the server time.
+// Signed requests can be replayed within this period.
+const MaxClockSkew = 5 * time.Minute
+
+// HMACAuthenticator authenticates requests, that are signed with a shared secret.
+// The Authorization header holds the key ID, the Unix time and the signature of a request:
+//
+//	Authorization: HMAC-SHA256 <id>:<time>:<signature>
+//
+// The signature is the hex-encoded HMAC-SHA256 of the method, the request URI, the time and
+// the hex-encoded SHA-256 of the body, separated by newlines. See SignRequest.
+type HMACAuthenticator struct {
+	keys map[string]hmacKey
+
+	// Returns the current time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// hmacKey represents the secret of a key ID and the principal, that it authenticates.
+type hmacKey struct {
+	secret    []byte
+	principal *dataflow.Principal
+}
+
+// NewHMACAuthenticator returns a new instance of HMACAuthenticator without keys.
+func NewHMACAuthenticator() *HMACAuthenticator {
+	return &HMACAuthenticator{
+		keys: make(map[string]hmacKey),
+		Now:  time.Now,
+	}
+}
+
+// AddKey grants the secret of a key ID the scopes of a principal.
+func (a *HMACAuthenticator) AddKey(id string, secret []byte, p *dataflow.Principal) {
+	a.keys[id] = hmacKey{secret: secret, principal: p}
+}
+
+// Scheme returns the HMAC-SHA256 scheme.
+func (a *HMACAuthenticator) Scheme() string {
+	return "HMAC-SHA256"
+}
+
+// Authenticate returns the principal of the key, that signed the request.
+// Returns EUNAUTHORIZED if the key is unknown, the signature does not match, or the time
+// of the request is off by more than MaxClockSkew.
+func (a *HMACAuthenticator) Authenticate(r *http.Request) (*dataflow.Principal, error) {
+	v, ok := credential(r, a.Scheme())
+	if !ok {
+		return nil, nil
+	}
+
+	// Parse the key ID, time and signature.
+	parts := strings.Split(v, ":")
+	if len(parts) != 3 {
+		return nil, dataflow.Errorf(dataflow.EUNAUTHORIZED, "Malformed signature")
+	}
+	id, ts, sig := parts[0], parts[1], parts[2]
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return nil, dataflow.Errorf(dataflow.EUNAUTHORIZED, "Malformed signature")
+	} else if d := a.Now().Sub(time.Unix(unix, 0)).Abs(); d > MaxClockSkew {
+		return nil, dataflow.Errorf(dataflow.EUNAUTHORIZED, "Signature expired")
+	}
+	mac, err := hex.DecodeString(sig)
+	if err != nil {
+		return nil, dataflow.Errorf(dataflow.EUNAUTHORIZED, "Malformed signature")
+	}
+
+	key, ok := a.keys[id]
+	if !ok {
+		return nil, dataflow.Errorf(dataflow.EUNAUTHORIZED, "Invalid signature")
+	}
+	want, err := signature(r, key.secret, ts)
+	if err != nil {
+		return nil, err
+	} else if !hmac.Equal(mac, want) {
+		return nil, dataflow.Errorf(dataflow.EUNAUTHORIZED, "Invalid signature")
+	}
+	return key.principal, nil
+}
+
+// SignRequest sets the Authorization header of a request, which is signed at time t
+// with the secret of a key ID. The body of the request is read and replaced.
+func SignRequest(r *http.Request, id string, secret []byte, t time.Time) error {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	mac, err := signature(r, secret, ts)
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Authorization", "HMAC-SHA256 "+id+":"+ts+":"+hex.EncodeToString(mac))
+	return nil
+}
+
+// signature returns the HMAC of a request and its time. The body of the request is read
+// and replaced, so that it can be read again.
+func signature(r *http.Request, secret []byte, ts string) ([]byte, error) {
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		var err error
+		if body, err = io.ReadAll(io.LimitReader(r.Body, MaxBodySize+1)); err != nil {
+			return nil, err
+		} else if len(body) > MaxBodySize {
+			return nil, dataflow.Errorf(dataflow.EINVALID, "Request body too large")
+		}
+		r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	sum := sha256.Sum256(body)
+
+	h := hmac.New(sha256.New, secret)
+	io.WriteString(h, r.Method+"\n"+r.URL.RequestURI()+"\n"+ts+"\n"+hex.EncodeToString(sum[:]))
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,282 @@
+package http_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/narslan/pipeline"
+	dataflowhttp "github.com/narslan/pipeline/http"
+)
+
+// Ensure routes are only served to principals with their scope.
+func TestAuthorize(t *testing.T) {
+	// Start the mocked HTTP test server.
+	s := MustOpenServer(t)
+	defer MustCloseServer(t, s)
+
+	keys := dataflowhttp.NewAPIKeyAuthenticator()
+	keys.AddKey("reader-key", &dataflow.Principal{Subject: "reader", Scopes: []string{dataflow.ScopeRead}})
+	keys.AddKey("writer-key", &dataflow.Principal{Subject: "writer", Scopes: []string{dataflow.ScopeRead, dataflow.ScopeWrite}})
+	s.Authenticators = []dataflowhttp.Authenticator{keys}
+
+	s.ProductService.FindProductByIDFn = func(ctx context.Context, id uint32, fields ...string) (*dataflow.Product, error) {
+		if p := dataflow.PrincipalFromContext(ctx); p == nil || p.Subject != "reader" {
+			t.Fatalf("unexpected principal: %#v", p)
+		}
+		return &dataflow.Product{ID: id}, nil
+	}
+	s.ProductService.DeleteProductFn = func(ctx context.Context, id uint32) error {
+		return nil
+	}
+
+	for _, tt := range []struct {
+		name   string
+		method string
+		url    string
+		header string
+		value  string
+		want   int
+	}{
+		{"OK", "GET", "/product/1", "X-API-Key", "reader-key", http.StatusOK},
+		{"AuthorizationHeader", "GET", "/product/1", "Authorization", "ApiKey reader-key", http.StatusOK},
+		{"Write", "DELETE", "/product/1", "X-API-Key", "writer-key", http.StatusNoContent},
+		{"ErrMissing", "GET", "/product/1", "", "", http.StatusUnauthorized},
+		{"ErrInvalid", "GET", "/product/1", "X-API-Key", "other-key", http.StatusUnauthorized},
+		{"ErrOtherScheme", "GET", "/product/1", "Authorization", "Basic dXNlcjpwYXNz", http.StatusUnauthorized},
+		{"ErrForbidden", "DELETE", "/product/1", "X-API-Key", "reader-key", http.StatusForbidden},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req := s.MustNewRequest(t, context.TODO(), tt.method, tt.url, nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if got := resp.StatusCode; got != tt.want {
+				t.Fatalf("StatusCode=%v, want %v", got, tt.want)
+			} else if got := resp.Header.Get("WWW-Authenticate"); (got != "") != (tt.want == http.StatusUnauthorized) {
+				t.Fatalf("unexpected WWW-Authenticate: %q", got)
+			}
+		})
+	}
+}
+
+// Ensure signed requests are authenticated by their key.
+func TestHMACAuthenticator(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	principal := &dataflow.Principal{Subject: "partner", Scopes: []string{dataflow.ScopeWrite}}
+
+	a := dataflowhttp.NewHMACAuthenticator()
+	a.AddKey("partner", []byte("secret"), principal)
+	a.Now = func() time.Time { return now }
+
+	newRequest := func(body string) *http.Request {
+		r, err := http.NewRequest("POST", "http://localhost/products?x=1", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	t.Run("OK", func(t *testing.T) {
+		r := newRequest(`{"id": 1}`)
+		if err := dataflowhttp.SignRequest(r, "partner", []byte("secret"), now.Add(-time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+		if p, err := a.Authenticate(r); err != nil {
+			t.Fatal(err)
+		} else if p != principal {
+			t.Fatalf("unexpected principal: %#v", p)
+		}
+
+		// Ensure the body can be read by the handler.
+		var v map[string]int
+		if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+			t.Fatal(err)
+		} else if v["id"] != 1 {
+			t.Fatalf("unexpected body: %v", v)
+		}
+	})
+
+	t.Run("NoCredential", func(t *testing.T) {
+		if p, err := a.Authenticate(newRequest("")); err != nil || p != nil {
+			t.Fatalf("unexpected result: %#v, %v", p, err)
+		}
+	})
+
+	for _, tt := range []struct {
+		name   string
+		id     string
+		secret string
+		at     time.Time
+		modify func(r *http.Request)
+	}{
+		{"ErrUnknownKey", "other", "secret", now, nil},
+		{"ErrWrongSecret", "partner", "guess", now, nil},
+		{"ErrExpired", "partner", "secret", now.Add(-dataflowhttp.MaxClockSkew - time.Second), nil},
+		{"ErrModifiedBody", "partner", "secret", now, func(r *http.Request) {
+			r.Body = http.NoBody
+		}},
+		{"ErrModifiedURL", "partner", "secret", now, func(r *http.Request) {
+			r.URL.RawQuery = "x=2"
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRequest(`{"id": 1}`)
+			if err := dataflowhttp.SignRequest(r, tt.id, []byte(tt.secret), tt.at); err != nil {
+				t.Fatal(err)
+			}
+			if tt.modify != nil {
+				tt.modify(r)
+			}
+			if _, err := a.Authenticate(r); dataflow.ErrorCode(err) != dataflow.EUNAUTHORIZED {
+				t.Fatalf("unexpected error: %#v", err)
+			}
+		})
+	}
+}
+
+// Ensure bearer tokens are verified against the keys of a JWKS file.
+func TestJWTAuthenticator(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Write the public keys to a JWKS file.
+	b64 := base64.RawURLEncoding.EncodeToString
+	jwks, err := json.Marshal(map[string]any{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa1", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "EC", "kid": "ec1", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+		{"kty": "oct", "kid": "enc1", "use": "enc"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, jwks, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	a := dataflowhttp.NewJWTAuthenticator()
+	if err := a.LoadJWKS(path); err != nil {
+		t.Fatal(err)
+	}
+	a.Audience = "api.example.com"
+	a.Issuer = "https://auth.example.com"
+	a.Now = func() time.Time { return now }
+
+	// sign returns a token of the claims, signed by the key of kid.
+	sign := func(alg, kid string, claims map[string]any) string {
+		header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+		payload, _ := json.Marshal(claims)
+		input := b64(header) + "." + b64(payload)
+		hash := sha256.Sum256([]byte(input))
+
+		var sig []byte
+		switch kid {
+		case "rsa1":
+			if sig, err = rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, hash[:]); err != nil {
+				t.Fatal(err)
+			}
+		default:
+			r, s, err := ecdsa.Sign(rand.Reader, ecKey, hash[:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+		}
+		return input + "." + b64(sig)
+	}
+
+	claims := func(modify func(c map[string]any)) map[string]any {
+		c := map[string]any{
+			"sub":   "client1",
+			"iss":   "https://auth.example.com",
+			"aud":   []string{"api.example.com", "other"},
+			"exp":   now.Add(time.Hour).Unix(),
+			"nbf":   now.Add(-time.Hour).Unix(),
+			"scope": "products:read products:write",
+		}
+		if modify != nil {
+			modify(c)
+		}
+		return c
+	}
+
+	// tamper replaces the subject of a signed token.
+	tamper := func(token string) string {
+		parts := strings.Split(token, ".")
+		payload, _ := json.Marshal(claims(func(c map[string]any) { c["sub"] = "admin" }))
+		return parts[0] + "." + b64(payload) + "." + parts[2]
+	}
+
+	authenticate := func(token string) (*dataflow.Principal, error) {
+		r, err := http.NewRequest("GET", "http://localhost/product/1", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Header.Set("Authorization", "Bearer "+token)
+		return a.Authenticate(r)
+	}
+
+	for _, tt := range []struct {
+		name string
+		alg  string
+		kid  string
+	}{{"RS256", "RS256", "rsa1"}, {"ES256", "ES256", "ec1"}} {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := authenticate(sign(tt.alg, tt.kid, claims(nil)))
+			if err != nil {
+				t.Fatal(err)
+			} else if p.Subject != "client1" || !p.HasScope(dataflow.ScopeRead) || !p.HasScope(dataflow.ScopeWrite) {
+				t.Fatalf("unexpected principal: %#v", p)
+			}
+		})
+	}
+
+	for _, tt := range []struct {
+		name  string
+		token string
+	}{
+		{"ErrExpired", sign("RS256", "rsa1", claims(func(c map[string]any) { c["exp"] = now.Add(-2 * dataflowhttp.JWTLeeway).Unix() }))},
+		{"ErrMissingExpiry", sign("RS256", "rsa1", claims(func(c map[string]any) { delete(c, "exp") }))},
+		{"ErrNotYetValid", sign("RS256", "rsa1", claims(func(c map[string]any) { c["nbf"] = now.Add(time.Hour).Unix() }))},
+		{"ErrAudience", sign("RS256", "rsa1", claims(func(c map[string]any) { c["aud"] = "other" }))},
+		{"ErrIssuer", sign("ES256", "ec1", claims(func(c map[string]any) { c["iss"] = "https://evil.example.com" }))},
+		{"ErrUnknownKey", sign("ES256", "ec2", claims(nil))},
+		{"ErrAlgorithm", sign("ES256", "rsa1", claims(nil))},
+		{"ErrSignature", tamper(sign("RS256", "rsa1", claims(nil)))},
+		{"ErrMalformed", "abc"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := authenticate(tt.token); dataflow.ErrorCode(err) != dataflow.EUNAUTHORIZED {
+				t.Fatalf("unexpected error: %#v", err)
+			}
+		})
+	}
+}
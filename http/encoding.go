@@ -0,0 +1,317 @@
+package http
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/narslan/pipeline"
+	"github.com/narslan/pipeline/http/productpb"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative productpb/product.proto
+
+// Encoder writes product responses in a media type.
+type Encoder interface {
+	// EncodeProduct writes a single product.
+	EncodeProduct(w io.Writer, p *dataflow.Product) error
+
+	// EncodeProductPage writes a page of products and the cursor of the next page.
+	// The cursor is empty on the last page.
+	EncodeProductPage(w io.Writer, ps []*dataflow.Product, next string) error
+}
+
+// batchEncoder is implemented by encoders, that write the missing IDs of a batch lookup
+// in the body. Other encoders write the products as a page.
+type batchEncoder interface {
+	// EncodeProductBatch writes the products found by a batch lookup and the IDs, that were not found.
+	EncodeProductBatch(w io.Writer, ps []*dataflow.Product, missing []uint32) error
+}
+
+// encoding represents a registered media type and its encoder.
+type encoding struct {
+	mediaType string
+
+	// Short name of the encoding, which tells the entity tags of its representations apart.
+	name    string
+	encoder Encoder
+}
+
+// projector is implemented by encoders, that write the selected fields of products,
+// rather than leaving out empty fields.
+type projector interface {
+	// Project returns an encoder, that writes only the given fields of products.
+	Project(fields []string) Encoder
+}
+
+// project returns the encoding for a projection of fields. Empty fields select all fields.
+func (enc encoding) project(fields []string) encoding {
+	if e, ok := enc.encoder.(projector); ok && fields != nil {
+		enc.encoder = e.Project(fields)
+	}
+	return enc
+}
+
+// encodings is the registry of response encoders. The first one is the default.
+var encodings = []encoding{
+	{"application/json", "", JSONEncoder{}},
+	{"application/msgpack", "msgpack", MsgpackEncoder{}},
+	{"application/vnd.msgpack", "msgpack", MsgpackEncoder{}},
+	{"application/x-msgpack", "msgpack", MsgpackEncoder{}},
+	{"application/protobuf", "protobuf", ProtobufEncoder{}},
+	{"application/x-protobuf", "protobuf", ProtobufEncoder{}},
+	{"text/csv", "csv", CSVEncoder{}},
+}
+
+// RegisterEncoder adds an encoder for a media type. The name tells the entity tags of
+// its representations apart, and must be unique. Encoders must be registered before
+// the server is opened.
+func RegisterEncoder(mediaType, name string, e Encoder) {
+	encodings = append(encodings, encoding{mediaType, name, e})
+}
+
+// negotiate picks the encoding of a response from the Accept header of the request.
+// Media ranges with a higher quality win. On a tie, the range listed first wins.
+// Returns ENOTACCEPTABLE if no registered media type is acceptable.
+func negotiate(r *http.Request) (encoding, error) {
+	accept := strings.Join(r.Header.Values("Accept"), ",")
+	if strings.TrimSpace(accept) == "" {
+		return encodings[0], nil
+	}
+
+	// Parse the media ranges of the header.
+	type mediaRange struct {
+		typ, subtype string
+		q            float64
+	}
+	var ranges []mediaRange
+	for _, v := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(v)
+		if err != nil {
+			continue
+		}
+		typ, subtype, _ := strings.Cut(mediaType, "/")
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil || q < 0 || q > 1 {
+				continue
+			}
+		}
+		ranges = append(ranges, mediaRange{typ, subtype, q})
+	}
+	if len(ranges) == 0 {
+		// Ignore a malformed header.
+		return encodings[0], nil
+	}
+
+	// The quality of an encoding is given by the most specific range, that matches it.
+	best, bestQ, bestIndex := -1, 0.0, 0
+	for i, enc := range encodings {
+		typ, subtype, _ := strings.Cut(enc.mediaType, "/")
+		q, index, specificity := 0.0, 0, -1
+		for j, rng := range ranges {
+			var s int
+			switch {
+			case rng.typ == typ && rng.subtype == subtype:
+				s = 2
+			case rng.typ == typ && rng.subtype == "*":
+				s = 1
+			case rng.typ == "*" && rng.subtype == "*":
+				s = 0
+			default:
+				continue
+			}
+			if s > specificity {
+				q, index, specificity = rng.q, j, s
+			}
+		}
+		if q > bestQ || (q > 0 && q == bestQ && index < bestIndex) {
+			best, bestQ, bestIndex = i, q, index
+		}
+	}
+	if best < 0 {
+		return encoding{}, dataflow.Errorf(dataflow.ENOTACCEPTABLE, "None of the accepted media types is supported")
+	}
+	return encodings[best], nil
+}
+
+// JSONEncoder writes products as JSON.
+type JSONEncoder struct{}
+
+// EncodeProduct writes a single product as a JSON object.
+func (JSONEncoder) EncodeProduct(w io.Writer, p *dataflow.Product) error {
+	return json.NewEncoder(w).Encode(p)
+}
+
+// EncodeProductPage writes a page of products as a JSON object.
+func (JSONEncoder) EncodeProductPage(w io.Writer, ps []*dataflow.Product, next string) error {
+	return json.NewEncoder(w).Encode(&listProductsResponse{Products: ps, Next: next})
+}
+
+// EncodeProductBatch writes the result of a batch lookup as a JSON object.
+func (JSONEncoder) EncodeProductBatch(w io.Writer, ps []*dataflow.Product, missing []uint32) error {
+	return json.NewEncoder(w).Encode(&batchGetProductsResponse{Products: ps, Missing: missing})
+}
+
+// MsgpackEncoder writes products as MessagePack. Products are maps with the keys of
+// their JSON form, and update times use the timestamp extension type.
+type MsgpackEncoder struct{}
+
+// EncodeProduct writes a single product as a MessagePack map.
+func (MsgpackEncoder) EncodeProduct(w io.Writer, p *dataflow.Product) error {
+	return newMsgpackEncoder(w).Encode(p)
+}
+
+// EncodeProductPage writes a page of products as a MessagePack map of the keys
+// "products" and, unless it is the last page, "next".
+func (MsgpackEncoder) EncodeProductPage(w io.Writer, ps []*dataflow.Product, next string) error {
+	return newMsgpackEncoder(w).Encode(&listProductsResponse{Products: ps, Next: next})
+}
+
+// EncodeProductBatch writes the result of a batch lookup as a MessagePack map of the keys
+// "products" and "missing".
+func (MsgpackEncoder) EncodeProductBatch(w io.Writer, ps []*dataflow.Product, missing []uint32) error {
+	return newMsgpackEncoder(w).Encode(&batchGetProductsResponse{Products: ps, Missing: missing})
+}
+
+// newMsgpackEncoder returns a MessagePack encoder, that falls back to the JSON keys of
+// struct fields and writes integers in their shortest form.
+func newMsgpackEncoder(w io.Writer) *msgpack.Encoder {
+	enc := msgpack.NewEncoder(w)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+	return enc
+}
+
+// ProtobufEncoder writes products as Protocol Buffers. The messages are described by
+// productpb/product.proto.
+type ProtobufEncoder struct{}
+
+// EncodeProduct writes a single product as a Product message.
+func (ProtobufEncoder) EncodeProduct(w io.Writer, p *dataflow.Product) error {
+	return writeProtobuf(w, protobufProduct(p))
+}
+
+// EncodeProductPage writes a page of products as a ProductPage message.
+func (ProtobufEncoder) EncodeProductPage(w io.Writer, ps []*dataflow.Product, next string) error {
+	return writeProtobuf(w, &productpb.ProductPage{Products: protobufProducts(ps), Next: next})
+}
+
+// EncodeProductBatch writes the result of a batch lookup as a ProductBatch message.
+func (ProtobufEncoder) EncodeProductBatch(w io.Writer, ps []*dataflow.Product, missing []uint32) error {
+	return writeProtobuf(w, &productpb.ProductBatch{Products: protobufProducts(ps), Missing: missing})
+}
+
+// writeProtobuf writes the wire format of a message.
+func writeProtobuf(w io.Writer, m proto.Message) error {
+	b, err := proto.Marshal(m)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// protobufProduct converts a product to its message.
+func protobufProduct(p *dataflow.Product) *productpb.Product {
+	m := &productpb.Product{
+		Id:          p.ID,
+		Title:       p.Title,
+		Price:       p.Price,
+		Category:    p.Category,
+		Brand:       p.Brand,
+		Url:         p.URL,
+		Description: p.Description,
+		Version:     p.Version,
+	}
+	if !p.UpdatedAt.IsZero() {
+		m.UpdatedAt = timestamppb.New(p.UpdatedAt)
+	}
+	return m
+}
+
+// protobufProducts converts products to their messages.
+func protobufProducts(ps []*dataflow.Product) []*productpb.Product {
+	ms := make([]*productpb.Product, len(ps))
+	for i, p := range ps {
+		ms[i] = protobufProduct(p)
+	}
+	return ms
+}
+
+// CSVEncoder writes products as CSV with a header row. CSV has no place for the cursor
+// of the next page or the missing IDs of a batch lookup, so they are only passed in the
+// X-Next-Cursor and X-Missing-IDs headers.
+type CSVEncoder struct {
+	// Columns of the rows in canonical order. Empty fields select all fields.
+	Fields []string
+}
+
+// Project returns an encoder, that writes only the columns of the given fields.
+func (CSVEncoder) Project(fields []string) Encoder {
+	return CSVEncoder{Fields: fields}
+}
+
+// EncodeProduct writes a single product as a CSV row.
+func (e CSVEncoder) EncodeProduct(w io.Writer, p *dataflow.Product) error {
+	return e.EncodeProductPage(w, []*dataflow.Product{p}, "")
+}
+
+// EncodeProductPage writes a page of products as CSV rows.
+func (e CSVEncoder) EncodeProductPage(w io.Writer, ps []*dataflow.Product, next string) error {
+	fields := e.Fields
+	if len(fields) == 0 {
+		fields = dataflow.ProductFields
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(fields); err != nil {
+		return err
+	}
+	record := make([]string, len(fields))
+	for _, p := range ps {
+		for i, f := range fields {
+			record[i] = csvValue(p, f)
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvValue returns the CSV value of a product field.
+func csvValue(p *dataflow.Product, field string) string {
+	switch field {
+	case "id":
+		return strconv.FormatUint(uint64(p.ID), 10)
+	case "title":
+		return p.Title
+	case "price":
+		return strconv.FormatFloat(float64(p.Price), 'f', -1, 32)
+	case "category":
+		return p.Category
+	case "brand":
+		return p.Brand
+	case "url":
+		return p.URL
+	case "description":
+		return p.Description
+	case "version":
+		return p.Version
+	case "updated_at":
+		if !p.UpdatedAt.IsZero() {
+			return p.UpdatedAt.UTC().Format(time.RFC3339Nano)
+		}
+	}
+	return ""
+}
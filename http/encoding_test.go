@@ -0,0 +1,295 @@
+package http_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/narslan/pipeline"
+	dataflowhttp "github.com/narslan/pipeline/http"
+	"github.com/narslan/pipeline/http/productpb"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+// Ensure the server picks the representation from the Accept header.
+func TestNegotiate(t *testing.T) {
+	// Start the mocked HTTP test server.
+	s := MustOpenServer(t)
+	defer MustCloseServer(t, s)
+
+	s.ProductService.FindProductByIDFn = func(ctx context.Context, id uint32, fields ...string) (*dataflow.Product, error) {
+		return &dataflow.Product{ID: 1, Title: "title1", Price: 1.5, Version: "3"}, nil
+	}
+	s.ProductService.ListProductsFn = func(ctx context.Context, filter dataflow.ProductFilter) ([]*dataflow.Product, string, error) {
+		return []*dataflow.Product{{ID: 1, Title: "title1", Price: 1.5}}, "abc", nil
+	}
+	s.ProductService.CreateProductFn = func(ctx context.Context, p *dataflow.Product) error {
+		p.Version = "3"
+		return nil
+	}
+	s.ProductService.UpdateProductFn = func(ctx context.Context, id uint32, upd dataflow.ProductUpdate) (*dataflow.Product, error) {
+		return &dataflow.Product{ID: id, Title: *upd.Title, Price: *upd.Price, Version: "3"}, nil
+	}
+
+	// Single products are negotiated for reads and writes, pages for lists.
+	body := `{"id": 1, "title": "title1", "price": 1.5}`
+	routes := []struct {
+		method, url, body string
+		status            int
+	}{
+		{"GET", "/product/1", "", http.StatusOK},
+		{"GET", "/products", "", http.StatusOK},
+		{"POST", "/products", body, http.StatusCreated},
+		{"PUT", "/product/1", body, http.StatusOK},
+	}
+
+	for _, tt := range []struct {
+		name   string
+		accept string
+		want   string
+		etag   string
+	}{
+		{"Default", "", "application/json", `"3"`},
+		{"Any", "*/*", "application/json", `"3"`},
+		{"Msgpack", "application/msgpack", "application/msgpack", `"3-msgpack"`},
+		{"MsgpackAlias", "application/x-msgpack", "application/x-msgpack", `"3-msgpack"`},
+		{"Protobuf", "application/x-protobuf", "application/x-protobuf", `"3-protobuf"`},
+		{"CSV", "text/*", "text/csv", `"3-csv"`},
+		{"Quality", "application/json;q=0.5, text/csv", "text/csv", `"3-csv"`},
+		{"Order", "application/protobuf, application/json", "application/protobuf", `"3-protobuf"`},
+		{"Excluded", "application/json;q=0, */*", "application/msgpack", `"3-msgpack"`},
+		{"Malformed", "//", "application/json", `"3"`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, rt := range routes {
+				req := s.MustNewRequest(t, context.TODO(), rt.method, rt.url, strings.NewReader(rt.body))
+				req.Header.Set("Accept", tt.accept)
+				resp, err := http.DefaultClient.Do(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp.Body.Close()
+
+				if got, want := resp.StatusCode, rt.status; got != want {
+					t.Fatalf("%s %s: StatusCode=%v, want %v", rt.method, rt.url, got, want)
+				} else if got := resp.Header.Get("Content-Type"); got != tt.want {
+					t.Fatalf("%s %s: Content-Type=%q, want %q", rt.method, rt.url, got, tt.want)
+				} else if got, want := resp.Header.Get("Vary"), "Accept"; got != want {
+					t.Fatalf("%s %s: Vary=%q, want %q", rt.method, rt.url, got, want)
+				} else if rt.method != "GET" && resp.Header.Get("ETag") != tt.etag {
+					t.Fatalf("%s %s: ETag=%q, want %q", rt.method, rt.url, resp.Header.Get("ETag"), tt.etag)
+				}
+			}
+		})
+
+		t.Run(tt.name+"ETag", func(t *testing.T) {
+			req := s.MustNewRequest(t, context.TODO(), "GET", "/product/1", nil)
+			req.Header.Set("Accept", tt.accept)
+			req.Header.Set("If-None-Match", tt.etag)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if got, want := resp.StatusCode, http.StatusNotModified; got != want {
+				t.Fatalf("StatusCode=%v, want %v", got, want)
+			} else if got := resp.Header.Get("ETag"); got != tt.etag {
+				t.Fatalf("ETag=%q, want %q", got, tt.etag)
+			}
+		})
+	}
+
+	// Ensure the cursor of the next page is passed in a header.
+	t.Run("NextCursor", func(t *testing.T) {
+		req := s.MustNewRequest(t, context.TODO(), "GET", "/products", nil)
+		req.Header.Set("Accept", "text/csv")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		if got, want := resp.Header.Get("X-Next-Cursor"), "abc"; got != want {
+			t.Fatalf("X-Next-Cursor=%q, want %q", got, want)
+		}
+	})
+
+	// Ensure an unsupported media type is rejected before the product is fetched or written.
+	t.Run("ErrNotAcceptable", func(t *testing.T) {
+		s.ProductService.FindProductByIDFn = func(ctx context.Context, id uint32, fields ...string) (*dataflow.Product, error) {
+			t.Fatal("unexpected fetch")
+			return nil, nil
+		}
+		s.ProductService.CreateProductFn = func(ctx context.Context, p *dataflow.Product) error {
+			t.Fatal("unexpected create")
+			return nil
+		}
+		s.ProductService.UpdateProductFn = func(ctx context.Context, id uint32, upd dataflow.ProductUpdate) (*dataflow.Product, error) {
+			t.Fatal("unexpected update")
+			return nil, nil
+		}
+
+		for _, rt := range []struct{ method, url, body string }{
+			{"GET", "/product/1", ""},
+			{"POST", "/products", body},
+			{"PUT", "/product/1", body},
+		} {
+			req := s.MustNewRequest(t, context.TODO(), rt.method, rt.url, strings.NewReader(rt.body))
+			req.Header.Set("Accept", "application/xml, application/json;q=0")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if got, want := resp.StatusCode, http.StatusNotAcceptable; got != want {
+				t.Fatalf("%s %s: StatusCode=%v, want %v", rt.method, rt.url, got, want)
+			}
+		}
+	})
+}
+
+// testProduct is a product with all fields set.
+var testProduct = &dataflow.Product{
+	ID:          300,
+	Title:       "title, \"quoted\"",
+	Price:       42.5,
+	Category:    "bilgisayar",
+	Brand:       "brand1",
+	URL:         "https://url1.com",
+	Description: "a description",
+	Version:     "b9ca9e6a-07ad-11ef-8000-000000000001",
+	UpdatedAt:   time.Date(2024, 5, 1, 12, 30, 0, 500_000_000, time.UTC),
+}
+
+// Ensure products are written as MessagePack maps.
+func TestMsgpackEncoder(t *testing.T) {
+	t.Run("Product", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := (dataflowhttp.MsgpackEncoder{}).EncodeProduct(&buf, &dataflow.Product{ID: 300, Title: "t", Price: 1.5}); err != nil {
+			t.Fatal(err)
+		}
+
+		want := []byte{
+			0x83,
+			0xa2, 'i', 'd', 0xcd, 0x01, 0x2c,
+			0xa5, 't', 'i', 't', 'l', 'e', 0xa1, 't',
+			0xa5, 'p', 'r', 'i', 'c', 'e', 0xca, 0x3f, 0xc0, 0x00, 0x00,
+		}
+		if got := buf.Bytes(); !bytes.Equal(got, want) {
+			t.Fatalf("unexpected encoding: %x, want %x", got, want)
+		}
+	})
+
+	t.Run("Page", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := (dataflowhttp.MsgpackEncoder{}).EncodeProductPage(&buf, []*dataflow.Product{{ID: 1}}, "n"); err != nil {
+			t.Fatal(err)
+		}
+
+		want := []byte{
+			0x82,
+			0xa8, 'p', 'r', 'o', 'd', 'u', 'c', 't', 's', 0x91, 0x81, 0xa2, 'i', 'd', 0x01,
+			0xa4, 'n', 'e', 'x', 't', 0xa1, 'n',
+		}
+		if got := buf.Bytes(); !bytes.Equal(got, want) {
+			t.Fatalf("unexpected encoding: %x, want %x", got, want)
+		}
+	})
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := (dataflowhttp.MsgpackEncoder{}).EncodeProduct(&buf, testProduct); err != nil {
+			t.Fatal(err)
+		}
+
+		dec := msgpack.NewDecoder(&buf)
+		dec.SetCustomStructTag("json")
+		var p dataflow.Product
+		if err := dec.Decode(&p); err != nil {
+			t.Fatal(err)
+		}
+		p.UpdatedAt = p.UpdatedAt.UTC()
+		if !reflect.DeepEqual(&p, testProduct) {
+			t.Fatalf("mismatch: %#v != %#v", &p, testProduct)
+		}
+	})
+}
+
+// Ensure products are written as Product messages.
+func TestProtobufEncoder(t *testing.T) {
+	t.Run("Page", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := (dataflowhttp.ProtobufEncoder{}).EncodeProductPage(&buf, []*dataflow.Product{testProduct}, "abc"); err != nil {
+			t.Fatal(err)
+		}
+
+		var page productpb.ProductPage
+		if err := proto.Unmarshal(buf.Bytes(), &page); err != nil {
+			t.Fatal(err)
+		} else if len(page.Products) != 1 || page.Next != "abc" {
+			t.Fatalf("unexpected page: %d products, next=%q", len(page.Products), page.Next)
+		}
+
+		m := page.Products[0]
+		p := &dataflow.Product{
+			ID:          m.Id,
+			Title:       m.Title,
+			Price:       m.Price,
+			Category:    m.Category,
+			Brand:       m.Brand,
+			URL:         m.Url,
+			Description: m.Description,
+			Version:     m.Version,
+			UpdatedAt:   m.UpdatedAt.AsTime(),
+		}
+		if !reflect.DeepEqual(p, testProduct) {
+			t.Fatalf("mismatch: %#v != %#v", p, testProduct)
+		}
+	})
+
+	t.Run("Batch", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := (dataflowhttp.ProtobufEncoder{}).EncodeProductBatch(&buf, []*dataflow.Product{{ID: 1}}, []uint32{2, 3}); err != nil {
+			t.Fatal(err)
+		}
+
+		var batch productpb.ProductBatch
+		if err := proto.Unmarshal(buf.Bytes(), &batch); err != nil {
+			t.Fatal(err)
+		} else if len(batch.Products) != 1 || batch.Products[0].Id != 1 {
+			t.Fatalf("unexpected products: %v", batch.Products)
+		} else if want := []uint32{2, 3}; !reflect.DeepEqual(batch.Missing, want) {
+			t.Fatalf("missing=%v, want %v", batch.Missing, want)
+		} else if batch.Products[0].UpdatedAt != nil {
+			t.Fatalf("unexpected update time: %v", batch.Products[0].UpdatedAt)
+		}
+	})
+}
+
+// Ensure products are written as CSV rows with a header.
+func TestCSVEncoder(t *testing.T) {
+	var buf bytes.Buffer
+	if err := (dataflowhttp.CSVEncoder{}).EncodeProduct(&buf, testProduct); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"id", "title", "price", "category", "brand", "url", "description", "version", "updated_at"},
+		{"300", "title, \"quoted\"", "42.5", "bilgisayar", "brand1", "https://url1.com", "a description", "b9ca9e6a-07ad-11ef-8000-000000000001", "2024-05-01T12:30:00.5Z"},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Fatalf("mismatch: %q != %q", records, want)
+	}
+}
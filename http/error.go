@@ -1,8 +1,9 @@
 package http
 
 import (
+	"cmp"
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
 
 	"github.com/narslan/pipeline"
@@ -23,7 +24,7 @@ func Error(w http.ResponseWriter, r *http.Request, err error) {
 	w.WriteHeader(ErrorStatusCode(code))
 
 	if err := json.NewEncoder(w).Encode(&ErrorResponse{Error: message}); err != nil {
-		log.Println("failed to send reposnse:", err)
+		logger(r).Error("failed to send response", "error", err)
 	}
 
 }
@@ -33,17 +34,31 @@ type ErrorResponse struct {
 	Error string `json:"error"`
 }
 
-// LogError logs an error with the HTTP route information.
+// LogError logs an error with the HTTP route information and the ID of the request.
 func LogError(r *http.Request, err error) {
-	log.Printf("[http] error: %s %s: %s", r.Method, r.URL.Path, err)
+	attrs := []any{"method", r.Method, "path", r.URL.Path, "error", err}
+	if id := r.PathValue("id"); id != "" {
+		attrs = append(attrs, "product_id", id)
+	}
+	logger(r).Error("request failed", attrs...)
+}
+
+// logger returns the logger of a request, which carries its ID.
+// Requests, that are not routed by the server, use the default logger.
+func logger(r *http.Request) *slog.Logger {
+	return cmp.Or(dataflow.LoggerFromContext(r.Context()), slog.Default())
 }
 
 // lookup of application error codes to HTTP status codes.
 var codes = map[string]int{
-
-	dataflow.EINVALID:  http.StatusBadRequest,
-	dataflow.ENOTFOUND: http.StatusNotFound,
-	dataflow.EINTERNAL: http.StatusInternalServerError,
+	dataflow.ECONFLICT:        http.StatusConflict,
+	dataflow.EINTERNAL:        http.StatusInternalServerError,
+	dataflow.EINVALID:         http.StatusBadRequest,
+	dataflow.ENOTFOUND:        http.StatusNotFound,
+	dataflow.EUNAUTHORIZED:    http.StatusUnauthorized,
+	dataflow.EFORBIDDEN:       http.StatusForbidden,
+	dataflow.ETOOMANYREQUESTS: http.StatusTooManyRequests,
+	dataflow.ENOTACCEPTABLE:   http.StatusNotAcceptable,
 }
 
 // ErrorStatusCode returns the associated HTTP status code for a dataflow error code.
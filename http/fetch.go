@@ -0,0 +1,127 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/narslan/pipeline"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Ensure that FetchService implements the fetch interfaces.
+var _ dataflow.Fetch = (*FetchService)(nil)
+var _ dataflow.StreamFetch = (*FetchService)(nil)
+var _ dataflow.StatFetch = (*FetchService)(nil)
+var _ dataflow.RangeFetch = (*FetchService)(nil)
+
+// FetchService represents a fetcher for http:// and https:// sources.
+type FetchService struct {
+	// Client used for requests. http.DefaultClient is used if it is nil.
+	Client *http.Client
+}
+
+// NewFetchService returns a new instance of FetchService.
+func NewFetchService() *FetchService {
+	return &FetchService{}
+}
+
+// Get method downloads the resource at url.
+func (s *FetchService) Get(ctx context.Context, url string) ([]byte, error) {
+	body, err := s.Open(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
+
+// Open method returns the body of the resource at url as a stream.
+func (s *FetchService) Open(ctx context.Context, url string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &body{ReadCloser: resp.Body, encoding: resp.Header.Get("Content-Encoding")}, nil
+}
+
+// OpenAt method returns the body of the resource at url, starting at the given byte offset.
+// If the server ignores the range request, the leading bytes are skipped on the client.
+func (s *FetchService) OpenAt(ctx context.Context, url string, offset int64) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, url, http.Header{"Range": {fmt.Sprintf("bytes=%d-", offset)}})
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusPartialContent {
+		if _, err := io.CopyN(io.Discard, resp.Body, offset); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+	}
+	return &body{ReadCloser: resp.Body, encoding: resp.Header.Get("Content-Encoding")}, nil
+}
+
+// body represents a response body together with its Content-Encoding.
+// The transport removes the header, if it decompresses the body by itself.
+type body struct {
+	io.ReadCloser
+	encoding string
+}
+
+// ContentEncoding implements dataflow.EncodedReader.
+func (b *body) ContentEncoding() string {
+	return b.encoding
+}
+
+// Stat method retrieves the ETag and the size of the resource at url.
+func (s *FetchService) Stat(ctx context.Context, url string) (*dataflow.ObjectInfo, error) {
+	resp, err := s.do(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	// Fall back to Last-Modified, if the server sends no ETag.
+	etag := resp.Header.Get("ETag")
+	if etag == "" {
+		etag = resp.Header.Get("Last-Modified")
+	}
+
+	size, _ := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+	return &dataflow.ObjectInfo{Key: url, ETag: etag, Size: size}, nil
+}
+
+// do sends a request and converts unsuccessful responses to application errors.
+func (s *FetchService) do(ctx context.Context, method, url string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, dataflow.Errorf(dataflow.EINVALID, "invalid url %q: %v", url, err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	// Pass the trace context on to the server of the source.
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		code := FromErrorStatusCode(resp.StatusCode)
+		return nil, dataflow.Errorf(code, "%s %s: %s", method, url, resp.Status)
+	}
+	return resp, nil
+}
@@ -0,0 +1,78 @@
+package http_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	dataflow "github.com/narslan/pipeline"
+	dataflowhttp "github.com/narslan/pipeline/http"
+)
+
+func TestFetchService_Open(t *testing.T) {
+	content := "line1\nline2\n"
+
+	// Serve the content with support for range requests.
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/products-1.jsonl" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "products-1.jsonl", time.Time{}, strings.NewReader(content))
+	}))
+	defer ts.Close()
+
+	s := dataflowhttp.NewFetchService()
+
+	// Ensure the body is streamed.
+	t.Run("OK", func(t *testing.T) {
+		body, err := s.Open(context.Background(), ts.URL+"/products-1.jsonl")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer body.Close()
+
+		if got, err := io.ReadAll(body); err != nil {
+			t.Fatal(err)
+		} else if string(got) != content {
+			t.Fatalf("content mismatch: %q", got)
+		}
+	})
+
+	// Ensure the body can start at an offset.
+	t.Run("OpenAt", func(t *testing.T) {
+		body, err := s.OpenAt(context.Background(), ts.URL+"/products-1.jsonl", 6)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer body.Close()
+
+		if got, err := io.ReadAll(body); err != nil {
+			t.Fatal(err)
+		} else if string(got) != "line2\n" {
+			t.Fatalf("content mismatch: %q", got)
+		}
+	})
+
+	// Ensure metadata is reported.
+	t.Run("Stat", func(t *testing.T) {
+		info, err := s.Stat(context.Background(), ts.URL+"/products-1.jsonl")
+		if err != nil {
+			t.Fatal(err)
+		} else if info.ETag != `"v1"` || info.Size != int64(len(content)) {
+			t.Fatalf("unexpected info: %#v", info)
+		}
+	})
+
+	// Ensure a missing resource returns ENOTFOUND.
+	t.Run("ErrNotFound", func(t *testing.T) {
+		if _, err := s.Open(context.Background(), ts.URL+"/missing.jsonl"); dataflow.ErrorCode(err) != dataflow.ENOTFOUND {
+			t.Fatalf("unexpected error: %#v", err)
+		}
+	})
+}
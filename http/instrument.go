@@ -0,0 +1,142 @@
+package http
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/narslan/pipeline"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer records the spans of requests.
+var tracer = otel.Tracer("github.com/narslan/pipeline/http")
+
+// Metrics of the HTTP routes, by method, route pattern and status code.
+var (
+	requestCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dataflow_http_requests_total",
+		Help: "Total number of HTTP requests by route and status code.",
+	}, []string{"method", "route", "code"})
+
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "dataflow_http_request_duration_seconds",
+		Help:    "Latency of HTTP requests by route and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "code"})
+)
+
+// RequestIDHeader is the header of the request ID. The ID of the client is kept, if it is valid.
+// Otherwise a new one is generated. It is returned in the response.
+const RequestIDHeader = "X-Request-ID"
+
+// instrument wraps the handler of a route, so that its requests are counted, timed, traced and logged.
+// Requests, that are rejected by authorization or rate limiting, are counted as well.
+// The span of a request continues the W3C trace context of the client. The span and a logger
+// with the request ID are passed on to the services in the context.
+func (s *Server) instrument(pattern string, h http.HandlerFunc) http.HandlerFunc {
+	method, route, ok := strings.Cut(pattern, " ")
+	if !ok {
+		method, route = "", pattern
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, pattern,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPRequestMethodKey.String(r.Method), semconv.HTTPRoute(route)),
+		)
+		defer span.End()
+
+		// Tag the logs of the request with its ID and trace.
+		id := requestID(r)
+		w.Header().Set(RequestIDHeader, id)
+		logger := s.logger().With(slog.String("request_id", id))
+		if sc := span.SpanContext(); sc.IsValid() {
+			logger = logger.With(slog.String("trace_id", sc.TraceID().String()))
+		}
+		ctx = dataflow.NewContextWithLogger(ctx, logger)
+
+		sw := &statusWriter{ResponseWriter: w, code: http.StatusOK}
+		h(sw, r.WithContext(ctx))
+
+		span.SetAttributes(semconv.HTTPResponseStatusCode(sw.code))
+		if sw.code >= http.StatusInternalServerError {
+			span.SetStatus(otelcodes.Error, http.StatusText(sw.code))
+		}
+
+		elapsed := time.Since(start)
+		code := strconv.Itoa(sw.code)
+		requestCount.WithLabelValues(method, route, code).Inc()
+		requestDuration.WithLabelValues(method, route, code).Observe(elapsed.Seconds())
+
+		logger.LogAttrs(ctx, slog.LevelInfo, "request",
+			slog.String("method", r.Method),
+			slog.String("route", route),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", sw.code),
+			slog.Float64("duration_ms", float64(elapsed)/float64(time.Millisecond)),
+		)
+	}
+}
+
+// requestID returns the ID of the request, as passed by the client. A new ID is generated,
+// if the client passed none or it is longer than 128 characters or holds other characters
+// than letters, digits, '-', '_', '.' and ':'.
+func requestID(r *http.Request) string {
+	if id := r.Header.Get(RequestIDHeader); id != "" && len(id) <= 128 && strings.Trim(id, idChars) == "" {
+		return id
+	}
+	var buf [16]byte
+	rand.Read(buf[:])
+	return hex.EncodeToString(buf[:])
+}
+
+// idChars are the characters of valid request IDs.
+const idChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_.:"
+
+// statusWriter records the status code of a response.
+type statusWriter struct {
+	http.ResponseWriter
+	code  int
+	wrote bool
+}
+
+// WriteHeader records the status code and writes it.
+func (w *statusWriter) WriteHeader(code int) {
+	if !w.wrote {
+		w.code, w.wrote = code, true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write writes the implicit status code on the first write.
+func (w *statusWriter) Write(p []byte) (int, error) {
+	w.wrote = true
+	return w.ResponseWriter.Write(p)
+}
+
+// Unwrap returns the underlying writer for http.ResponseController.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// ListenAndServeMetrics runs an HTTP server, that serves the metrics of the process on /metrics.
+// It is used by programs, that have no HTTP server of their own.
+func ListenAndServeMetrics(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", promhttp.Handler())
+	return http.ListenAndServe(addr, mux)
+}
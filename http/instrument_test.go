@@ -0,0 +1,227 @@
+package http_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/narslan/pipeline"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Ensure requests are counted by route and status code, and exposed on /metrics.
+func TestMetrics(t *testing.T) {
+	// Start the mocked HTTP test server.
+	s := MustOpenServer(t)
+	defer MustCloseServer(t, s)
+
+	s.ProductService.FindProductByIDFn = func(ctx context.Context, id uint32, fields ...string) (*dataflow.Product, error) {
+		if id != 1 {
+			return nil, dataflow.Errorf(dataflow.ENOTFOUND, "Product not found")
+		}
+		return &dataflow.Product{ID: id}, nil
+	}
+
+	// Serve a product and a missing one.
+	for _, path := range []string{"/product/1", "/product/2"} {
+		resp, err := http.DefaultClient.Do(s.MustNewRequest(t, context.Background(), "GET", path, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	resp, err := http.DefaultClient.Do(s.MustNewRequest(t, context.Background(), "GET", "/metrics", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("StatusCode=%v, want %v", resp.StatusCode, http.StatusOK)
+	}
+	buf, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		`dataflow_http_requests_total{code="200",method="GET",route="/product/{id}"}`,
+		`dataflow_http_requests_total{code="404",method="GET",route="/product/{id}"}`,
+		`dataflow_http_request_duration_seconds_count{code="200",method="GET",route="/product/{id}"}`,
+	} {
+		if !strings.Contains(string(buf), want) {
+			t.Fatalf("metrics lack %s", want)
+		}
+	}
+}
+
+// Ensure requests are traced and continue the W3C trace context of the client.
+func TestTracing(t *testing.T) {
+	rec := MustRecordSpans(t)
+
+	// Start the mocked HTTP test server.
+	s := MustOpenServer(t)
+	defer MustCloseServer(t, s)
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	parentID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+
+	s.ProductService.FindProductByIDFn = func(ctx context.Context, id uint32, fields ...string) (*dataflow.Product, error) {
+		// The trace context is passed on to the product service.
+		if got := trace.SpanContextFromContext(ctx).TraceID(); got != traceID {
+			t.Fatalf("TraceID=%s, want %s", got, traceID)
+		}
+		return &dataflow.Product{ID: id}, nil
+	}
+
+	req := s.MustNewRequest(t, context.Background(), "GET", "/product/1", nil)
+	req.Header.Set("traceparent", "00-"+traceID.String()+"-"+parentID.String()+"-01")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	// The span ends after the response is sent, so wait for it.
+	var span sdktrace.ReadOnlySpan
+	for i := 0; span == nil && i < 100; i++ {
+		for _, s := range rec.Ended() {
+			if s.SpanContext().TraceID() == traceID {
+				span = s
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if span == nil {
+		t.Fatal("request not traced")
+	} else if span.Name() != "GET /product/{id}" {
+		t.Fatalf("Name=%q, want %q", span.Name(), "GET /product/{id}")
+	} else if span.Parent().SpanID() != parentID {
+		t.Fatalf("Parent=%s, want %s", span.Parent().SpanID(), parentID)
+	} else if span.SpanKind() != trace.SpanKindServer {
+		t.Fatalf("SpanKind=%s, want server", span.SpanKind())
+	}
+	for _, attr := range span.Attributes() {
+		if attr.Key == "http.response.status_code" && attr.Value.AsInt64() != http.StatusOK {
+			t.Fatalf("status code=%d, want %d", attr.Value.AsInt64(), http.StatusOK)
+		}
+	}
+}
+
+var (
+	spanRecorder *tracetest.SpanRecorder
+	recordOnce   sync.Once
+)
+
+// MustRecordSpans installs a global tracer provider, that records all spans, and
+// propagates the W3C trace context. The global provider can only be installed once,
+// so all tests share the recorder.
+func MustRecordSpans(tb testing.TB) *tracetest.SpanRecorder {
+	tb.Helper()
+	recordOnce.Do(func() {
+		spanRecorder = tracetest.NewSpanRecorder()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spanRecorder)))
+		otel.SetTextMapPropagator(propagation.TraceContext{})
+	})
+	return spanRecorder
+}
+
+// Ensure each request has an ID, that is returned to the client and tags the logs of the request.
+func TestRequestID(t *testing.T) {
+	// Start the mocked HTTP test server.
+	s := MustOpenServer(t)
+	defer MustCloseServer(t, s)
+
+	var buf syncBuffer
+	s.Logger = slog.New(slog.NewJSONHandler(&buf, nil))
+
+	s.ProductService.FindProductByIDFn = func(ctx context.Context, id uint32, fields ...string) (*dataflow.Product, error) {
+		// The logger of the request is passed on to the product service.
+		if l := dataflow.LoggerFromContext(ctx); l == nil {
+			t.Fatal("expected logger in context")
+		} else {
+			l.Info("lookup", "product_id", id)
+		}
+		return &dataflow.Product{ID: id}, nil
+	}
+
+	// Ensure the ID of the client is kept.
+	t.Run("OK", func(t *testing.T) {
+		req := s.MustNewRequest(t, context.Background(), "GET", "/product/1", nil)
+		req.Header.Set("X-Request-ID", "abc-123")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if got := resp.Header.Get("X-Request-ID"); got != "abc-123" {
+			t.Fatalf("X-Request-ID=%q, want %q", got, "abc-123")
+		}
+
+		// Find the log of the product service.
+		dec := json.NewDecoder(strings.NewReader(buf.String()))
+		for {
+			var rec struct {
+				Msg       string `json:"msg"`
+				RequestID string `json:"request_id"`
+				ProductID uint32 `json:"product_id"`
+			}
+			if err := dec.Decode(&rec); err == io.EOF {
+				t.Fatal("lookup not logged")
+			} else if err != nil {
+				t.Fatal(err)
+			} else if rec.Msg == "lookup" {
+				if rec.RequestID != "abc-123" || rec.ProductID != 1 {
+					t.Fatalf("unexpected log: %#v", rec)
+				}
+				break
+			}
+		}
+	})
+
+	// Ensure an ID is generated, if the ID of the client is not valid.
+	t.Run("Generated", func(t *testing.T) {
+		req := s.MustNewRequest(t, context.Background(), "GET", "/product/1", nil)
+		req.Header.Set("X-Request-ID", "bad id")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if got := resp.Header.Get("X-Request-ID"); len(got) != 32 {
+			t.Fatalf("unexpected X-Request-ID: %q", got)
+		}
+	})
+}
+
+// syncBuffer is a buffer, that is safe for concurrent use by the server and the test.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
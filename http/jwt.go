@@ -0,0 +1,253 @@
+package http
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/narslan/pipeline"
+)
+
+// JWTLeeway is the tolerance of the expiry and activation time of tokens.
+const JWTLeeway = time.Minute
+
+// JWTAuthenticator authenticates requests by JSON Web Tokens, that are passed in the
+// Authorization header with the Bearer scheme. Tokens are verified against the public keys of
+// a JSON Web Key Set. RS256 and ES256 signatures are supported. The scopes of the principal
+// are taken from the space-separated scope claim.
+type JWTAuthenticator struct {
+	// Public keys by key ID.
+	keys map[string]crypto.PublicKey
+
+	// Audience, that tokens must be issued for, like the domain of the service.
+	// Empty accepts any audience.
+	Audience string
+
+	// Issuer of tokens. Empty accepts any issuer.
+	Issuer string
+
+	// Returns the current time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// NewJWTAuthenticator returns a new instance of JWTAuthenticator without keys.
+func NewJWTAuthenticator() *JWTAuthenticator {
+	return &JWTAuthenticator{
+		keys: make(map[string]crypto.PublicKey),
+		Now:  time.Now,
+	}
+}
+
+// jwk represents a public key of a JSON Web Key Set.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+
+	// RSA keys.
+	N string `json:"n"`
+	E string `json:"e"`
+
+	// EC keys.
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// LoadJWKS adds the public keys of a JSON Web Key Set file. Keys, that are not
+// for signatures, are skipped.
+func (a *JWTAuthenticator) LoadJWKS(path string) error {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(buf, &set); err != nil {
+		return fmt.Errorf("jwks %s: %w", path, err)
+	}
+
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			return fmt.Errorf("jwks %s: key %q: %w", path, k.Kid, err)
+		}
+		a.keys[k.Kid] = pub
+	}
+	return nil
+}
+
+// publicKey decodes the public key of a JWK.
+func (k *jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		} else if len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("invalid exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve: %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, fmt.Errorf("point is not on curve")
+		}
+		return pub, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported key type: %s", k.Kty)
+	}
+}
+
+// Scheme returns the Bearer scheme.
+func (a *JWTAuthenticator) Scheme() string {
+	return "Bearer"
+}
+
+// jwtClaims represents the registered claims of a token and its scopes.
+type jwtClaims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss"`
+	Audience  audience `json:"aud"`
+	ExpiresAt *float64 `json:"exp"`
+	NotBefore *float64 `json:"nbf"`
+	Scope     string   `json:"scope"`
+}
+
+// audience represents the aud claim, which is a single string or an array of strings.
+type audience []string
+
+// UnmarshalJSON decodes a string or an array of strings.
+func (a *audience) UnmarshalJSON(buf []byte) error {
+	var s string
+	if err := json.Unmarshal(buf, &s); err == nil {
+		*a = audience{s}
+		return nil
+	}
+	return json.Unmarshal(buf, (*[]string)(a))
+}
+
+// Authenticate returns the principal of the bearer token of the request.
+// Returns EUNAUTHORIZED if the token is malformed, its signature does not match a key,
+// it is expired or not yet valid, or it is issued by another issuer or for another audience.
+func (a *JWTAuthenticator) Authenticate(r *http.Request) (*dataflow.Principal, error) {
+	token, ok := credential(r, a.Scheme())
+	if !ok {
+		return nil, nil
+	}
+
+	claims, err := a.verify(token)
+	if err != nil {
+		return nil, dataflow.Errorf(dataflow.EUNAUTHORIZED, "Invalid token: %s", err)
+	}
+
+	// Validate the claims.
+	now := a.Now()
+	switch {
+	case claims.ExpiresAt == nil:
+		return nil, dataflow.Errorf(dataflow.EUNAUTHORIZED, "Invalid token: missing expiry")
+	case now.After(time.Unix(int64(*claims.ExpiresAt), 0).Add(JWTLeeway)):
+		return nil, dataflow.Errorf(dataflow.EUNAUTHORIZED, "Invalid token: expired")
+	case claims.NotBefore != nil && now.Before(time.Unix(int64(*claims.NotBefore), 0).Add(-JWTLeeway)):
+		return nil, dataflow.Errorf(dataflow.EUNAUTHORIZED, "Invalid token: not valid yet")
+	case a.Issuer != "" && claims.Issuer != a.Issuer:
+		return nil, dataflow.Errorf(dataflow.EUNAUTHORIZED, "Invalid token: unexpected issuer")
+	case a.Audience != "" && !slices.Contains(claims.Audience, a.Audience):
+		return nil, dataflow.Errorf(dataflow.EUNAUTHORIZED, "Invalid token: unexpected audience")
+	}
+
+	return &dataflow.Principal{Subject: claims.Subject, Scopes: strings.Fields(claims.Scope)}, nil
+}
+
+// verify checks the signature of a token and returns its claims.
+func (a *JWTAuthenticator) verify(token string) (*jwtClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed")
+	}
+
+	// Decode the header and look up the key.
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if buf, err := base64.RawURLEncoding.DecodeString(parts[0]); err != nil {
+		return nil, fmt.Errorf("malformed header")
+	} else if err := json.Unmarshal(buf, &header); err != nil {
+		return nil, fmt.Errorf("malformed header")
+	}
+	key, ok := a.keys[header.Kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key")
+	}
+
+	// Verify the signature of the header and payload. The algorithm must match the type
+	// of the key, so a token can not pick a weaker algorithm.
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed signature")
+	}
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if header.Alg != "RS256" {
+			return nil, fmt.Errorf("unexpected algorithm: %s", header.Alg)
+		} else if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], sig); err != nil {
+			return nil, fmt.Errorf("invalid signature")
+		}
+	case *ecdsa.PublicKey:
+		if header.Alg != "ES256" {
+			return nil, fmt.Errorf("unexpected algorithm: %s", header.Alg)
+		} else if len(sig) != 64 {
+			return nil, fmt.Errorf("invalid signature")
+		}
+		r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(key, hash[:], r, s) {
+			return nil, fmt.Errorf("invalid signature")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported key")
+	}
+
+	// Decode the claims.
+	var claims jwtClaims
+	if buf, err := base64.RawURLEncoding.DecodeString(parts[1]); err != nil {
+		return nil, fmt.Errorf("malformed payload")
+	} else if err := json.Unmarshal(buf, &claims); err != nil {
+		return nil, fmt.Errorf("malformed payload")
+	}
+	return &claims, nil
+}
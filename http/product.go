@@ -3,35 +3,451 @@ package http
 import (
 	"encoding/json"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/narslan/pipeline"
 )
 
+// MaxBodySize is the maximum size of a request body.
+const MaxBodySize = 1 << 20
+
+// parseID parses the product ID from the path.
+func parseID(r *http.Request) (uint32, error) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		return 0, dataflow.Errorf(dataflow.EINVALID, "Invalid ID format")
+	}
+	return uint32(id), nil
+}
+
+// parseFields parses the comma-separated projection of the fields query parameter.
+// The fields are returned in canonical order. It returns nil, if no fields are given.
+func parseFields(r *http.Request) ([]string, error) {
+	var fields []string
+	for _, f := range strings.Split(r.URL.Query().Get("fields"), ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			fields = append(fields, f)
+		}
+	}
+	if fields == nil {
+		return nil, nil
+	}
+	return dataflow.NormalizeProductFields(fields)
+}
+
+// decode parses the JSON body of a request into v. Unknown fields are rejected.
+func decode(w http.ResponseWriter, r *http.Request, v any) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxBodySize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return dataflow.Errorf(dataflow.EINVALID, "Invalid JSON body")
+	}
+	return nil
+}
+
 func (s *Server) getProductById(w http.ResponseWriter, r *http.Request) {
 
 	// Parse ID from path.
-	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	id, err := parseID(r)
+	if err != nil {
+		Error(w, r, err)
+		return
+	}
+
+	// Parse the projection from the query string.
+	fields, err := parseFields(r)
 	if err != nil {
-		Error(w, r, dataflow.Errorf(dataflow.EINVALID, "Invalid ID format"))
+		Error(w, r, err)
 		return
 	}
 
-	// Fetch product from the database.
-	p, err := s.ProductService.FindProductByID(r.Context(), uint32(id))
+	// Pick the representation before the product is fetched.
+	enc, err := negotiate(r)
 	if err != nil {
 		Error(w, r, err)
 		return
 	}
+	enc = enc.project(fields)
+
+	// Fetch product from the database. A projection also reads the validators.
+	var read []string
+	if fields != nil {
+		read = slices.Concat(fields, []string{"version", "updated_at"})
+	}
+	p, err := s.ProductService.FindProductByID(r.Context(), id, read...)
+	if err != nil {
+		Error(w, r, err)
+		return
+	}
+
+	// Skip the body, if the client has the current representation.
+	name := representation(enc, fields)
+	w.Header().Set("Vary", "Accept")
+	setValidators(w, p, name)
+	if notModified(r, p, name) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
 
 	// Provide content type in response header.
-	w.Header().Set("Content-Type", "aplication/json")
+	w.Header().Set("Content-Type", enc.mediaType)
+
+	// Encode the model in the negotiated media type.
+	if err := enc.encoder.EncodeProduct(w, p.Project(fields)); err != nil {
+		LogError(r, err)
+		return
+	}
+}
+
+// listProductsResponse represents the output of the product listing.
+type listProductsResponse struct {
+	Products []*dataflow.Product `json:"products"`
+
+	// Cursor of the next page. It is empty on the last page.
+	Next string `json:"next,omitempty"`
+}
+
+func (s *Server) listProducts(w http.ResponseWriter, r *http.Request) {
+
+	// Parse the filter from the query string.
+	filter := dataflow.ProductFilter{
+		Category: r.URL.Query().Get("category"),
+		Brand:    r.URL.Query().Get("brand"),
+		Cursor:   r.URL.Query().Get("cursor"),
+	}
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			Error(w, r, dataflow.Errorf(dataflow.EINVALID, "Invalid limit format"))
+			return
+		}
+		filter.Limit = limit
+	}
+	fields, err := parseFields(r)
+	if err != nil {
+		Error(w, r, err)
+		return
+	}
+	filter.Fields = fields
+
+	// Pick the representation before the page is fetched.
+	enc, err := negotiate(r)
+	if err != nil {
+		Error(w, r, err)
+		return
+	}
+	enc = enc.project(fields)
+
+	// Fetch a page of products from the database.
+	ps, next, err := s.ProductService.ListProducts(r.Context(), filter)
+	if err != nil {
+		Error(w, r, err)
+		return
+	}
+
+	// Provide content type and the cursor of the next page in response header.
+	w.Header().Set("Vary", "Accept")
+	w.Header().Set("Content-Type", enc.mediaType)
+	if next != "" {
+		w.Header().Set("X-Next-Cursor", next)
+	}
+
+	// Encode the page in the negotiated media type.
+	if err := enc.encoder.EncodeProductPage(w, ps, next); err != nil {
+		LogError(r, err)
+		return
+	}
+}
+
+// MaxBatchGetIDs is the maximum number of IDs of a batch lookup.
+const MaxBatchGetIDs = 100
+
+// batchGetProductsRequest represents the input of the batch lookup.
+type batchGetProductsRequest struct {
+	IDs []uint32 `json:"ids"`
+}
+
+// batchGetProductsResponse represents the output of the batch lookup.
+type batchGetProductsResponse struct {
+	Products []*dataflow.Product `json:"products"`
+
+	// IDs of the requested products, that do not exist.
+	Missing []uint32 `json:"missing"`
+}
+
+func (s *Server) batchGetProducts(w http.ResponseWriter, r *http.Request) {
+
+	// Parse the projection from the query string.
+	fields, err := parseFields(r)
+	if err != nil {
+		Error(w, r, err)
+		return
+	}
+
+	// Pick the representation before the products are fetched.
+	enc, err := negotiate(r)
+	if err != nil {
+		Error(w, r, err)
+		return
+	}
+	enc = enc.project(fields)
+
+	// Parse the IDs from the body.
+	var req batchGetProductsRequest
+	if err := decode(w, r, &req); err != nil {
+		Error(w, r, err)
+		return
+	} else if len(req.IDs) > MaxBatchGetIDs {
+		Error(w, r, dataflow.Errorf(dataflow.EINVALID, "Number of IDs must not exceed %d", MaxBatchGetIDs))
+		return
+	}
+
+	// Look up each ID once, in the order of the request.
+	ids := make([]uint32, 0, len(req.IDs))
+	for _, id := range req.IDs {
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+
+	// Fetch products from the database.
+	ps, err := s.ProductService.FindProductsByIDs(r.Context(), ids, fields...)
+	if err != nil {
+		Error(w, r, err)
+		return
+	}
+
+	// Collect the IDs, that were not found.
+	found := make(map[uint32]bool, len(ps))
+	for _, p := range ps {
+		found[p.ID] = true
+	}
+	missing := make([]uint32, 0)
+	for _, id := range ids {
+		if !found[id] {
+			missing = append(missing, id)
+		}
+	}
 
-	// Encode the model as a JSON string.
-	err = json.NewEncoder(w).Encode(p)
+	// Provide content type and the missing IDs in response header.
+	w.Header().Set("Vary", "Accept")
+	w.Header().Set("Content-Type", enc.mediaType)
+	if len(missing) > 0 {
+		ss := make([]string, len(missing))
+		for i, id := range missing {
+			ss[i] = strconv.FormatUint(uint64(id), 10)
+		}
+		w.Header().Set("X-Missing-IDs", strings.Join(ss, ","))
+	}
+
+	// Encode the products in the negotiated media type. Encoders without a batch form
+	// write them as the last page.
+	if e, ok := enc.encoder.(batchEncoder); ok {
+		err = e.EncodeProductBatch(w, ps, missing)
+	} else {
+		err = enc.encoder.EncodeProductPage(w, ps, "")
+	}
+	if err != nil {
+		LogError(r, err)
+		return
+	}
+}
+
+func (s *Server) createProduct(w http.ResponseWriter, r *http.Request) {
+
+	// Pick the representation before the product is written.
+	enc, err := negotiate(r)
+	if err != nil {
+		Error(w, r, err)
+		return
+	}
+
+	// Parse the product from the body.
+	var p dataflow.Product
+	if err := decode(w, r, &p); err != nil {
+		Error(w, r, err)
+		return
+	}
+
+	// Create the product in the database. The service validates it.
+	if err := s.ProductService.CreateProduct(r.Context(), &p); err != nil {
+		Error(w, r, err)
+		return
+	}
+	s.indexProduct(r, &p)
+
+	// Provide content type, location and validators in response header.
+	w.Header().Set("Vary", "Accept")
+	setValidators(w, &p, representation(enc, nil))
+	w.Header().Set("Content-Type", enc.mediaType)
+	w.Header().Set("Location", "/product/"+strconv.FormatUint(uint64(p.ID), 10))
+	w.WriteHeader(http.StatusCreated)
+
+	// Encode the model in the negotiated media type.
+	if err := enc.encoder.EncodeProduct(w, &p); err != nil {
+		LogError(r, err)
+		return
+	}
+}
+
+func (s *Server) replaceProduct(w http.ResponseWriter, r *http.Request) {
+
+	// Parse ID from path.
+	id, err := parseID(r)
+	if err != nil {
+		Error(w, r, err)
+		return
+	}
+
+	// Parse the product from the body. Its ID is optional, but must match the path.
+	var p dataflow.Product
+	if err := decode(w, r, &p); err != nil {
+		Error(w, r, err)
+		return
+	} else if p.ID != 0 && p.ID != id {
+		Error(w, r, dataflow.Errorf(dataflow.EINVALID, "ID of the body does not match the path"))
+		return
+	}
+
+	// Replace all fields of the product.
+	s.updateProduct(w, r, id, dataflow.ProductUpdate{
+		Title:       &p.Title,
+		Price:       &p.Price,
+		Category:    &p.Category,
+		Brand:       &p.Brand,
+		URL:         &p.URL,
+		Description: &p.Description,
+	})
+}
+
+func (s *Server) patchProduct(w http.ResponseWriter, r *http.Request) {
+
+	// Parse ID from path.
+	id, err := parseID(r)
+	if err != nil {
+		Error(w, r, err)
+		return
+	}
+
+	// Parse the fields to change from the body.
+	var upd dataflow.ProductUpdate
+	if err := decode(w, r, &upd); err != nil {
+		Error(w, r, err)
+		return
+	}
+
+	s.updateProduct(w, r, id, upd)
+}
+
+// updateProduct updates a product and writes its new state.
+func (s *Server) updateProduct(w http.ResponseWriter, r *http.Request, id uint32, upd dataflow.ProductUpdate) {
+
+	// Pick the representation before the product is written.
+	enc, err := negotiate(r)
+	if err != nil {
+		Error(w, r, err)
+		return
+	}
+
+	// Update the product in the database. The service validates the new state.
+	p, err := s.ProductService.UpdateProduct(r.Context(), id, upd)
 	if err != nil {
+		Error(w, r, err)
+		return
+	}
+	s.indexProduct(r, p)
+
+	// Provide content type and validators in response header.
+	w.Header().Set("Vary", "Accept")
+	setValidators(w, p, representation(enc, nil))
+	w.Header().Set("Content-Type", enc.mediaType)
+
+	// Encode the model in the negotiated media type.
+	if err := enc.encoder.EncodeProduct(w, p); err != nil {
 		LogError(r, err)
 		return
 	}
+}
 
+func (s *Server) deleteProduct(w http.ResponseWriter, r *http.Request) {
+
+	// Parse ID from path.
+	id, err := parseID(r)
+	if err != nil {
+		Error(w, r, err)
+		return
+	}
+
+	// Delete the product from the database.
+	if err := s.ProductService.DeleteProduct(r.Context(), id); err != nil {
+		Error(w, r, err)
+		return
+	}
+	s.unindexProduct(r, id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// representation returns the name of a product representation in an encoding and projection.
+// It tells the entity tags of representations apart.
+func representation(enc encoding, fields []string) string {
+	if fields == nil {
+		return enc.name
+	} else if enc.name == "" {
+		return strings.Join(fields, ".")
+	}
+	return enc.name + "-" + strings.Join(fields, ".")
+}
+
+// etag returns the strong entity tag of a product representation, which changes with
+// the version of the product. The name of the encoding tells representations apart.
+// Products without a version have no tag.
+func etag(p *dataflow.Product, name string) string {
+	if p.Version == "" {
+		return ""
+	}
+	tag := p.Version
+	if name != "" {
+		tag += "-" + name
+	}
+	return `"` + tag + `"`
+}
+
+// setValidators sets the ETag and Last-Modified headers of a product representation, if it has them.
+func setValidators(w http.ResponseWriter, p *dataflow.Product, name string) {
+	if tag := etag(p, name); tag != "" {
+		w.Header().Set("ETag", tag)
+	}
+	if !p.UpdatedAt.IsZero() {
+		w.Header().Set("Last-Modified", p.UpdatedAt.UTC().Format(http.TimeFormat))
+	}
+}
+
+// notModified reports whether the client has the current representation of a product, according to
+// the If-None-Match or If-Modified-Since headers. If-Modified-Since is ignored, if the request
+// has an If-None-Match header.
+func notModified(r *http.Request, p *dataflow.Product, name string) bool {
+	if v := r.Header.Get("If-None-Match"); v != "" {
+		tag := etag(p, name)
+		for _, t := range strings.Split(v, ",") {
+			// If-None-Match uses the weak comparison.
+			t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+			if t == "*" || (tag != "" && t == tag) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if v := r.Header.Get("If-Modified-Since"); v != "" && !p.UpdatedAt.IsZero() {
+		t, err := http.ParseTime(v)
+		if err != nil {
+			return false
+		}
+		// Last-Modified has a resolution of seconds.
+		return !p.UpdatedAt.Truncate(time.Second).After(t)
+	}
+	return false
 }
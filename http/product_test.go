@@ -2,8 +2,13 @@ package http_test
 
 import (
 	"context"
+	"encoding/json"
+	"io"
 	"net/http"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/narslan/pipeline"
 )
@@ -24,17 +29,19 @@ func TestGetProduct(t *testing.T) {
 		Brand:       "brand1",
 		URL:         "https://url1.com",
 		Description: "a description",
+		Version:     "3",
+		UpdatedAt:   time.Date(2024, 5, 1, 12, 30, 0, 500_000_000, time.UTC),
 	}
 
 	// Mock the fetch of product.
-	s.ProductService.FindProductByIDFn = func(ctx context.Context, id uint32) (*dataflow.Product, error) {
+	s.ProductService.FindProductByIDFn = func(ctx context.Context, id uint32, fields ...string) (*dataflow.Product, error) {
 		return p, nil
 	}
 
 	// Ensure server can generate JSON output.
 	t.Run("JSON", func(t *testing.T) {
 		// Mock the fetch of product.
-		s.ProductService.FindProductByIDFn = func(ctx context.Context, id uint32) (*dataflow.Product, error) {
+		s.ProductService.FindProductByIDFn = func(ctx context.Context, id uint32, fields ...string) (*dataflow.Product, error) {
 			return p, nil
 		}
 
@@ -44,7 +51,504 @@ func TestGetProduct(t *testing.T) {
 			t.Fatal(err)
 		} else if got, want := resp.StatusCode, http.StatusOK; got != want {
 			t.Fatalf("StatusCode=%v, want %v", got, want)
+		} else if got, want := resp.Header.Get("Content-Type"), "application/json"; got != want {
+			t.Fatalf("Content-Type=%q, want %q", got, want)
+		} else if got, want := resp.Header.Get("ETag"), `"3"`; got != want {
+			t.Fatalf("ETag=%q, want %q", got, want)
+		} else if got, want := resp.Header.Get("Last-Modified"), "Wed, 01 May 2024 12:30:00 GMT"; got != want {
+			t.Fatalf("Last-Modified=%q, want %q", got, want)
 		}
 	})
 
+	// Ensure conditional requests are answered by their validators.
+	t.Run("Conditional", func(t *testing.T) {
+		for _, tt := range []struct {
+			name   string
+			header string
+			value  string
+			want   int
+		}{
+			{"IfNoneMatch", "If-None-Match", `"3"`, http.StatusNotModified},
+			{"IfNoneMatchList", "If-None-Match", `"1", W/"3"`, http.StatusNotModified},
+			{"IfNoneMatchAny", "If-None-Match", `*`, http.StatusNotModified},
+			{"IfNoneMatchStale", "If-None-Match", `"2"`, http.StatusOK},
+			{"IfModifiedSince", "If-Modified-Since", "Wed, 01 May 2024 12:30:00 GMT", http.StatusNotModified},
+			{"IfModifiedSinceStale", "If-Modified-Since", "Wed, 01 May 2024 12:29:59 GMT", http.StatusOK},
+			{"IfModifiedSinceInvalid", "If-Modified-Since", "yesterday", http.StatusOK},
+		} {
+			t.Run(tt.name, func(t *testing.T) {
+				req := s.MustNewRequest(t, context.TODO(), "GET", "/product/1", nil)
+				req.Header.Set(tt.header, tt.value)
+				resp, err := http.DefaultClient.Do(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer resp.Body.Close()
+
+				if got := resp.StatusCode; got != tt.want {
+					t.Fatalf("StatusCode=%v, want %v", got, tt.want)
+				} else if got, want := resp.Header.Get("ETag"), `"3"`; got != want {
+					t.Fatalf("ETag=%q, want %q", got, want)
+				}
+			})
+		}
+	})
+
+	// Ensure If-None-Match takes precedence over If-Modified-Since.
+	t.Run("IfNoneMatchPrecedence", func(t *testing.T) {
+		req := s.MustNewRequest(t, context.TODO(), "GET", "/product/1", nil)
+		req.Header.Set("If-None-Match", `"2"`)
+		req.Header.Set("If-Modified-Since", "Wed, 01 May 2024 12:30:00 GMT")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		if got, want := resp.StatusCode, http.StatusOK; got != want {
+			t.Fatalf("StatusCode=%v, want %v", got, want)
+		}
+	})
+
+	// Ensure products without a version have no validators.
+	t.Run("Unversioned", func(t *testing.T) {
+		s.ProductService.FindProductByIDFn = func(ctx context.Context, id uint32, fields ...string) (*dataflow.Product, error) {
+			return &dataflow.Product{ID: 1, Title: "title1"}, nil
+		}
+		req := s.MustNewRequest(t, context.TODO(), "GET", "/product/1", nil)
+		req.Header.Set("If-None-Match", `"0"`)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		if got, want := resp.StatusCode, http.StatusOK; got != want {
+			t.Fatalf("StatusCode=%v, want %v", got, want)
+		} else if got := resp.Header.Get("ETag"); got != "" {
+			t.Fatalf("ETag=%q, want none", got)
+		} else if got := resp.Header.Get("Last-Modified"); got != "" {
+			t.Fatalf("Last-Modified=%q, want none", got)
+		}
+	})
+}
+
+// Ensure the HTTP server reads and writes only the fields of a projection.
+func TestProductFields(t *testing.T) {
+	// Start the mocked HTTP test server.
+	s := MustOpenServer(t)
+	defer MustCloseServer(t, s)
+
+	p := &dataflow.Product{ID: 1, Title: "title1", Price: 42.5, Category: "bilgisayar", Brand: "brand1", Description: "long", Version: "3"}
+
+	// Ensure the projection is read with the validators, which are trimmed from the body.
+	t.Run("Get", func(t *testing.T) {
+		s.ProductService.FindProductByIDFn = func(ctx context.Context, id uint32, fields ...string) (*dataflow.Product, error) {
+			if want := []string{"id", "price", "version", "updated_at"}; !reflect.DeepEqual(fields, want) {
+				t.Fatalf("unexpected fields: %v", fields)
+			}
+			return p.Project(fields), nil
+		}
+
+		resp, err := http.DefaultClient.Do(s.MustNewRequest(t, context.TODO(), "GET", "/product/1?fields=price,id", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		var body map[string]any
+		if got, want := resp.StatusCode, http.StatusOK; got != want {
+			t.Fatalf("StatusCode=%v, want %v", got, want)
+		} else if got, want := resp.Header.Get("ETag"), `"3-id.price"`; got != want {
+			t.Fatalf("ETag=%q, want %q", got, want)
+		} else if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		} else if want := map[string]any{"id": 1.0, "price": 42.5}; !reflect.DeepEqual(body, want) {
+			t.Fatalf("unexpected body: %v", body)
+		}
+	})
+
+	// Ensure the projection selects the columns of CSV responses.
+	t.Run("CSV", func(t *testing.T) {
+		s.ProductService.ListProductsFn = func(ctx context.Context, filter dataflow.ProductFilter) ([]*dataflow.Product, string, error) {
+			if want := []string{"id", "title"}; !reflect.DeepEqual(filter.Fields, want) {
+				t.Fatalf("unexpected fields: %v", filter.Fields)
+			}
+			return []*dataflow.Product{p.Project(filter.Fields)}, "", nil
+		}
+
+		req := s.MustNewRequest(t, context.TODO(), "GET", "/products?fields=title", nil)
+		req.Header.Set("Accept", "text/csv")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		if buf, err := io.ReadAll(resp.Body); err != nil {
+			t.Fatal(err)
+		} else if got, want := string(buf), "id,title\n1,title1\n"; got != want {
+			t.Fatalf("unexpected body: %q, want %q", got, want)
+		}
+	})
+
+	// Ensure the projection is passed to batch lookups.
+	t.Run("BatchGet", func(t *testing.T) {
+		s.ProductService.FindProductsByIDsFn = func(ctx context.Context, ids []uint32, fields ...string) ([]*dataflow.Product, error) {
+			if want := []string{"id", "brand"}; !reflect.DeepEqual(fields, want) {
+				t.Fatalf("unexpected fields: %v", fields)
+			}
+			return []*dataflow.Product{p.Project(fields)}, nil
+		}
+
+		resp, err := http.DefaultClient.Do(s.MustNewRequest(t, context.TODO(), "POST", "/products:batchGet?fields=brand", strings.NewReader(`{"ids": [1]}`)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if got, want := resp.StatusCode, http.StatusOK; got != want {
+			t.Fatalf("StatusCode=%v, want %v", got, want)
+		}
+	})
+
+	// Ensure unknown fields are rejected.
+	t.Run("ErrUnknownField", func(t *testing.T) {
+		for _, url := range []string{"/product/1?fields=id,colour", "/products?fields=colour"} {
+			resp, err := http.DefaultClient.Do(s.MustNewRequest(t, context.TODO(), "GET", url, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if got, want := resp.StatusCode, http.StatusBadRequest; got != want {
+				t.Fatalf("%s: StatusCode=%v, want %v", url, got, want)
+			}
+		}
+	})
+}
+
+// Ensure the HTTP server can list products page by page.
+func TestListProducts(t *testing.T) {
+	// Start the mocked HTTP test server.
+	s := MustOpenServer(t)
+	defer MustCloseServer(t, s)
+
+	// Ensure the filter is passed to the service and the next cursor is returned.
+	t.Run("OK", func(t *testing.T) {
+		s.ProductService.ListProductsFn = func(ctx context.Context, filter dataflow.ProductFilter) ([]*dataflow.Product, string, error) {
+			if filter.Category != "bilgisayar" || filter.Brand != "brand1" || filter.Cursor != "abc" || filter.Limit != 2 {
+				t.Fatalf("unexpected filter: %#v", filter)
+			}
+			return []*dataflow.Product{{ID: 1}, {ID: 2}}, "def", nil
+		}
+
+		resp, err := http.DefaultClient.Do(s.MustNewRequest(t, context.TODO(), "GET", "/products?category=bilgisayar&brand=brand1&cursor=abc&limit=2", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if got, want := resp.StatusCode, http.StatusOK; got != want {
+			t.Fatalf("StatusCode=%v, want %v", got, want)
+		}
+
+		var page struct {
+			Products []*dataflow.Product `json:"products"`
+			Next     string              `json:"next"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+			t.Fatal(err)
+		} else if len(page.Products) != 2 || page.Next != "def" {
+			t.Fatalf("unexpected page: %#v", page)
+		}
+	})
+
+	// Ensure an invalid limit is rejected.
+	t.Run("ErrInvalidLimit", func(t *testing.T) {
+		resp, err := http.DefaultClient.Do(s.MustNewRequest(t, context.TODO(), "GET", "/products?limit=x", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if got, want := resp.StatusCode, http.StatusBadRequest; got != want {
+			t.Fatalf("StatusCode=%v, want %v", got, want)
+		}
+	})
+}
+
+// Ensure the HTTP server can look up a number of products at once.
+func TestBatchGetProducts(t *testing.T) {
+	// Start the mocked HTTP test server.
+	s := MustOpenServer(t)
+	defer MustCloseServer(t, s)
+
+	// Ensure found products and missing IDs are returned. Duplicate IDs are looked up once.
+	t.Run("OK", func(t *testing.T) {
+		s.ProductService.FindProductsByIDsFn = func(ctx context.Context, ids []uint32, fields ...string) ([]*dataflow.Product, error) {
+			if want := []uint32{3, 1, 2}; !reflect.DeepEqual(ids, want) {
+				t.Fatalf("ids=%v, want %v", ids, want)
+			}
+			return []*dataflow.Product{{ID: 3}, {ID: 2}}, nil
+		}
+
+		body := strings.NewReader(`{"ids": [3, 1, 3, 2]}`)
+		resp, err := http.DefaultClient.Do(s.MustNewRequest(t, context.TODO(), "POST", "/products:batchGet", body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if got, want := resp.StatusCode, http.StatusOK; got != want {
+			t.Fatalf("StatusCode=%v, want %v", got, want)
+		}
+
+		var out struct {
+			Products []*dataflow.Product `json:"products"`
+			Missing  []uint32            `json:"missing"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+			t.Fatal(err)
+		} else if len(out.Products) != 2 {
+			t.Fatalf("unexpected products: %v", out.Products)
+		} else if want := []uint32{1}; !reflect.DeepEqual(out.Missing, want) {
+			t.Fatalf("missing=%v, want %v", out.Missing, want)
+		}
+	})
+
+	// Ensure the representation is negotiated. CSV passes the missing IDs in a header.
+	t.Run("CSV", func(t *testing.T) {
+		s.ProductService.FindProductsByIDsFn = func(ctx context.Context, ids []uint32, fields ...string) ([]*dataflow.Product, error) {
+			return []*dataflow.Product{{ID: 2}}, nil
+		}
+
+		req := s.MustNewRequest(t, context.TODO(), "POST", "/products:batchGet?fields=id", strings.NewReader(`{"ids": [1, 2, 3]}`))
+		req.Header.Set("Accept", "text/csv")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := resp.Header.Get("Content-Type"), "text/csv"; got != want {
+			t.Fatalf("Content-Type=%q, want %q", got, want)
+		} else if got, want := resp.Header.Get("X-Missing-IDs"), "1,3"; got != want {
+			t.Fatalf("X-Missing-IDs=%q, want %q", got, want)
+		} else if got, want := string(body), "id\n2\n"; got != want {
+			t.Fatalf("body=%q, want %q", got, want)
+		}
+	})
+
+	// Ensure an unsupported media type is rejected before the products are fetched.
+	t.Run("ErrNotAcceptable", func(t *testing.T) {
+		s.ProductService.FindProductsByIDsFn = func(ctx context.Context, ids []uint32, fields ...string) ([]*dataflow.Product, error) {
+			t.Fatal("unexpected fetch")
+			return nil, nil
+		}
+
+		req := s.MustNewRequest(t, context.TODO(), "POST", "/products:batchGet", strings.NewReader(`{"ids": [1]}`))
+		req.Header.Set("Accept", "application/xml")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if got, want := resp.StatusCode, http.StatusNotAcceptable; got != want {
+			t.Fatalf("StatusCode=%v, want %v", got, want)
+		}
+	})
+
+	// Ensure a malformed body is rejected.
+	t.Run("ErrInvalidBody", func(t *testing.T) {
+		resp, err := http.DefaultClient.Do(s.MustNewRequest(t, context.TODO(), "POST", "/products:batchGet", strings.NewReader(`{"ids": "x"}`)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if got, want := resp.StatusCode, http.StatusBadRequest; got != want {
+			t.Fatalf("StatusCode=%v, want %v", got, want)
+		}
+	})
+}
+
+// Ensure the HTTP server can create a product.
+func TestCreateProduct(t *testing.T) {
+	// Start the mocked HTTP test server.
+	s := MustOpenServer(t)
+	defer MustCloseServer(t, s)
+
+	// Ensure the product is created and its location is returned.
+	t.Run("OK", func(t *testing.T) {
+		s.ProductService.CreateProductFn = func(ctx context.Context, p *dataflow.Product) error {
+			if p.ID != 42 || p.Title != "title42" {
+				t.Fatalf("unexpected product: %#v", p)
+			}
+			return nil
+		}
+
+		body := strings.NewReader(`{"id": 42, "title": "title42", "price": 1.5, "category": "bilgisayar", "brand": "brand1"}`)
+		resp, err := http.DefaultClient.Do(s.MustNewRequest(t, context.TODO(), "POST", "/products", body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if got, want := resp.StatusCode, http.StatusCreated; got != want {
+			t.Fatalf("StatusCode=%v, want %v", got, want)
+		} else if got, want := resp.Header.Get("Location"), "/product/42"; got != want {
+			t.Fatalf("Location=%v, want %v", got, want)
+		}
+	})
+
+	// Ensure an existing product results in a conflict.
+	t.Run("ErrConflict", func(t *testing.T) {
+		s.ProductService.CreateProductFn = func(ctx context.Context, p *dataflow.Product) error {
+			return dataflow.Errorf(dataflow.ECONFLICT, "product with id: %d already exists", p.ID)
+		}
+
+		body := strings.NewReader(`{"id": 42, "title": "title42", "price": 1.5, "category": "bilgisayar", "brand": "brand1"}`)
+		resp, err := http.DefaultClient.Do(s.MustNewRequest(t, context.TODO(), "POST", "/products", body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if got, want := resp.StatusCode, http.StatusConflict; got != want {
+			t.Fatalf("StatusCode=%v, want %v", got, want)
+		}
+	})
+
+	// Ensure unknown fields are rejected.
+	t.Run("ErrUnknownField", func(t *testing.T) {
+		body := strings.NewReader(`{"id": 42, "name": "title42"}`)
+		resp, err := http.DefaultClient.Do(s.MustNewRequest(t, context.TODO(), "POST", "/products", body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if got, want := resp.StatusCode, http.StatusBadRequest; got != want {
+			t.Fatalf("StatusCode=%v, want %v", got, want)
+		}
+	})
+}
+
+// Ensure the HTTP server can replace and patch a product.
+func TestUpdateProduct(t *testing.T) {
+	// Start the mocked HTTP test server.
+	s := MustOpenServer(t)
+	defer MustCloseServer(t, s)
+
+	// Ensure PUT sets all fields of the product.
+	t.Run("Put", func(t *testing.T) {
+		s.ProductService.UpdateProductFn = func(ctx context.Context, id uint32, upd dataflow.ProductUpdate) (*dataflow.Product, error) {
+			if id != 42 || upd.Title == nil || *upd.Title != "title42" || upd.URL == nil || *upd.URL != "" {
+				t.Fatalf("unexpected update of %d: %#v", id, upd)
+			}
+			p := &dataflow.Product{ID: id}
+			upd.Apply(p)
+			return p, nil
+		}
+
+		body := strings.NewReader(`{"title": "title42", "price": 1.5, "category": "bilgisayar", "brand": "brand1"}`)
+		resp, err := http.DefaultClient.Do(s.MustNewRequest(t, context.TODO(), "PUT", "/product/42", body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if got, want := resp.StatusCode, http.StatusOK; got != want {
+			t.Fatalf("StatusCode=%v, want %v", got, want)
+		}
+	})
+
+	// Ensure the ID of the body must match the path.
+	t.Run("ErrPutIDMismatch", func(t *testing.T) {
+		body := strings.NewReader(`{"id": 43, "title": "title42"}`)
+		resp, err := http.DefaultClient.Do(s.MustNewRequest(t, context.TODO(), "PUT", "/product/42", body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if got, want := resp.StatusCode, http.StatusBadRequest; got != want {
+			t.Fatalf("StatusCode=%v, want %v", got, want)
+		}
+	})
+
+	// Ensure PATCH only sets the given fields.
+	t.Run("Patch", func(t *testing.T) {
+		s.ProductService.UpdateProductFn = func(ctx context.Context, id uint32, upd dataflow.ProductUpdate) (*dataflow.Product, error) {
+			if upd.Price == nil || *upd.Price != 2.5 || upd.Title != nil {
+				t.Fatalf("unexpected update: %#v", upd)
+			}
+			return &dataflow.Product{ID: id, Price: *upd.Price}, nil
+		}
+
+		resp, err := http.DefaultClient.Do(s.MustNewRequest(t, context.TODO(), "PATCH", "/product/42", strings.NewReader(`{"price": 2.5}`)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if got, want := resp.StatusCode, http.StatusOK; got != want {
+			t.Fatalf("StatusCode=%v, want %v", got, want)
+		}
+
+		var p dataflow.Product
+		if err := json.NewDecoder(resp.Body).Decode(&p); err != nil {
+			t.Fatal(err)
+		} else if p.ID != 42 || p.Price != 2.5 {
+			t.Fatalf("unexpected product: %#v", p)
+		}
+	})
+
+	// Ensure a missing product results in not found.
+	t.Run("ErrNotFound", func(t *testing.T) {
+		s.ProductService.UpdateProductFn = func(ctx context.Context, id uint32, upd dataflow.ProductUpdate) (*dataflow.Product, error) {
+			return nil, dataflow.Errorf(dataflow.ENOTFOUND, "product with id: %d is not found", id)
+		}
+
+		resp, err := http.DefaultClient.Do(s.MustNewRequest(t, context.TODO(), "PATCH", "/product/42", strings.NewReader(`{}`)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if got, want := resp.StatusCode, http.StatusNotFound; got != want {
+			t.Fatalf("StatusCode=%v, want %v", got, want)
+		}
+	})
+}
+
+// Ensure the HTTP server can delete a product.
+func TestDeleteProduct(t *testing.T) {
+	// Start the mocked HTTP test server.
+	s := MustOpenServer(t)
+	defer MustCloseServer(t, s)
+
+	t.Run("OK", func(t *testing.T) {
+		s.ProductService.DeleteProductFn = func(ctx context.Context, id uint32) error {
+			if id != 42 {
+				t.Fatalf("unexpected id: %d", id)
+			}
+			return nil
+		}
+
+		resp, err := http.DefaultClient.Do(s.MustNewRequest(t, context.TODO(), "DELETE", "/product/42", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if got, want := resp.StatusCode, http.StatusNoContent; got != want {
+			t.Fatalf("StatusCode=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("ErrNotFound", func(t *testing.T) {
+		s.ProductService.DeleteProductFn = func(ctx context.Context, id uint32) error {
+			return dataflow.Errorf(dataflow.ENOTFOUND, "product with id: %d is not found", id)
+		}
+
+		resp, err := http.DefaultClient.Do(s.MustNewRequest(t, context.TODO(), "DELETE", "/product/42", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if got, want := resp.StatusCode, http.StatusNotFound; got != want {
+			t.Fatalf("StatusCode=%v, want %v", got, want)
+		}
+	})
 }
@@ -0,0 +1,81 @@
+package http
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/narslan/pipeline"
+)
+
+// limit wraps the handler of a route, so that each client is limited to the rate limit of
+// the route. Clients are told apart by the key, that client returns. Requests are not limited,
+// if their key is empty, the server has no rate limiter or the route has no limit.
+// If the limiter fails, the request is served.
+func (s *Server) limit(pattern string, client func(*http.Request) string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit, ok := s.RateLimits[pattern]
+		if !ok {
+			limit = s.DefaultRateLimit
+		}
+		key := client(r)
+		if s.RateLimiter == nil || limit.Rate <= 0 || key == "" {
+			h(w, r)
+			return
+		}
+
+		res, err := s.RateLimiter.Allow(r.Context(), pattern+"|"+key, limit)
+		if err != nil {
+			LogError(r, err)
+			h(w, r)
+			return
+		}
+
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(max(limit.Burst, 1)))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		w.Header().Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+		if !res.Allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(max(ceilSeconds(res.RetryAfter), 1)))
+			Error(w, r, dataflow.Errorf(dataflow.ETOOMANYREQUESTS, "Rate limit exceeded"))
+			return
+		}
+		h(w, r)
+	}
+}
+
+// principal returns the key of the authenticated client of a request for rate limiting.
+// Subjects are only unique within the scheme of their credential.
+// It returns an empty key, if the request is not authenticated.
+func (s *Server) principal(r *http.Request) string {
+	if p := dataflow.PrincipalFromContext(r.Context()); p != nil {
+		return "principal:" + p.Scheme + ":" + p.Subject
+	}
+	return ""
+}
+
+// clientIP returns the key of the IP address of a request for rate limiting.
+func (s *Server) clientIP(r *http.Request) string {
+	// The last address of the header is added by the trusted proxy. Earlier ones may be forged.
+	if s.ClientIPHeader != "" {
+		if v := r.Header.Values(s.ClientIPHeader); len(v) > 0 {
+			addrs := strings.Split(v[len(v)-1], ",")
+			if ip := strings.TrimSpace(addrs[len(addrs)-1]); ip != "" {
+				return "ip:" + ip
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// ceilSeconds returns a duration in whole seconds, rounded up.
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,164 @@
+package http_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/narslan/pipeline"
+	dataflowhttp "github.com/narslan/pipeline/http"
+	"github.com/narslan/pipeline/mock"
+)
+
+// Ensure clients are limited to the rate limit of each route.
+func TestRateLimit(t *testing.T) {
+	// Start the mocked HTTP test server.
+	s := MustOpenServer(t)
+	defer MustCloseServer(t, s)
+
+	var limiter mock.RateLimiter
+	s.RateLimiter = &limiter
+	s.RateLimits = map[string]dataflow.RateLimit{"GET /product/{id}": {Rate: 10, Burst: 20}}
+	s.DefaultRateLimit = dataflow.RateLimit{Rate: 1, Burst: 5}
+
+	s.ProductService.FindProductByIDFn = func(ctx context.Context, id uint32, fields ...string) (*dataflow.Product, error) {
+		return &dataflow.Product{ID: id}, nil
+	}
+	s.ProductService.ListProductsFn = func(ctx context.Context, filter dataflow.ProductFilter) ([]*dataflow.Product, string, error) {
+		return nil, "", nil
+	}
+
+	// Ensure the bucket is keyed by route and client, and its state is returned in headers.
+	t.Run("OK", func(t *testing.T) {
+		limiter.AllowFn = func(ctx context.Context, key string, limit dataflow.RateLimit) (*dataflow.RateLimitResult, error) {
+			if want := "GET /product/{id}|ip:127.0.0.1"; key != want {
+				t.Fatalf("key=%q, want %q", key, want)
+			} else if limit.Rate != 10 || limit.Burst != 20 {
+				t.Fatalf("unexpected limit: %#v", limit)
+			}
+			return &dataflow.RateLimitResult{Allowed: true, Remaining: 19, Reset: 100 * time.Millisecond}, nil
+		}
+
+		resp, err := http.DefaultClient.Do(s.MustNewRequest(t, context.TODO(), "GET", "/product/1", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if got, want := resp.StatusCode, http.StatusOK; got != want {
+			t.Fatalf("StatusCode=%v, want %v", got, want)
+		}
+		for header, want := range map[string]string{"X-RateLimit-Limit": "20", "X-RateLimit-Remaining": "19", "X-RateLimit-Reset": "1"} {
+			if got := resp.Header.Get(header); got != want {
+				t.Fatalf("%s=%q, want %q", header, got, want)
+			}
+		}
+	})
+
+	// Ensure a rejected request gets the time to retry.
+	t.Run("ErrTooManyRequests", func(t *testing.T) {
+		limiter.AllowFn = func(ctx context.Context, key string, limit dataflow.RateLimit) (*dataflow.RateLimitResult, error) {
+			if limit != s.DefaultRateLimit {
+				t.Fatalf("unexpected limit: %#v", limit)
+			}
+			return &dataflow.RateLimitResult{RetryAfter: 1500 * time.Millisecond, Reset: 5 * time.Second}, nil
+		}
+
+		resp, err := http.DefaultClient.Do(s.MustNewRequest(t, context.TODO(), "GET", "/products", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if got, want := resp.StatusCode, http.StatusTooManyRequests; got != want {
+			t.Fatalf("StatusCode=%v, want %v", got, want)
+		} else if got, want := resp.Header.Get("Retry-After"), "2"; got != want {
+			t.Fatalf("Retry-After=%q, want %q", got, want)
+		} else if got, want := resp.Header.Get("X-RateLimit-Remaining"), "0"; got != want {
+			t.Fatalf("X-RateLimit-Remaining=%q, want %q", got, want)
+		}
+	})
+
+	// Ensure authenticated clients are told apart by their principal, and others by the header of the proxy.
+	t.Run("Client", func(t *testing.T) {
+		keys := dataflowhttp.NewAPIKeyAuthenticator()
+		keys.AddKey("reader-key", &dataflow.Principal{Subject: "reader", Scopes: []string{dataflow.ScopeRead}})
+		s.Authenticators = []dataflowhttp.Authenticator{keys}
+		s.ClientIPHeader = "X-Forwarded-For"
+		defer func() { s.Authenticators, s.ClientIPHeader = nil, "" }()
+
+		var got []string
+		limiter.AllowFn = func(ctx context.Context, key string, limit dataflow.RateLimit) (*dataflow.RateLimitResult, error) {
+			got = append(got, key)
+			return &dataflow.RateLimitResult{Allowed: true}, nil
+		}
+
+		req := s.MustNewRequest(t, context.TODO(), "GET", "/product/1", nil)
+		req.Header.Set("X-API-Key", "reader-key")
+		req.Header.Set("X-Forwarded-For", "192.0.2.7")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if want := []string{"GET /product/{id}|ip:192.0.2.7", "GET /product/{id}|principal:ApiKey:reader"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("keys=%q, want %q", got, want)
+		}
+
+		s.Authenticators, got = nil, nil
+		req = s.MustNewRequest(t, context.TODO(), "GET", "/product/1", nil)
+		req.Header.Set("X-Forwarded-For", "10.0.0.1, 192.0.2.7")
+		resp, err = http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if want := []string{"GET /product/{id}|ip:192.0.2.7"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("keys=%q, want %q", got, want)
+		}
+	})
+
+	// Ensure requests with invalid credentials are limited by their IP address.
+	t.Run("ErrUnauthorized", func(t *testing.T) {
+		keys := dataflowhttp.NewAPIKeyAuthenticator()
+		s.Authenticators = []dataflowhttp.Authenticator{keys}
+		defer func() { s.Authenticators = nil }()
+
+		limiter.AllowFn = func(ctx context.Context, key string, limit dataflow.RateLimit) (*dataflow.RateLimitResult, error) {
+			if want := "GET /product/{id}|ip:127.0.0.1"; key != want {
+				t.Fatalf("key=%q, want %q", key, want)
+			}
+			return &dataflow.RateLimitResult{RetryAfter: time.Second}, nil
+		}
+
+		req := s.MustNewRequest(t, context.TODO(), "GET", "/product/1", nil)
+		req.Header.Set("X-API-Key", "invalid-key")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if got, want := resp.StatusCode, http.StatusTooManyRequests; got != want {
+			t.Fatalf("StatusCode=%v, want %v", got, want)
+		}
+	})
+
+	// Ensure requests are served, if the limiter fails.
+	t.Run("LimiterError", func(t *testing.T) {
+		limiter.AllowFn = func(ctx context.Context, key string, limit dataflow.RateLimit) (*dataflow.RateLimitResult, error) {
+			return nil, errors.New("connection refused")
+		}
+
+		resp, err := http.DefaultClient.Do(s.MustNewRequest(t, context.TODO(), "GET", "/product/1", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if got, want := resp.StatusCode, http.StatusOK; got != want {
+			t.Fatalf("StatusCode=%v, want %v", got, want)
+		}
+	})
+}
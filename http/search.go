@@ -0,0 +1,79 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/narslan/pipeline"
+)
+
+// searchProductsResponse represents the output of the product search.
+type searchProductsResponse struct {
+	Products []*dataflow.Product `json:"products"`
+
+	// Total number of matching products.
+	N int `json:"n"`
+}
+
+// indexProduct adds a written product to the search index, if search is enabled.
+// The write has succeeded, so a failure is only logged.
+func (s *Server) indexProduct(r *http.Request, p *dataflow.Product) {
+	if s.SearchService == nil {
+		return
+	}
+	if err := s.SearchService.IndexProducts(r.Context(), []*dataflow.Product{p}); err != nil {
+		LogError(r, err)
+	}
+}
+
+// unindexProduct removes a deleted product from the search index, if search is enabled.
+// The delete has succeeded, so a failure is only logged.
+func (s *Server) unindexProduct(r *http.Request, id uint32) {
+	if s.SearchService == nil {
+		return
+	}
+	if err := s.SearchService.RemoveProducts(r.Context(), []uint32{id}); err != nil {
+		LogError(r, err)
+	}
+}
+
+func (s *Server) searchProducts(w http.ResponseWriter, r *http.Request) {
+	if s.SearchService == nil {
+		Error(w, r, dataflow.Errorf(dataflow.ENOTFOUND, "Search is not enabled"))
+		return
+	}
+
+	// Parse the filter from the query string.
+	filter := dataflow.SearchFilter{Query: r.URL.Query().Get("q")}
+	for _, param := range []struct {
+		name string
+		v    *int
+	}{{"offset", &filter.Offset}, {"limit", &filter.Limit}} {
+		if v := r.URL.Query().Get(param.name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				Error(w, r, dataflow.Errorf(dataflow.EINVALID, "Invalid %s format", param.name))
+				return
+			}
+			*param.v = n
+		}
+	}
+
+	// Search the index.
+	ps, n, err := s.SearchService.SearchProducts(r.Context(), filter)
+	if err != nil {
+		Error(w, r, err)
+		return
+	}
+
+	// Provide content type in response header.
+	w.Header().Set("Content-Type", "application/json")
+
+	// Encode the results as a JSON string.
+	err = json.NewEncoder(w).Encode(&searchProductsResponse{Products: ps, N: n})
+	if err != nil {
+		LogError(r, err)
+		return
+	}
+}
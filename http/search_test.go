@@ -0,0 +1,109 @@
+package http_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/narslan/pipeline"
+)
+
+// Ensure the HTTP server can search products.
+func TestSearchProducts(t *testing.T) {
+	// Start the mocked HTTP test server.
+	s := MustOpenServer(t)
+	defer MustCloseServer(t, s)
+
+	// Ensure the filter is passed to the index and ranked results are returned.
+	t.Run("OK", func(t *testing.T) {
+		s.SearchService.SearchProductsFn = func(ctx context.Context, filter dataflow.SearchFilter) ([]*dataflow.Product, int, error) {
+			if filter.Query != "dağ bisikleti" || filter.Offset != 10 || filter.Limit != 5 {
+				t.Fatalf("unexpected filter: %#v", filter)
+			}
+			return []*dataflow.Product{{ID: 2}, {ID: 1}}, 12, nil
+		}
+
+		resp, err := http.DefaultClient.Do(s.MustNewRequest(t, context.TODO(), "GET", "/search?q=da%C4%9F+bisikleti&offset=10&limit=5", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if got, want := resp.StatusCode, http.StatusOK; got != want {
+			t.Fatalf("StatusCode=%v, want %v", got, want)
+		}
+
+		var page struct {
+			Products []*dataflow.Product `json:"products"`
+			N        int                 `json:"n"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+			t.Fatal(err)
+		} else if len(page.Products) != 2 || page.Products[0].ID != 2 || page.N != 12 {
+			t.Fatalf("unexpected page: %#v", page)
+		}
+	})
+
+	// Ensure errors of the index are mapped to status codes.
+	t.Run("ErrEmptyQuery", func(t *testing.T) {
+		s.SearchService.SearchProductsFn = func(ctx context.Context, filter dataflow.SearchFilter) ([]*dataflow.Product, int, error) {
+			return nil, 0, dataflow.Errorf(dataflow.EINVALID, "Query must not be empty.")
+		}
+
+		resp, err := http.DefaultClient.Do(s.MustNewRequest(t, context.TODO(), "GET", "/search", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if got, want := resp.StatusCode, http.StatusBadRequest; got != want {
+			t.Fatalf("StatusCode=%v, want %v", got, want)
+		}
+	})
+}
+
+// Ensure writes of the HTTP server keep the search index up to date.
+func TestSearchIndexWrites(t *testing.T) {
+	// Start the mocked HTTP test server.
+	s := MustOpenServer(t)
+	defer MustCloseServer(t, s)
+
+	var indexed, removed []uint32
+	s.SearchService.IndexProductsFn = func(ctx context.Context, ps []*dataflow.Product) error {
+		for _, p := range ps {
+			indexed = append(indexed, p.ID)
+		}
+		return nil
+	}
+	s.SearchService.RemoveProductsFn = func(ctx context.Context, ids []uint32) error {
+		removed = append(removed, ids...)
+		return nil
+	}
+	s.ProductService.CreateProductFn = func(ctx context.Context, p *dataflow.Product) error { return nil }
+	s.ProductService.UpdateProductFn = func(ctx context.Context, id uint32, upd dataflow.ProductUpdate) (*dataflow.Product, error) {
+		return &dataflow.Product{ID: id, Title: *upd.Title}, nil
+	}
+	s.ProductService.DeleteProductFn = func(ctx context.Context, id uint32) error { return nil }
+
+	for _, req := range []*http.Request{
+		s.MustNewRequest(t, context.TODO(), "POST", "/products", strings.NewReader(`{"id": 1, "title": "title1"}`)),
+		s.MustNewRequest(t, context.TODO(), "PATCH", "/product/2", strings.NewReader(`{"title": "title2"}`)),
+		s.MustNewRequest(t, context.TODO(), "DELETE", "/product/3", nil),
+	} {
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			t.Fatalf("%s %s: StatusCode=%v", req.Method, req.URL.Path, resp.StatusCode)
+		}
+	}
+
+	if want := []uint32{1, 2}; !reflect.DeepEqual(indexed, want) {
+		t.Fatalf("indexed=%v, want %v", indexed, want)
+	} else if want := []uint32{3}; !reflect.DeepEqual(removed, want) {
+		t.Fatalf("removed=%v, want %v", removed, want)
+	}
+}
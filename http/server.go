@@ -1,26 +1,58 @@
 package http
 
 import (
+	"cmp"
 	"context"
-	"log"
+	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/narslan/pipeline"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-// ShutdownTimeout is the period for outstanding requests to finish before shutdown.
-const ShutdownTimeout = 1 * time.Second
+// DefaultShutdownTimeout is the default period for outstanding requests to finish before shutdown.
+const DefaultShutdownTimeout = 1 * time.Second
 
 // Server represents an HTTP server.
 type Server struct {
+	ln     net.Listener
 	server *http.Server
 
 	// Bind address for the server's listener as in ":8080".
 	Address string
 
-	// Service used by the HTTP routes.
+	// Services used by the HTTP routes.
 	ProductService dataflow.ProductService
+
+	// SearchService serves the search route. Search is disabled, if it is nil.
+	SearchService dataflow.SearchService
+
+	// Authenticators of requests. Each route requires a scope of the principal.
+	// Requests are not authenticated, if there are no authenticators.
+	Authenticators []Authenticator
+
+	// RateLimiter limits the rate of requests of each client to a route.
+	// Requests are not limited, if it is nil.
+	RateLimiter dataflow.RateLimiter
+
+	// Rate limits by route pattern, like "GET /product/{id}".
+	// Routes without a limit of their own are limited to DefaultRateLimit.
+	RateLimits       map[string]dataflow.RateLimit
+	DefaultRateLimit dataflow.RateLimit
+
+	// Header of the client IP address, as set by a trusted proxy, like "X-Forwarded-For".
+	// Empty uses the remote address of the connection.
+	ClientIPHeader string
+
+	// Logger of the server. The logs of a request carry its ID. Defaults to slog.Default().
+	Logger *slog.Logger
+
+	// Period for outstanding requests to finish, when the server is closed.
+	ShutdownTimeout time.Duration
 }
 
 // NewServer returns a new instance of Server.
@@ -34,35 +66,78 @@ func NewServer() *Server {
 		server: &http.Server{
 			Handler: mux,
 		},
+		Logger:          slog.Default(),
+		ShutdownTimeout: DefaultShutdownTimeout,
 	}
 
 	// Setup our handler that gets product from .
-	mux.HandleFunc("GET /product/{id}", s.getProductById)
+	s.handle(mux, "GET /product/{id}", dataflow.ScopeRead, s.getProductById)
+	s.handle(mux, "PUT /product/{id}", dataflow.ScopeWrite, s.replaceProduct)
+	s.handle(mux, "PATCH /product/{id}", dataflow.ScopeWrite, s.patchProduct)
+	s.handle(mux, "DELETE /product/{id}", dataflow.ScopeWrite, s.deleteProduct)
+	s.handle(mux, "POST /products", dataflow.ScopeWrite, s.createProduct)
+	s.handle(mux, "GET /products", dataflow.ScopeRead, s.listProducts)
+	s.handle(mux, "POST /products:batchGet", dataflow.ScopeRead, s.batchGetProducts)
+	s.handle(mux, "GET /search", dataflow.ScopeRead, s.searchProducts)
+
+	// Expose the metrics of the process to scrapers.
+	mux.Handle("GET /metrics", promhttp.Handler())
 	return s
 }
 
+// handle registers the handler of a route. Requests are counted and logged, authorized for scope
+// and limited to the rate limit of the route. Each IP address is limited before authorization,
+// so failed credentials are limited as well, and each principal after it.
+func (s *Server) handle(mux *http.ServeMux, pattern, scope string, h http.HandlerFunc) {
+	h = s.authorize(scope, s.limit(pattern, s.principal, h))
+	mux.HandleFunc(pattern, s.instrument(pattern, s.limit(pattern, s.clientIP, h)))
+}
+
 // Open begins listening on the bind address.
+// The listener is open, once Open returns.
 func (s *Server) Open() (err error) {
 
-	// Assign server port.
-	s.server.Addr = s.Address
+	// Open a listener on the bind address.
+	if s.ln, err = net.Listen("tcp", s.Address); err != nil {
+		return err
+	}
 
+	s.logger().Info("microservice server listens", "addr", s.ln.Addr().String())
 	go func() {
-		log.Println("microservice server listens on", s.server.Addr)
-		err := s.server.ListenAndServe()
+		err := s.server.Serve(s.ln)
 
 		if err != http.ErrServerClosed {
-			// it is fine to use Fatal here because it is not main gorutine
-			log.Fatalf("HTTP server ListenAndServe: %v", err)
+			// it is fine to exit here because it is not main gorutine
+			s.logger().Error("HTTP server Serve", "error", err)
+			os.Exit(1)
 		}
 	}()
 	return nil
 }
 
+// Port returns the TCP port for the running server.
+// This is useful in tests where we allocate a random port by using ":0".
+func (s *Server) Port() int {
+	if s.ln == nil {
+		return 0
+	}
+	return s.ln.Addr().(*net.TCPAddr).Port
+}
+
+// URL returns the local base URL of the running server.
+func (s *Server) URL() string {
+	return fmt.Sprintf("http://localhost:%d", s.Port())
+}
+
 // Close shuts down the server.
 func (s *Server) Close() error {
-	ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), s.ShutdownTimeout)
 	defer cancel()
-	log.Print("shutting down server")
+	s.logger().Info("shutting down server")
 	return s.server.Shutdown(ctx)
 }
+
+// logger returns the logger of the server, or the default logger if it is not set.
+func (s *Server) logger() *slog.Logger {
+	return cmp.Or(s.Logger, slog.Default())
+}
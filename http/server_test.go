@@ -2,10 +2,13 @@ package http_test
 
 import (
 	"context"
+	"errors"
 	"io"
 	"net/http"
 	"testing"
+	"time"
 
+	"github.com/narslan/pipeline"
 	dataflowhttp "github.com/narslan/pipeline/http"
 	"github.com/narslan/pipeline/mock"
 )
@@ -17,6 +20,27 @@ type Server struct {
 
 	// Mock services.
 	ProductService mock.ProductService
+	SearchService  mock.SearchService
+}
+
+// Ensure a server without a logger logs to the default logger.
+func TestServer_NilLogger(t *testing.T) {
+	s := MustOpenServer(t)
+	s.Logger = nil
+	defer MustCloseServer(t, s)
+
+	s.ProductService.FindProductByIDFn = func(ctx context.Context, id uint32, fields ...string) (*dataflow.Product, error) {
+		return nil, errors.New("connection refused")
+	}
+
+	resp, err := http.DefaultClient.Do(s.MustNewRequest(t, context.TODO(), "GET", "/product/1", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got, want := resp.StatusCode, http.StatusInternalServerError; got != want {
+		t.Fatalf("StatusCode=%v, want %v", got, want)
+	}
 }
 
 // MustOpenServer is  test helper function for starting a new test HTTP server.
@@ -26,9 +50,17 @@ func MustOpenServer(tb testing.TB) *Server {
 
 	// Initialize wrapper.
 	s := &Server{Server: dataflowhttp.NewServer()}
-	s.Address = ":8080"
+	s.Address = "localhost:0"
+
+	// Leave outstanding requests enough time to finish, even under the race detector.
+	s.ShutdownTimeout = 10 * time.Second
 	// Assign mocks to actual server's services.
 	s.Server.ProductService = &s.ProductService
+	s.Server.SearchService = &s.SearchService
+
+	// Writes update the search index, which only the tests of search look into.
+	s.SearchService.IndexProductsFn = func(ctx context.Context, ps []*dataflow.Product) error { return nil }
+	s.SearchService.RemoveProductsFn = func(ctx context.Context, ids []uint32) error { return nil }
 
 	// Begin running test server.
 	if err := s.Open(); err != nil {
@@ -42,6 +74,10 @@ func MustOpenServer(tb testing.TB) *Server {
 // Fail on error.
 func MustCloseServer(tb testing.TB, s *Server) {
 	tb.Helper()
+
+	// Close unused connections of the client. The server waits for new connections,
+	// that never sent a request, until they are idle for 5 seconds.
+	http.DefaultClient.CloseIdleConnections()
 	if err := s.Close(); err != nil {
 		tb.Fatal(err)
 	}
@@ -52,7 +88,7 @@ func (s *Server) MustNewRequest(tb testing.TB, ctx context.Context, method, url
 	tb.Helper()
 
 	// Create new net/http request with server's base URL.
-	r, err := http.NewRequest(method, "http://localhost:8080/product/1", body)
+	r, err := http.NewRequestWithContext(ctx, method, s.URL()+url, body)
 	if err != nil {
 		tb.Fatal(err)
 	}
@@ -0,0 +1,206 @@
+package inmem
+
+import (
+	"bufio"
+	"container/list"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/narslan/pipeline"
+)
+
+// DefaultCacheSize is the default number of product IDs kept by Cache.
+const DefaultCacheSize = 1 << 20
+
+// Ensure service implements interface.
+var _ dataflow.Cache = (*Cache)(nil)
+
+// Cache represents an in-memory cache of product fingerprints.
+// Once it is full, the least recently used ID is evicted.
+type Cache struct {
+	mu    sync.Mutex
+	size  int
+	ll    *list.List // Most recently used entries first.
+	items map[uint32]*list.Element
+}
+
+// cacheEntry represents a cached product ID. It is also a line of a snapshot.
+type cacheEntry struct {
+	ID          uint32 `json:"id"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+// NewCache returns a new instance of Cache, that holds up to size IDs.
+// DefaultCacheSize is used, if size is not positive.
+func NewCache(size int) *Cache {
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
+	return &Cache{size: size, ll: list.New(), items: make(map[uint32]*list.Element)}
+}
+
+// Set stores the fingerprint of a given id.
+func (c *Cache) Set(ctx context.Context, id uint32, fingerprint string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.set(id, fingerprint)
+	return nil
+}
+
+// Exists reports whether a given id is in the cache.
+func (c *Cache) Exists(ctx context.Context, id uint32) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.get(id)
+	return ok, nil
+}
+
+// Get retrieves the fingerprint of a given id.
+// Returns an empty string if the id is not in the cache.
+func (c *Cache) Get(ctx context.Context, id uint32) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fingerprint, _ := c.get(id)
+	return fingerprint, nil
+}
+
+// SetMany stores a number of fingerprints at once.
+func (c *Cache) SetMany(ctx context.Context, fingerprints map[uint32]string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, fingerprint := range fingerprints {
+		c.set(id, fingerprint)
+	}
+	return nil
+}
+
+// GetMany retrieves the fingerprints of a number of ids at once.
+func (c *Cache) GetMany(ctx context.Context, ids []uint32) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fingerprints := make([]string, len(ids))
+	for i, id := range ids {
+		fingerprints[i], _ = c.get(id)
+	}
+	return fingerprints, nil
+}
+
+// DeleteMany removes a number of ids at once.
+func (c *Cache) DeleteMany(ctx context.Context, ids []uint32) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, id := range ids {
+		if e, ok := c.items[id]; ok {
+			c.ll.Remove(e)
+			delete(c.items, id)
+		}
+	}
+	return nil
+}
+
+// Fingerprints returns a copy of the cached fingerprints by id.
+// It does not change the recency of the ids.
+func (c *Cache) Fingerprints() map[uint32]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fingerprints := make(map[uint32]string, len(c.items))
+	for id, e := range c.items {
+		fingerprints[id] = e.Value.(*cacheEntry).Fingerprint
+	}
+	return fingerprints
+}
+
+// Len returns the number of cached ids.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// get returns the fingerprint of an id and marks it as recently used.
+// The caller must hold the lock.
+func (c *Cache) get(id uint32) (string, bool) {
+	e, ok := c.items[id]
+	if !ok {
+		return "", false
+	}
+	c.ll.MoveToFront(e)
+	return e.Value.(*cacheEntry).Fingerprint, true
+}
+
+// set stores the fingerprint of an id and evicts the least recently used id,
+// if the cache is full. The caller must hold the lock.
+func (c *Cache) set(id uint32, fingerprint string) {
+	if e, ok := c.items[id]; ok {
+		e.Value.(*cacheEntry).Fingerprint = fingerprint
+		c.ll.MoveToFront(e)
+		return
+	}
+
+	c.items[id] = c.ll.PushFront(&cacheEntry{ID: id, Fingerprint: fingerprint})
+	if c.ll.Len() > c.size {
+		e := c.ll.Back()
+		c.ll.Remove(e)
+		delete(c.items, e.Value.(*cacheEntry).ID)
+	}
+}
+
+// Load adds the entries of a snapshot written by Save.
+// A cache, whose snapshot does not exist, stays empty.
+func (c *Cache) Load(path string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Entries are written from the least to the most recently used,
+	// so adding them in order restores their recency.
+	dec := json.NewDecoder(bufio.NewReader(f))
+	for dec.More() {
+		var e cacheEntry
+		if err := dec.Decode(&e); err != nil {
+			return err
+		}
+		c.set(e.ID, e.Fingerprint)
+	}
+	return nil
+}
+
+// Save writes the entries of the cache to a snapshot at path.
+func (c *Cache) Save(path string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Write to a temporary file first and rename it,
+	// so a crash never leaves a truncated file behind.
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for e := c.ll.Back(); e != nil; e = e.Prev() {
+		if err := enc.Encode(e.Value); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	} else if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
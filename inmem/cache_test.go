@@ -0,0 +1,80 @@
+package inmem_test
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/narslan/pipeline/inmem"
+)
+
+func TestCache_Set(t *testing.T) {
+	// Ensure fingerprints can be stored and retrieved.
+	t.Run("OK", func(t *testing.T) {
+		c := inmem.NewCache(10)
+
+		if err := c.Set(context.Background(), 1, "a"); err != nil {
+			t.Fatal(err)
+		} else if err := c.SetMany(context.Background(), map[uint32]string{2: "b", 1: "c"}); err != nil {
+			t.Fatal(err)
+		}
+
+		if fingerprints, err := c.GetMany(context.Background(), []uint32{1, 2, 3}); err != nil {
+			t.Fatal(err)
+		} else if want := []string{"c", "b", ""}; !reflect.DeepEqual(fingerprints, want) {
+			t.Fatalf("GetMany=%v, want %v", fingerprints, want)
+		}
+
+		if err := c.DeleteMany(context.Background(), []uint32{1}); err != nil {
+			t.Fatal(err)
+		} else if ok, err := c.Exists(context.Background(), 1); err != nil {
+			t.Fatal(err)
+		} else if ok {
+			t.Fatal("expected false, got true")
+		}
+	})
+
+	// Ensure the least recently used id is evicted, once the cache is full.
+	t.Run("Evict", func(t *testing.T) {
+		c := inmem.NewCache(2)
+
+		_ = c.Set(context.Background(), 1, "a")
+		_ = c.Set(context.Background(), 2, "b")
+
+		// Use the first id, so the second one is the least recently used.
+		if fingerprint, _ := c.Get(context.Background(), 1); fingerprint != "a" {
+			t.Fatalf("Get=%q, want %q", fingerprint, "a")
+		}
+		_ = c.Set(context.Background(), 3, "c")
+
+		if fingerprints, _ := c.GetMany(context.Background(), []uint32{1, 2, 3}); !reflect.DeepEqual(fingerprints, []string{"a", "", "c"}) {
+			t.Fatalf("unexpected fingerprints: %v", fingerprints)
+		} else if n := c.Len(); n != 2 {
+			t.Fatalf("Len=%d, want 2", n)
+		}
+	})
+}
+
+func TestCache_Save(t *testing.T) {
+	// Ensure a saved cache can be loaded with the recency of its ids.
+	t.Run("OK", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "cache.jsonl")
+
+		c := inmem.NewCache(10)
+		_ = c.Set(context.Background(), 1, "a")
+		_ = c.Set(context.Background(), 2, "b")
+		_, _ = c.Get(context.Background(), 1)
+		if err := c.Save(path); err != nil {
+			t.Fatal(err)
+		}
+
+		// The loaded cache is smaller, so the least recently used id is evicted.
+		other := inmem.NewCache(1)
+		if err := other.Load(path); err != nil {
+			t.Fatal(err)
+		} else if fingerprints, _ := other.GetMany(context.Background(), []uint32{1, 2}); !reflect.DeepEqual(fingerprints, []string{"a", ""}) {
+			t.Fatalf("unexpected fingerprints: %v", fingerprints)
+		}
+	})
+}
@@ -0,0 +1,105 @@
+package inmem
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/narslan/pipeline"
+)
+
+// SweepInterval is the period, after which buckets, that are full again, are removed.
+const SweepInterval = time.Minute
+
+// Ensure service implements interface.
+var _ dataflow.RateLimiter = (*RateLimiter)(nil)
+
+// RateLimiter represents token buckets in memory. The buckets are not shared
+// between processes, so each replica limits the rate on its own.
+type RateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+
+	// Returns the current time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// bucket represents the tokens of a key at the time of its last request.
+type bucket struct {
+	tokens float64
+	last   time.Time
+	limit  dataflow.RateLimit
+}
+
+// NewRateLimiter returns a new instance of RateLimiter without buckets.
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{
+		buckets: make(map[string]*bucket),
+		Now:     time.Now,
+	}
+}
+
+// Allow takes a token from the bucket of key, if there is one.
+// A new bucket starts full.
+func (l *RateLimiter) Allow(ctx context.Context, key string, limit dataflow.RateLimit) (*dataflow.RateLimitResult, error) {
+	burst := float64(max(limit.Burst, 1))
+	if limit.Rate <= 0 {
+		return &dataflow.RateLimitResult{Allowed: true, Remaining: int(burst)}, nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.Now()
+	l.sweep(now)
+
+	// Refill the bucket for the time since the last request.
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = min(burst, b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	b.last, b.limit = now, limit
+
+	res := &dataflow.RateLimitResult{}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - b.tokens) / limit.Rate)
+	}
+	res.Remaining = int(math.Floor(b.tokens))
+	res.Reset = seconds((burst - b.tokens) / limit.Rate)
+	return res, nil
+}
+
+// Len returns the number of buckets.
+func (l *RateLimiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
+
+// sweep removes buckets, that are full again, once per SweepInterval.
+// A removed bucket is the same as a new one.
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < SweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		burst := float64(max(b.limit.Burst, 1))
+		if b.tokens+now.Sub(b.last).Seconds()*b.limit.Rate >= burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// seconds converts a number of seconds to a duration, rounded up to milliseconds.
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Ceil(s*1000)) * time.Millisecond
+}
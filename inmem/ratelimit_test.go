@@ -0,0 +1,85 @@
+package inmem_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/narslan/pipeline"
+	"github.com/narslan/pipeline/inmem"
+)
+
+func TestRateLimiter_Allow(t *testing.T) {
+	limit := dataflow.RateLimit{Rate: 2, Burst: 3}
+
+	// Ensure a burst is allowed, and further requests once tokens are refilled.
+	t.Run("OK", func(t *testing.T) {
+		now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+		l := inmem.NewRateLimiter()
+		l.Now = func() time.Time { return now }
+
+		for i := range 3 {
+			if res, err := l.Allow(context.Background(), "a", limit); err != nil {
+				t.Fatal(err)
+			} else if !res.Allowed || res.Remaining != 2-i {
+				t.Fatalf("request %d: unexpected result: %#v", i, res)
+			}
+		}
+
+		// The bucket is empty. A token is added every 500ms.
+		if res, err := l.Allow(context.Background(), "a", limit); err != nil {
+			t.Fatal(err)
+		} else if res.Allowed || res.RetryAfter != 500*time.Millisecond || res.Reset != 1500*time.Millisecond {
+			t.Fatalf("unexpected result: %#v", res)
+		}
+
+		// Other keys have buckets of their own.
+		if res, err := l.Allow(context.Background(), "b", limit); err != nil {
+			t.Fatal(err)
+		} else if !res.Allowed {
+			t.Fatalf("unexpected result: %#v", res)
+		}
+
+		now = now.Add(500 * time.Millisecond)
+		if res, err := l.Allow(context.Background(), "a", limit); err != nil {
+			t.Fatal(err)
+		} else if !res.Allowed || res.Remaining != 0 {
+			t.Fatalf("unexpected result: %#v", res)
+		}
+	})
+
+	// Ensure buckets, that are full again, are removed.
+	t.Run("Sweep", func(t *testing.T) {
+		now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+		l := inmem.NewRateLimiter()
+		l.Now = func() time.Time { return now }
+
+		for _, key := range []string{"a", "b"} {
+			if _, err := l.Allow(context.Background(), key, limit); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if n := l.Len(); n != 2 {
+			t.Fatalf("Len=%d, want 2", n)
+		}
+
+		now = now.Add(inmem.SweepInterval)
+		if _, err := l.Allow(context.Background(), "c", limit); err != nil {
+			t.Fatal(err)
+		} else if n := l.Len(); n != 1 {
+			t.Fatalf("Len=%d, want 1", n)
+		}
+	})
+
+	// Ensure requests are not limited without a rate.
+	t.Run("NoRate", func(t *testing.T) {
+		l := inmem.NewRateLimiter()
+		for range 10 {
+			if res, err := l.Allow(context.Background(), "a", dataflow.RateLimit{}); err != nil {
+				t.Fatal(err)
+			} else if !res.Allowed {
+				t.Fatalf("unexpected result: %#v", res)
+			}
+		}
+	})
+}
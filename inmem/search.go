@@ -0,0 +1,292 @@
+package inmem
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/narslan/pipeline"
+)
+
+// Limits of the page size of SearchProducts.
+const (
+	DefaultSearchLimit = 20
+	MaxSearchLimit     = 100
+)
+
+// Parameters of the BM25 ranking function.
+const (
+	k1 = 1.2
+	b  = 0.75
+)
+
+// TitleWeight is the number of times each title term counts.
+// A match in the title ranks higher than a match in the description.
+const TitleWeight = 2
+
+// Ensure service implements interface.
+var _ dataflow.SearchService = (*SearchIndex)(nil)
+
+// SearchIndex represents an in-memory inverted index of products, ranked with BM25.
+type SearchIndex struct {
+	mu sync.RWMutex
+
+	// Indexed products by ID.
+	products map[uint32]*dataflow.Product
+
+	// Frequency of each term in each product.
+	postings map[string]map[uint32]int
+
+	// Number of terms of each product, and of all products.
+	lengths map[uint32]int
+	total   int
+
+	// Modification time of the last loaded snapshot.
+	modTime time.Time
+}
+
+// NewSearchIndex returns a new instance of an empty SearchIndex.
+func NewSearchIndex() *SearchIndex {
+	return &SearchIndex{
+		products: make(map[uint32]*dataflow.Product),
+		postings: make(map[string]map[uint32]int),
+		lengths:  make(map[uint32]int),
+	}
+}
+
+// IndexProducts adds a number of products to the index.
+// Indexed products with the same IDs are replaced.
+func (s *SearchIndex) IndexProducts(ctx context.Context, ps []*dataflow.Product) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, p := range ps {
+		s.index(p)
+	}
+	return nil
+}
+
+// index adds a product to the index. The caller must hold the lock.
+func (s *SearchIndex) index(p *dataflow.Product) {
+	s.remove(p.ID)
+
+	// Keep a copy, so later changes of the caller do not leak into the index.
+	other := *p
+	s.products[p.ID] = &other
+
+	terms := documentTerms(&other)
+	for _, term := range terms {
+		if s.postings[term] == nil {
+			s.postings[term] = make(map[uint32]int)
+		}
+		s.postings[term][p.ID]++
+	}
+	s.lengths[p.ID] = len(terms)
+	s.total += len(terms)
+}
+
+// RemoveProducts removes a number of products from the index.
+func (s *SearchIndex) RemoveProducts(ctx context.Context, ids []uint32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, id := range ids {
+		s.remove(id)
+	}
+	return nil
+}
+
+// remove removes a product from the index. The caller must hold the lock.
+func (s *SearchIndex) remove(id uint32) {
+	p, ok := s.products[id]
+	if !ok {
+		return
+	}
+
+	for _, term := range documentTerms(p) {
+		delete(s.postings[term], id)
+		if len(s.postings[term]) == 0 {
+			delete(s.postings, term)
+		}
+	}
+	s.total -= s.lengths[id]
+	delete(s.lengths, id)
+	delete(s.products, id)
+}
+
+// SearchProducts retrieves a page of products matching any term of the query,
+// ranked by their BM25 score. Products with equal scores are ordered by ID.
+// Returns EINVALID if the query has no terms.
+func (s *SearchIndex) SearchProducts(ctx context.Context, filter dataflow.SearchFilter) ([]*dataflow.Product, int, error) {
+	terms := tokenize(filter.Query)
+	if len(terms) == 0 {
+		return nil, 0, dataflow.Errorf(dataflow.EINVALID, "Query must not be empty.")
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	} else if limit > MaxSearchLimit {
+		limit = MaxSearchLimit
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// Sum up the scores of the query terms.
+	n := float64(len(s.products))
+	avg := float64(s.total) / max(n, 1)
+	scores := make(map[uint32]float64)
+	slices.Sort(terms)
+	for _, term := range slices.Compact(terms) {
+		postings := s.postings[term]
+		df := float64(len(postings))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for id, tf := range postings {
+			f := float64(tf)
+			norm := 1 - b + b*float64(s.lengths[id])/avg
+			scores[id] += idf * f * (k1 + 1) / (f + k1*norm)
+		}
+	}
+
+	// Rank matching products.
+	ids := make([]uint32, 0, len(scores))
+	for id := range scores {
+		ids = append(ids, id)
+	}
+	slices.SortFunc(ids, func(x, y uint32) int {
+		if c := cmp.Compare(scores[y], scores[x]); c != 0 {
+			return c
+		}
+		return cmp.Compare(x, y)
+	})
+
+	// Apply the page.
+	total := len(ids)
+	offset := min(max(filter.Offset, 0), total)
+	ids = ids[offset:min(offset+limit, total)]
+
+	ps := make([]*dataflow.Product, len(ids))
+	for i, id := range ids {
+		other := *s.products[id]
+		ps[i] = &other
+	}
+	return ps, total, nil
+}
+
+// Load replaces the index with the products of a snapshot written by Save.
+// An index, whose snapshot does not exist, stays empty.
+func (s *SearchIndex) Load(path string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	// Each line holds a product.
+	var ps []*dataflow.Product
+	dec := json.NewDecoder(bufio.NewReader(f))
+	for dec.More() {
+		var p dataflow.Product
+		if err := dec.Decode(&p); err != nil {
+			return err
+		}
+		ps = append(ps, &p)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.products = make(map[uint32]*dataflow.Product, len(ps))
+	s.postings = make(map[string]map[uint32]int)
+	s.lengths = make(map[uint32]int, len(ps))
+	s.total = 0
+	s.modTime = fi.ModTime()
+	for _, p := range ps {
+		s.index(p)
+	}
+	return nil
+}
+
+// Reload replaces the index with the products of the snapshot at path, if the snapshot was
+// modified since it was loaded last. Products indexed after the last load are dropped.
+// It reports whether the index was replaced.
+func (s *SearchIndex) Reload(path string) (bool, error) {
+	fi, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	s.mu.RLock()
+	modTime := s.modTime
+	s.mu.RUnlock()
+	if fi.ModTime().Equal(modTime) {
+		return false, nil
+	}
+	return true, s.Load(path)
+}
+
+// Save writes the products of the index to a snapshot at path. The terms are
+// not written, they are rebuilt by Load.
+func (s *SearchIndex) Save(path string) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// Write to a temporary file first and rename it,
+	// so a crash never leaves a truncated file behind.
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, p := range s.products {
+		if err := enc.Encode(p); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	} else if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// documentTerms returns the terms of the searchable fields of a product.
+func documentTerms(p *dataflow.Product) []string {
+	var terms []string
+	for range TitleWeight {
+		terms = append(terms, tokenize(p.Title)...)
+	}
+	terms = append(terms, tokenize(p.Description)...)
+	terms = append(terms, tokenize(p.Brand)...)
+	return terms
+}
+
+// tokenize splits text into lower case terms of letters and digits.
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
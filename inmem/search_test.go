@@ -0,0 +1,180 @@
+package inmem_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	dataflow "github.com/narslan/pipeline"
+	"github.com/narslan/pipeline/inmem"
+)
+
+// MustIndex returns a search index of a few products. Fatal on error.
+func MustIndex(tb testing.TB) *inmem.SearchIndex {
+	tb.Helper()
+	s := inmem.NewSearchIndex()
+	if err := s.IndexProducts(context.Background(), []*dataflow.Product{
+		{ID: 1, Title: "Dağ Bisikleti", Brand: "Salcano", Description: "Alüminyum kadro, 21 vites."},
+		{ID: 2, Title: "Şehir Bisikleti", Brand: "Ümit", Description: "Sepetli bisiklet."},
+		{ID: 3, Title: "Kask", Brand: "Salcano", Description: "Bisiklet için kask."},
+		{ID: 4, Title: "Dizüstü Bilgisayar", Brand: "brand1", Description: "16 GB bellek."},
+	}); err != nil {
+		tb.Fatal(err)
+	}
+	return s
+}
+
+// ids returns the IDs of products.
+func ids(ps []*dataflow.Product) []uint32 {
+	a := make([]uint32, len(ps))
+	for i, p := range ps {
+		a[i] = p.ID
+	}
+	return a
+}
+
+func TestSearchIndex_SearchProducts(t *testing.T) {
+	// Ensure matches are ranked by relevance.
+	t.Run("OK", func(t *testing.T) {
+		s := MustIndex(t)
+
+		// Both titles match, the shorter product ranks higher.
+		ps, n, err := s.SearchProducts(context.Background(), dataflow.SearchFilter{Query: "bisikleti"})
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := ids(ps), []uint32{2, 1}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("ids=%v, want %v", got, want)
+		} else if n != 2 {
+			t.Fatalf("n=%d, want 2", n)
+		}
+
+		// Matches of more query terms rank higher.
+		ps, _, err = s.SearchProducts(context.Background(), dataflow.SearchFilter{Query: "SALCANO kask"})
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := ids(ps), []uint32{3, 1}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("ids=%v, want %v", got, want)
+		}
+	})
+
+	// Ensure results are paged.
+	t.Run("Page", func(t *testing.T) {
+		s := MustIndex(t)
+
+		ps, n, err := s.SearchProducts(context.Background(), dataflow.SearchFilter{Query: "salcano kask", Offset: 1, Limit: 1})
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := ids(ps), []uint32{1}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("ids=%v, want %v", got, want)
+		} else if n != 2 {
+			t.Fatalf("n=%d, want 2", n)
+		}
+	})
+
+	// Ensure replaced and removed products are no longer found by their old terms.
+	t.Run("Update", func(t *testing.T) {
+		s := MustIndex(t)
+
+		if err := s.IndexProducts(context.Background(), []*dataflow.Product{{ID: 3, Title: "Eldiven", Brand: "Salcano"}}); err != nil {
+			t.Fatal(err)
+		} else if err := s.RemoveProducts(context.Background(), []uint32{1}); err != nil {
+			t.Fatal(err)
+		}
+
+		if ps, _, err := s.SearchProducts(context.Background(), dataflow.SearchFilter{Query: "kask bisikleti"}); err != nil {
+			t.Fatal(err)
+		} else if got, want := ids(ps), []uint32{2}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("ids=%v, want %v", got, want)
+		}
+	})
+
+	// Ensure an error is returned if the query has no terms.
+	t.Run("ErrEmptyQuery", func(t *testing.T) {
+		s := MustIndex(t)
+		if _, _, err := s.SearchProducts(context.Background(), dataflow.SearchFilter{Query: " ,. "}); dataflow.ErrorCode(err) != dataflow.EINVALID {
+			t.Fatalf("unexpected error: %#v", err)
+		}
+	})
+}
+
+func TestSearchIndex_Save(t *testing.T) {
+	// Ensure a saved index can be loaded and searched.
+	t.Run("OK", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "search.jsonl")
+		if err := MustIndex(t).Save(path); err != nil {
+			t.Fatal(err)
+		}
+
+		s := inmem.NewSearchIndex()
+		if err := s.Load(path); err != nil {
+			t.Fatal(err)
+		}
+
+		ps, _, err := s.SearchProducts(context.Background(), dataflow.SearchFilter{Query: "bilgisayar"})
+		if err != nil {
+			t.Fatal(err)
+		} else if len(ps) != 1 || !reflect.DeepEqual(ps[0], &dataflow.Product{ID: 4, Title: "Dizüstü Bilgisayar", Brand: "brand1", Description: "16 GB bellek."}) {
+			t.Fatalf("unexpected products: %v", ps)
+		}
+	})
+
+	// Ensure a missing snapshot leaves the index empty.
+	t.Run("NotExist", func(t *testing.T) {
+		s := inmem.NewSearchIndex()
+		if err := s.Load(filepath.Join(t.TempDir(), "search.jsonl")); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestSearchIndex_Reload(t *testing.T) {
+	// Ensure a snapshot is loaded again only after it was written.
+	t.Run("OK", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "search.jsonl")
+		if err := MustIndex(t).Save(path); err != nil {
+			t.Fatal(err)
+		}
+
+		s := inmem.NewSearchIndex()
+		if err := s.Load(path); err != nil {
+			t.Fatal(err)
+		} else if ok, err := s.Reload(path); err != nil {
+			t.Fatal(err)
+		} else if ok {
+			t.Fatal("unexpected reload of an unchanged snapshot")
+		}
+
+		// Write a snapshot without the products, as a later run of the job would.
+		index := MustIndex(t)
+		if err := index.RemoveProducts(context.Background(), []uint32{4}); err != nil {
+			t.Fatal(err)
+		} else if err := index.Save(path); err != nil {
+			t.Fatal(err)
+		} else if err := os.Chtimes(path, time.Time{}, time.Now().Add(time.Second)); err != nil {
+			t.Fatal(err)
+		}
+
+		if ok, err := s.Reload(path); err != nil {
+			t.Fatal(err)
+		} else if !ok {
+			t.Fatal("expected reload")
+		} else if _, n, err := s.SearchProducts(context.Background(), dataflow.SearchFilter{Query: "bilgisayar"}); err != nil {
+			t.Fatal(err)
+		} else if n != 0 {
+			t.Fatalf("unexpected matches: %d", n)
+		}
+	})
+
+	// Ensure a missing snapshot leaves the index unchanged.
+	t.Run("NotExist", func(t *testing.T) {
+		s := MustIndex(t)
+		if ok, err := s.Reload(filepath.Join(t.TempDir(), "search.jsonl")); err != nil {
+			t.Fatal(err)
+		} else if ok {
+			t.Fatal("unexpected reload")
+		}
+	})
+}
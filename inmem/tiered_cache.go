@@ -0,0 +1,130 @@
+package inmem
+
+import (
+	"context"
+	"maps"
+	"slices"
+
+	"github.com/narslan/pipeline"
+)
+
+// Ensure service implements interface.
+var _ dataflow.Cache = (*TieredCache)(nil)
+
+// SyncBatchSize is the number of ids, that Sync compares with a single lookup of the remote cache.
+const SyncBatchSize = 1000
+
+// TieredCache represents a two-tier cache. Lookups are served by a local cache
+// and only go to the remote cache, like Redis, on a miss. Writes go to both caches.
+// The local cache is not notified about writes of other processes to the remote cache,
+// like the removals of the microservice. Sync drops the local entries, they made stale.
+type TieredCache struct {
+	local  *Cache
+	remote dataflow.Cache
+}
+
+// NewTieredCache returns a new instance of TieredCache.
+func NewTieredCache(local *Cache, remote dataflow.Cache) *TieredCache {
+	return &TieredCache{local: local, remote: remote}
+}
+
+// Set stores the fingerprint of a given id in both caches.
+func (c *TieredCache) Set(ctx context.Context, id uint32, fingerprint string) error {
+	if err := c.remote.Set(ctx, id, fingerprint); err != nil {
+		return err
+	}
+	return c.local.Set(ctx, id, fingerprint)
+}
+
+// Exists reports whether a given id is in the local or the remote cache.
+func (c *TieredCache) Exists(ctx context.Context, id uint32) (bool, error) {
+	if ok, _ := c.local.Exists(ctx, id); ok {
+		return true, nil
+	}
+	return c.remote.Exists(ctx, id)
+}
+
+// Get retrieves the fingerprint of a given id. A fingerprint found in the remote cache
+// is kept in the local cache.
+func (c *TieredCache) Get(ctx context.Context, id uint32) (string, error) {
+	if fingerprint, _ := c.local.Get(ctx, id); fingerprint != "" {
+		return fingerprint, nil
+	}
+
+	fingerprint, err := c.remote.Get(ctx, id)
+	if err != nil || fingerprint == "" {
+		return fingerprint, err
+	}
+	return fingerprint, c.local.Set(ctx, id, fingerprint)
+}
+
+// SetMany stores a number of fingerprints in both caches.
+func (c *TieredCache) SetMany(ctx context.Context, fingerprints map[uint32]string) error {
+	if err := c.remote.SetMany(ctx, fingerprints); err != nil {
+		return err
+	}
+	return c.local.SetMany(ctx, fingerprints)
+}
+
+// GetMany retrieves the fingerprints of a number of ids. Only the ids missing
+// from the local cache are looked up in the remote cache, with a single call.
+func (c *TieredCache) GetMany(ctx context.Context, ids []uint32) ([]string, error) {
+	fingerprints, _ := c.local.GetMany(ctx, ids)
+
+	// Collect the misses of the local cache.
+	var misses []uint32
+	var idx []int
+	for i, fingerprint := range fingerprints {
+		if fingerprint == "" {
+			misses = append(misses, ids[i])
+			idx = append(idx, i)
+		}
+	}
+	if len(misses) == 0 {
+		return fingerprints, nil
+	}
+
+	remote, err := c.remote.GetMany(ctx, misses)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the fingerprints found in the remote cache.
+	found := make(map[uint32]string, len(remote))
+	for j, fingerprint := range remote {
+		fingerprints[idx[j]] = fingerprint
+		if fingerprint != "" {
+			found[misses[j]] = fingerprint
+		}
+	}
+	return fingerprints, c.local.SetMany(ctx, found)
+}
+
+// DeleteMany removes a number of ids from both caches.
+func (c *TieredCache) DeleteMany(ctx context.Context, ids []uint32) error {
+	if err := c.remote.DeleteMany(ctx, ids); err != nil {
+		return err
+	}
+	return c.local.DeleteMany(ctx, ids)
+}
+
+// Sync drops the entries of the local cache, that differ from the remote cache, like the entries
+// of a snapshot, that were changed or removed in the remote cache since it was saved.
+func (c *TieredCache) Sync(ctx context.Context) error {
+	local := c.local.Fingerprints()
+	ids := slices.Collect(maps.Keys(local))
+
+	var stale []uint32
+	for chunk := range slices.Chunk(ids, SyncBatchSize) {
+		remote, err := c.remote.GetMany(ctx, chunk)
+		if err != nil {
+			return err
+		}
+		for i, id := range chunk {
+			if remote[i] != local[id] {
+				stale = append(stale, id)
+			}
+		}
+	}
+	return c.local.DeleteMany(ctx, stale)
+}
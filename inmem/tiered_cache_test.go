@@ -0,0 +1,81 @@
+package inmem_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/narslan/pipeline/inmem"
+	"github.com/narslan/pipeline/mock"
+)
+
+func TestTieredCache_GetMany(t *testing.T) {
+	// Ensure only ids missing from the local cache are looked up remotely.
+	t.Run("OK", func(t *testing.T) {
+		var requested [][]uint32
+		remote := &mock.Cache{
+			GetManyFn: func(ctx context.Context, ids []uint32) ([]string, error) {
+				requested = append(requested, ids)
+				fingerprints := make([]string, len(ids))
+				for i, id := range ids {
+					if id != 3 {
+						fingerprints[i] = "remote"
+					}
+				}
+				return fingerprints, nil
+			},
+			SetManyFn: func(ctx context.Context, fingerprints map[uint32]string) error { return nil },
+		}
+
+		c := inmem.NewTieredCache(inmem.NewCache(10), remote)
+		if err := c.SetMany(context.Background(), map[uint32]string{1: "local"}); err != nil {
+			t.Fatal(err)
+		}
+
+		if fingerprints, err := c.GetMany(context.Background(), []uint32{1, 2, 3}); err != nil {
+			t.Fatal(err)
+		} else if want := []string{"local", "remote", ""}; !reflect.DeepEqual(fingerprints, want) {
+			t.Fatalf("GetMany=%v, want %v", fingerprints, want)
+		}
+
+		// The remote hit is kept locally now.
+		if _, err := c.GetMany(context.Background(), []uint32{1, 2, 3}); err != nil {
+			t.Fatal(err)
+		} else if want := [][]uint32{{2, 3}, {3}}; !reflect.DeepEqual(requested, want) {
+			t.Fatalf("requested=%v, want %v", requested, want)
+		}
+	})
+}
+
+func TestTieredCache_Sync(t *testing.T) {
+	// Ensure local entries, that were changed or removed remotely, are dropped.
+	t.Run("OK", func(t *testing.T) {
+		remote := &mock.Cache{
+			GetManyFn: func(ctx context.Context, ids []uint32) ([]string, error) {
+				fingerprints := make([]string, len(ids))
+				for i, id := range ids {
+					switch id {
+					case 1:
+						fingerprints[i] = "same"
+					case 2:
+						fingerprints[i] = "changed"
+					}
+				}
+				return fingerprints, nil
+			},
+			SetManyFn: func(ctx context.Context, fingerprints map[uint32]string) error { return nil },
+		}
+
+		local := inmem.NewCache(10)
+		if err := local.SetMany(context.Background(), map[uint32]string{1: "same", 2: "old", 3: "removed"}); err != nil {
+			t.Fatal(err)
+		}
+
+		c := inmem.NewTieredCache(local, remote)
+		if err := c.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if got, want := local.Fingerprints(), map[uint32]string{1: "same"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("Fingerprints=%v, want %v", got, want)
+		}
+	})
+}
@@ -0,0 +1,22 @@
+package dataflow
+
+import (
+	"context"
+	"log/slog"
+)
+
+// loggerKey is the context key of the logger.
+type loggerKey struct{}
+
+// NewContextWithLogger returns a new context with the given logger. The logger carries
+// the attributes of an operation, like the ID of a request, to the services it calls.
+func NewContextWithLogger(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// LoggerFromContext returns the logger of the operation.
+// Returns nil if the context has no logger.
+func LoggerFromContext(ctx context.Context) *slog.Logger {
+	l, _ := ctx.Value(loggerKey{}).(*slog.Logger)
+	return l
+}
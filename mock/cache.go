@@ -0,0 +1,43 @@
+package mock
+
+import (
+	"context"
+
+	"github.com/narslan/pipeline"
+)
+
+var _ dataflow.Cache = (*Cache)(nil)
+
+type Cache struct {
+	SetFn    func(ctx context.Context, id uint32, fingerprint string) error
+	ExistsFn func(ctx context.Context, id uint32) (bool, error)
+	GetFn    func(ctx context.Context, id uint32) (string, error)
+
+	SetManyFn    func(ctx context.Context, fingerprints map[uint32]string) error
+	GetManyFn    func(ctx context.Context, ids []uint32) ([]string, error)
+	DeleteManyFn func(ctx context.Context, ids []uint32) error
+}
+
+func (s *Cache) Set(ctx context.Context, id uint32, fingerprint string) error {
+	return s.SetFn(ctx, id, fingerprint)
+}
+
+func (s *Cache) Exists(ctx context.Context, id uint32) (bool, error) {
+	return s.ExistsFn(ctx, id)
+}
+
+func (s *Cache) Get(ctx context.Context, id uint32) (string, error) {
+	return s.GetFn(ctx, id)
+}
+
+func (s *Cache) SetMany(ctx context.Context, fingerprints map[uint32]string) error {
+	return s.SetManyFn(ctx, fingerprints)
+}
+
+func (s *Cache) GetMany(ctx context.Context, ids []uint32) ([]string, error) {
+	return s.GetManyFn(ctx, ids)
+}
+
+func (s *Cache) DeleteMany(ctx context.Context, ids []uint32) error {
+	return s.DeleteManyFn(ctx, ids)
+}
@@ -9,14 +9,49 @@ import (
 var _ dataflow.ProductService = (*ProductService)(nil)
 
 type ProductService struct {
-	FindProductByIDFn func(ctx context.Context, id uint32) (*dataflow.Product, error)
-	CreateProductFn   func(ctx context.Context, p *dataflow.Product) error
+	FindProductByIDFn   func(ctx context.Context, id uint32, fields ...string) (*dataflow.Product, error)
+	FindProductsByIDsFn func(ctx context.Context, ids []uint32, fields ...string) ([]*dataflow.Product, error)
+	CreateProductFn     func(ctx context.Context, p *dataflow.Product) error
+	CreateProductsFn    func(ctx context.Context, ps []*dataflow.Product) error
+	UnlistProductsFn    func(ctx context.Context, prev map[uint32]dataflow.ProductListing) error
+	UpdateProductFn     func(ctx context.Context, id uint32, upd dataflow.ProductUpdate) (*dataflow.Product, error)
+	DeleteProductFn     func(ctx context.Context, id uint32) error
+	FindProductIDsFn    func(ctx context.Context) ([]uint32, error)
+	ListProductsFn      func(ctx context.Context, filter dataflow.ProductFilter) ([]*dataflow.Product, string, error)
 }
 
-func (s *ProductService) FindProductByID(ctx context.Context, id uint32) (*dataflow.Product, error) {
-	return s.FindProductByIDFn(ctx, id)
+func (s *ProductService) FindProductByID(ctx context.Context, id uint32, fields ...string) (*dataflow.Product, error) {
+	return s.FindProductByIDFn(ctx, id, fields...)
+}
+
+func (s *ProductService) FindProductsByIDs(ctx context.Context, ids []uint32, fields ...string) ([]*dataflow.Product, error) {
+	return s.FindProductsByIDsFn(ctx, ids, fields...)
 }
 
 func (s *ProductService) CreateProduct(ctx context.Context, p *dataflow.Product) error {
 	return s.CreateProductFn(ctx, p)
 }
+
+func (s *ProductService) CreateProducts(ctx context.Context, ps []*dataflow.Product) error {
+	return s.CreateProductsFn(ctx, ps)
+}
+
+func (s *ProductService) UnlistProducts(ctx context.Context, prev map[uint32]dataflow.ProductListing) error {
+	return s.UnlistProductsFn(ctx, prev)
+}
+
+func (s *ProductService) UpdateProduct(ctx context.Context, id uint32, upd dataflow.ProductUpdate) (*dataflow.Product, error) {
+	return s.UpdateProductFn(ctx, id, upd)
+}
+
+func (s *ProductService) DeleteProduct(ctx context.Context, id uint32) error {
+	return s.DeleteProductFn(ctx, id)
+}
+
+func (s *ProductService) FindProductIDs(ctx context.Context) ([]uint32, error) {
+	return s.FindProductIDsFn(ctx)
+}
+
+func (s *ProductService) ListProducts(ctx context.Context, filter dataflow.ProductFilter) ([]*dataflow.Product, string, error) {
+	return s.ListProductsFn(ctx, filter)
+}
@@ -0,0 +1,17 @@
+package mock
+
+import (
+	"context"
+
+	"github.com/narslan/pipeline"
+)
+
+var _ dataflow.RateLimiter = (*RateLimiter)(nil)
+
+type RateLimiter struct {
+	AllowFn func(ctx context.Context, key string, limit dataflow.RateLimit) (*dataflow.RateLimitResult, error)
+}
+
+func (l *RateLimiter) Allow(ctx context.Context, key string, limit dataflow.RateLimit) (*dataflow.RateLimitResult, error) {
+	return l.AllowFn(ctx, key, limit)
+}
@@ -0,0 +1,27 @@
+package mock
+
+import (
+	"context"
+
+	"github.com/narslan/pipeline"
+)
+
+var _ dataflow.SearchService = (*SearchService)(nil)
+
+type SearchService struct {
+	IndexProductsFn  func(ctx context.Context, ps []*dataflow.Product) error
+	RemoveProductsFn func(ctx context.Context, ids []uint32) error
+	SearchProductsFn func(ctx context.Context, filter dataflow.SearchFilter) ([]*dataflow.Product, int, error)
+}
+
+func (s *SearchService) IndexProducts(ctx context.Context, ps []*dataflow.Product) error {
+	return s.IndexProductsFn(ctx, ps)
+}
+
+func (s *SearchService) RemoveProducts(ctx context.Context, ids []uint32) error {
+	return s.RemoveProductsFn(ctx, ids)
+}
+
+func (s *SearchService) SearchProducts(ctx context.Context, filter dataflow.SearchFilter) ([]*dataflow.Product, int, error) {
+	return s.SearchProductsFn(ctx, filter)
+}
@@ -0,0 +1,224 @@
+package pipeline
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/narslan/pipeline"
+)
+
+// DefaultCheckpointInterval is the number of processed lines between two checkpoint saves.
+const DefaultCheckpointInterval = 1000
+
+// progress tracks the processed lines of a single source.
+// Lines are saved concurrently and finish out of order, so the checkpoint
+// only advances over a contiguous range of processed lines.
+type progress struct {
+	mu sync.Mutex
+	cp *dataflow.Checkpoint
+
+	// End offsets of lines processed ahead of the checkpoint.
+	pending map[int64]int64
+
+	// Line of the last saved checkpoint.
+	saved int64
+
+	// Number of lines in the source, known once the scanner is done.
+	total   int64
+	scanned bool
+}
+
+// complete reports whether all lines of the source are processed.
+func (pr *progress) complete() bool {
+	return pr.scanned && pr.cp.Line >= pr.total
+}
+
+// open opens a source and decompresses it. If the pipeline has a checkpoint service,
+// the progress of the source is tracked. In resume mode the source continues at its
+// checkpoint, if its metadata is known. It returns nil, if the source is already complete.
+func (p *Pipeline) open(ctx context.Context, key string) (*Source, error) {
+	if p.Checkpoints == nil {
+		body, err := p.Fetcher.Open(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		body, _, err = decompress(key, body)
+		if err != nil {
+			return nil, err
+		}
+		return &Source{Key: key, Body: body}, nil
+	}
+
+	// Retrieve the metadata of the source, if the fetcher supports it.
+	cp := &dataflow.Checkpoint{Key: key, Status: dataflow.CheckpointRunning, Encoding: Compression(key)}
+	if f, ok := p.Fetcher.(dataflow.StatFetch); ok {
+		info, err := f.Stat(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		cp.ETag, cp.Size = info.ETag, info.Size
+	}
+
+	// Continue from the previous checkpoint, if the source did not change. A change can only be
+	// detected by a size and an ETag, so sources without them are read from the beginning.
+	if p.Resume && (cp.Size <= 0 || cp.ETag == "") {
+		p.logger().InfoContext(ctx, "source restarted, changes can not be detected", "source", key)
+	} else if p.Resume {
+		prev, err := p.Checkpoints.FindCheckpoint(ctx, key)
+		if err != nil && dataflow.ErrorCode(err) != dataflow.ENOTFOUND {
+			return nil, err
+		} else if err == nil && prev.ETag == cp.ETag && prev.Size == cp.Size {
+			if prev.Status == dataflow.CheckpointComplete {
+				p.logger().InfoContext(ctx, "source skipped, already complete", "source", key)
+				return nil, nil
+			}
+			p.logger().InfoContext(ctx, "source resumed", "source", key, "line", prev.Line, "offset", prev.Offset)
+			cp.Line, cp.Offset = prev.Line, prev.Offset
+			if cp.Encoding == "" {
+				cp.Encoding = prev.Encoding
+			}
+		}
+	}
+
+	pr := &progress{cp: cp, pending: make(map[int64]int64), saved: -1}
+	p.mu.Lock()
+	p.progress = append(p.progress, pr)
+	p.mu.Unlock()
+
+	src := &Source{Key: key, progress: pr}
+
+	// Offsets of compressed sources count decompressed bytes. They can not be used
+	// to seek in the compressed stream, so those sources are read from the beginning.
+	var (
+		body io.ReadCloser
+		err  error
+	)
+	f, rangeOK := p.Fetcher.(dataflow.RangeFetch)
+	if cp.Encoding == "" && cp.Size > 0 && cp.Offset >= cp.Size {
+		// Nothing left to read, the remaining lines are already processed.
+		body = io.NopCloser(strings.NewReader(""))
+		src.Line, src.Offset = cp.Line, cp.Offset
+	} else if cp.Encoding == "" && rangeOK && cp.Offset > 0 {
+		// Start reading right after the last processed line.
+		body, err = f.OpenAt(ctx, key, cp.Offset)
+		src.Line, src.Offset = cp.Line, cp.Offset
+	} else {
+		// Read from the beginning and skip processed lines.
+		body, err = p.Fetcher.Open(ctx, key)
+		src.Skip = cp.Line
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Sources, that turn out to be compressed only by their content, are
+	// decompressed from the start. Their format is recorded for later runs.
+	if src.Offset == 0 {
+		body, cp.Encoding, err = decompress(key, body)
+		if err != nil {
+			return nil, err
+		}
+	}
+	src.Body = body
+
+	// Record the start of the run.
+	if err := p.saveCheckpoint(ctx, pr); err != nil {
+		body.Close()
+		return nil, err
+	}
+	return src, nil
+}
+
+// ack marks a line as processed and saves the checkpoint of its source
+// every CheckpointInterval lines, and once the source is complete.
+func (p *Pipeline) ack(ctx context.Context, line *Line) error {
+	pr := line.progress
+	if pr == nil {
+		return nil
+	}
+
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+
+	// Hold lines that finish ahead of the checkpoint.
+	if line.Number != pr.cp.Line+1 {
+		pr.pending[line.Number] = line.End
+		return nil
+	}
+
+	// Advance over contiguous processed lines.
+	pr.cp.Line, pr.cp.Offset = line.Number, line.End
+	for {
+		end, ok := pr.pending[pr.cp.Line+1]
+		if !ok {
+			break
+		}
+		delete(pr.pending, pr.cp.Line+1)
+		pr.cp.Line, pr.cp.Offset = pr.cp.Line+1, end
+	}
+
+	interval := p.CheckpointInterval
+	if interval <= 0 {
+		interval = DefaultCheckpointInterval
+	}
+	if pr.complete() || pr.cp.Line-pr.saved >= interval {
+		return p.saveCheckpointLocked(ctx, pr)
+	}
+	return nil
+}
+
+// finish records the number of lines of a scanned source.
+func (p *Pipeline) finish(ctx context.Context, src *Source, total int64) error {
+	pr := src.progress
+	if pr == nil {
+		return nil
+	}
+
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	pr.total, pr.scanned = total, true
+	if pr.complete() {
+		return p.saveCheckpointLocked(ctx, pr)
+	}
+	return nil
+}
+
+// flush saves the checkpoints of all tracked sources. It is called when the run ends,
+// so a canceled run can be resumed from the last processed line.
+func (p *Pipeline) flush(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, pr := range p.progress {
+		if err := p.saveCheckpoint(ctx, pr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveCheckpoint saves the checkpoint of a source.
+func (p *Pipeline) saveCheckpoint(ctx context.Context, pr *progress) error {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	return p.saveCheckpointLocked(ctx, pr)
+}
+
+// saveCheckpointLocked saves the checkpoint of a source. The caller must hold the lock.
+func (p *Pipeline) saveCheckpointLocked(ctx context.Context, pr *progress) error {
+	if pr.complete() {
+		pr.cp.Status = dataflow.CheckpointComplete
+	}
+	pr.cp.UpdatedAt = time.Now().UTC()
+
+	// Save a copy, so the service never sees later updates.
+	cp := *pr.cp
+	if err := p.Checkpoints.SaveCheckpoint(ctx, &cp); err != nil {
+		return err
+	}
+	pr.saved = cp.Line
+	return nil
+}
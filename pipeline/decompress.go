@@ -0,0 +1,123 @@
+package pipeline
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/narslan/pipeline"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression formats of sources.
+const (
+	Gzip  = "gzip"
+	Zstd  = "zstd"
+	Bzip2 = "bzip2"
+)
+
+// Magic bytes at the start of compressed streams.
+var magics = []struct {
+	format string
+	magic  []byte
+}{
+	{Gzip, []byte{0x1f, 0x8b}},
+	{Zstd, []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	{Bzip2, []byte("BZh")},
+}
+
+// Compression returns the compression format of a source by its extension.
+// It returns an empty string, if the extension is not known.
+func Compression(key string) string {
+	switch strings.ToLower(path.Ext(key)) {
+	case ".gz", ".gzip":
+		return Gzip
+	case ".zst", ".zstd":
+		return Zstd
+	case ".bz2":
+		return Bzip2
+	}
+	return ""
+}
+
+// encoding returns the compression format of a content encoding like "x-gzip".
+func encoding(contentEncoding string) string {
+	switch strings.ToLower(strings.TrimSpace(contentEncoding)) {
+	case "gzip", "x-gzip":
+		return Gzip
+	case "zstd":
+		return Zstd
+	case "bzip2", "x-bzip2":
+		return Bzip2
+	}
+	return ""
+}
+
+// decompress wraps the body of a source with a decompressor. The format is detected
+// from the extension of the key, the content encoding of the body or the magic bytes,
+// in this order. Uncompressed bodies are returned as they are.
+// It returns the detected format. The body is closed on error.
+func decompress(key string, body io.ReadCloser) (io.ReadCloser, string, error) {
+	format := Compression(key)
+	if e, ok := body.(dataflow.EncodedReader); ok && format == "" {
+		format = encoding(e.ContentEncoding())
+	}
+
+	// Peek at the start of the stream, if neither names a format.
+	r := bufio.NewReader(body)
+	if format == "" {
+		head, err := r.Peek(4)
+		if err != nil && err != io.EOF {
+			body.Close()
+			return nil, "", err
+		}
+		for _, m := range magics {
+			if bytes.HasPrefix(head, m.magic) {
+				format = m.format
+				break
+			}
+		}
+	}
+
+	switch format {
+	case Gzip:
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			body.Close()
+			return nil, "", err
+		}
+		return &decompressor{Reader: zr, closers: []io.Closer{zr, body}}, format, nil
+	case Zstd:
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			body.Close()
+			return nil, "", err
+		}
+		rc := zr.IOReadCloser()
+		return &decompressor{Reader: rc, closers: []io.Closer{rc, body}}, format, nil
+	case Bzip2:
+		return &decompressor{Reader: bzip2.NewReader(r), closers: []io.Closer{body}}, format, nil
+	}
+	return &decompressor{Reader: r, closers: []io.Closer{body}}, "", nil
+}
+
+// decompressor reads from a decompressed stream and closes the decoder and the underlying body.
+type decompressor struct {
+	io.Reader
+	closers []io.Closer
+}
+
+// Close closes the decoder and the underlying body.
+func (d *decompressor) Close() error {
+	var err error
+	for _, c := range d.closers {
+		if e := c.Close(); err == nil {
+			err = e
+		}
+	}
+	return err
+}
@@ -0,0 +1,44 @@
+package pipeline
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Counters of the pipeline stages. Unlike Stats, they add up over all pipelines of the process.
+var (
+	filesFetched = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dataflow_pipeline_files_fetched_total",
+		Help: "Total number of sources opened.",
+	})
+
+	bytesRead = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dataflow_pipeline_bytes_read_total",
+		Help: "Total number of bytes split into lines, after decompression.",
+	})
+
+	linesSplit = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dataflow_pipeline_lines_split_total",
+		Help: "Total number of lines split from sources.",
+	})
+
+	parseFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dataflow_pipeline_parse_failures_total",
+		Help: "Total number of lines, that are not valid products.",
+	})
+
+	cacheHits = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dataflow_pipeline_cache_hits_total",
+		Help: "Total number of products, whose fingerprint is in the cache.",
+	})
+
+	cacheMisses = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "dataflow_pipeline_cache_misses_total",
+		Help: "Total number of products, whose fingerprint is not in the cache.",
+	})
+
+	dbWrites = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dataflow_pipeline_db_writes_total",
+		Help: "Total number of products written to or deleted from the database.",
+	}, []string{"operation"})
+)
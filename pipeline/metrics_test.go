@@ -0,0 +1,97 @@
+package pipeline_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	dataflow "github.com/narslan/pipeline"
+	"github.com/narslan/pipeline/file"
+	"github.com/narslan/pipeline/mock"
+	"github.com/narslan/pipeline/pipeline"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Ensure the stages count their work in the metrics of the process.
+func TestMetrics(t *testing.T) {
+	t.Run("Split", func(t *testing.T) {
+		paths, err := filepath.Glob(filepath.Join("testdata", "*.jsonl"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files, lines := MustCounter(t, "dataflow_pipeline_files_fetched_total"), MustCounter(t, "dataflow_pipeline_lines_split_total")
+		bytes := MustCounter(t, "dataflow_pipeline_bytes_read_total")
+
+		ctx := context.Background()
+		pipe := pipeline.NewPipeline(file.NewFetchService(), n)
+		fileCh, _, err := pipe.LoadFiles(ctx, paths...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lineCh, _ := pipe.Split(ctx, fileCh)
+		for range lineCh {
+		}
+
+		if got := MustCounter(t, "dataflow_pipeline_files_fetched_total") - files; got != float64(len(paths)) {
+			t.Fatalf("files fetched=%v, want %d", got, len(paths))
+		} else if got := MustCounter(t, "dataflow_pipeline_lines_split_total") - lines; got != 5000 {
+			t.Fatalf("lines split=%v, want 5000", got)
+		} else if got := MustCounter(t, "dataflow_pipeline_bytes_read_total") - bytes; got <= 0 {
+			t.Fatalf("bytes read=%v, want > 0", got)
+		}
+	})
+
+	t.Run("SendBatchToDB", func(t *testing.T) {
+		hits, misses := MustCounter(t, "dataflow_pipeline_cache_hits_total"), MustCounter(t, "dataflow_pipeline_cache_misses_total")
+		writes := MustCounter(t, "dataflow_pipeline_db_writes_total")
+
+		// The first product is cached and unchanged, the second one is cached with
+		// another fingerprint and the third one is new.
+		prs := []*dataflow.Product{
+			{ID: 1, Title: "title1", Price: 10, Category: "bilgisayar", Brand: "brand1"},
+			{ID: 2, Title: "title2", Price: 20, Category: "bilgisayar", Brand: "brand1"},
+			{ID: 3, Title: "title3", Price: 30, Category: "bilgisayar", Brand: "brand1"},
+		}
+		pipe := pipeline.NewPipeline(file.NewFetchService(), n)
+		pipe.CacheService = &mock.Cache{
+			GetManyFn: func(ctx context.Context, ids []uint32) ([]string, error) {
+				return []string{prs[0].Fingerprint(), "stale", ""}, nil
+			},
+			SetManyFn: func(ctx context.Context, m map[uint32]string) error { return nil },
+		}
+		pipe.ProductService = &mock.ProductService{CreateProductsFn: func(ctx context.Context, ps []*dataflow.Product) error {
+			return nil
+		}}
+		if err := pipe.SendBatchToDB(context.Background(), prs); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := MustCounter(t, "dataflow_pipeline_cache_hits_total") - hits; got != 2 {
+			t.Fatalf("cache hits=%v, want 2", got)
+		} else if got := MustCounter(t, "dataflow_pipeline_cache_misses_total") - misses; got != 1 {
+			t.Fatalf("cache misses=%v, want 1", got)
+		} else if got := MustCounter(t, "dataflow_pipeline_db_writes_total") - writes; got != 2 {
+			t.Fatalf("db writes=%v, want 2", got)
+		}
+	})
+}
+
+// MustCounter returns the sum of a counter over all its labels. Fatal on error.
+func MustCounter(tb testing.TB, name string) float64 {
+	tb.Helper()
+
+	mfs, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	var sum float64
+	for _, mf := range mfs {
+		if mf.GetName() != name {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			sum += m.GetCounter().GetValue()
+		}
+	}
+	return sum
+}
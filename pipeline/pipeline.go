@@ -3,20 +3,46 @@ package pipeline
 import (
 	"bufio"
 	"bytes"
+	"cmp"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/narslan/pipeline"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/sync/errgroup"
 	"golang.org/x/sync/semaphore"
 )
 
+// tracer records the spans of the stages and of the writes to the DB.
+var tracer = otel.Tracer("github.com/narslan/pipeline/pipeline")
+
+// MaxLineSize is the maximum size of a single line, that Split accepts.
+// Longer lines are discarded and rejected by ConvertJSON.
+const MaxLineSize = 1 << 20
+
+// errLineTooLong is the error of a line, that is longer than MaxLineSize.
+var errLineTooLong = dataflow.Errorf(dataflow.EINVALID, "Line too long, exceeds %d bytes.", MaxLineSize)
+
+// Default limits of the Batch stage.
+const (
+	DefaultBatchSize   = 100
+	DefaultBatchLinger = 50 * time.Millisecond
+)
+
 // Pipeline represents a data flow architecture, which takes some input source
 // process it and save into a database.
 type Pipeline struct {
-	Fetcher dataflow.Fetch //Fetcher is an instance of remote or local services that fetches data.
+	Fetcher dataflow.StreamFetch //Fetcher is an instance of remote or local services that streams data.
 
 	NumThreads int // Number of worker threads for LoadFiles and Save methods.
 
@@ -26,49 +52,185 @@ type Pipeline struct {
 
 	// CacheService is also used by the Save method.
 	CacheService dataflow.Cache
+
+	// SearchService indexes all saved products, including unchanged ones.
+	// If it is nil, no search index is maintained.
+	SearchService dataflow.SearchService
+
+	// DeadLetters receives lines that can not be converted to valid products.
+	// If it is nil, rejected lines are only counted.
+	DeadLetters dataflow.DeadLetterSink
+
+	// ErrorBudget is the number of rejected lines tolerated by ConvertJSON.
+	// The run fails, once the budget is used up. A negative value means no limit.
+	ErrorBudget int64
+
+	// Checkpoints stores the progress of each source.
+	// If it is nil, progress is not tracked.
+	Checkpoints dataflow.CheckpointService
+
+	// Resume continues sources from their checkpoints
+	// and skips sources that are complete and unchanged.
+	Resume bool
+
+	// BatchSize is the maximum number of products written to the DB at once.
+	// DefaultBatchSize is used if it is not set.
+	BatchSize int
+
+	// BatchLinger is the maximum time a batch waits for more products.
+	// DefaultBatchLinger is used if it is not set.
+	BatchLinger time.Duration
+
+	// Snapshot treats the sources of a run as the full set of products.
+	// Products missing from them are deleted from the DB and the cache once the run succeeds.
+	// Deletion is skipped if any line was rejected, since the line might hold a product.
+	// It can not be combined with Resume, because skipped lines are never seen.
+	Snapshot bool
+
+	// CheckpointInterval is the number of processed lines between two checkpoint saves.
+	// DefaultCheckpointInterval is used if it is not set.
+	CheckpointInterval int64
+
+	// Stats holds the counters of the pipeline.
+	Stats Stats
+
+	// Logger of the pipeline. Defaults to slog.Default().
+	Logger *slog.Logger
+
+	// Progress of the sources opened by LoadFiles.
+	mu       sync.Mutex
+	progress []*progress
+
+	// IDs of the products saved in snapshot mode.
+	seenMu sync.Mutex
+	seen   map[uint32]struct{}
+}
+
+// Stats represents counters of a pipeline run.
+type Stats struct {
+	Rejected  atomic.Int64 // Number of lines rejected by ConvertJSON.
+	Inserted  atomic.Int64 // Number of products, that were not in the cache.
+	Updated   atomic.Int64 // Number of products, whose fingerprint changed.
+	Unchanged atomic.Int64 // Number of products, whose fingerprint is unchanged.
+	Deleted   atomic.Int64 // Number of products deleted in snapshot mode.
+}
+
+func NewPipeline(f dataflow.StreamFetch, num int) *Pipeline {
+
+	return &Pipeline{Fetcher: f, NumThreads: num, Logger: slog.Default()}
+}
+
+// logger returns the logger of the pipeline, or the default logger if it is not set.
+func (p *Pipeline) logger() *slog.Logger {
+	return cmp.Or(p.Logger, slog.Default())
+}
+
+// Source represents an opened input stream and the key it was fetched from.
+type Source struct {
+	Key  string
+	Body io.ReadCloser
+
+	// Line number and byte offset, that the body starts at.
+	// They are only set, when a source is resumed at an offset.
+	Line   int64
+	Offset int64
+
+	// Number of lines to discard, when a source is resumed from the beginning.
+	Skip int64
+
+	progress *progress
 }
 
-func NewPipeline(f dataflow.Fetch, num int) *Pipeline {
+// Line represents a single line of a source.
+type Line struct {
+	Source string // Key of the source, the line was read from.
+	Number int64  // Line number, starting at 1.
+	End    int64  // Byte offset right after the line.
+	Text   string
+	Err    error // Set, if the line could not be read, like when it is too long. Text is empty then.
+
+	progress *progress
+}
+
+// Record represents a product and the line it is converted from.
+type Record struct {
+	*Line
+	Product *dataflow.Product
+}
+
+// releaseCloser calls release function once, after the underlying reader is closed.
+type releaseCloser struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
 
-	return &Pipeline{Fetcher: f, NumThreads: num}
+// Close closes the underlying reader and calls the release function.
+func (c *releaseCloser) Close() error {
+	err := c.ReadCloser.Close()
+	c.once.Do(c.release)
+	return err
 }
 
-// LoadFiles step through a list of data concurrently.
-// Send the data in to a channel of bytes and return an error channel
+// LoadFiles opens a list of sources concurrently.
+// Send the opened streams in to a channel of sources and return an error channel
 // and error for erros outside the goroutine.
-func (p *Pipeline) LoadFiles(ctx context.Context, keys ...string) (<-chan []byte, <-chan error, error) {
+// At most NumThreads sources are open at the same time. A slot is released,
+// when the consumer closes the body of the source.
+func (p *Pipeline) LoadFiles(ctx context.Context, keys ...string) (<-chan *Source, <-chan error, error) {
 
 	// Fail if no source provided.
 	if len(keys) == 0 {
 		return nil, nil, errors.New("no sources provided")
 	}
-	outCh := make(chan []byte)
+	outCh := make(chan *Source)
 	errCh := make(chan error, 1)
 
 	// Create a semaphore. A semaphore limits the number of concurrent executions.
 	sem := semaphore.NewWeighted(int64(p.NumThreads))
 
+	ctx, span := tracer.Start(ctx, "Pipeline.LoadFiles", trace.WithAttributes(attribute.Int("pipeline.sources", len(keys))))
 	go func() {
+		defer close(errCh)
 		defer close(outCh)
+
 		var g errgroup.Group
-		for _, path := range keys {
+		var acquireErr error
+		for _, key := range keys {
 			// Acquire semaphore before starting goroutine
-			if err := sem.Acquire(ctx, 1); err != nil {
-				errCh <- err
-				return
+			if acquireErr = sem.Acquire(ctx, 1); acquireErr != nil {
+				break
 			}
-			// Start goroutine for fetching data
+			// Start goroutine for opening the stream.
 			g.Go(func() error {
-				defer sem.Release(1) // Release semaphore when goroutine finishes
-				data, err := p.Fetcher.Get(ctx, path)
-				if err != nil {
-					errCh <- err
+				// The span of a source lasts until its stream is closed.
+				ctx, fspan := tracer.Start(ctx, "Fetch.Open", trace.WithAttributes(attribute.String("pipeline.source", key)))
+				src, err := p.open(ctx, key)
+				if err != nil || src == nil {
+					sem.Release(1)
+					end(fspan, err)
+					return err
+				}
+				filesFetched.Inc()
+
+				// Release semaphore when the consumer closes the stream.
+				src.Body = &releaseCloser{ReadCloser: src.Body, release: func() { fspan.End(); sem.Release(1) }}
+				select {
+				case outCh <- src:
+					return nil
+				case <-ctx.Done():
+					src.Body.Close()
+					return ctx.Err()
 				}
-				outCh <- data
-				return nil
 			})
 		}
-		if err := g.Wait(); err != nil {
+
+		err := g.Wait()
+		if err == nil {
+			err = acquireErr
+		}
+		end(span, err)
+		if err != nil {
 			errCh <- err
 		}
 	}()
@@ -76,124 +238,514 @@ func (p *Pipeline) LoadFiles(ctx context.Context, keys ...string) (<-chan []byte
 
 }
 
-// Split takes slice of JSONL bytes and split them at newlines.
-// Send them through the channel.
-func (p *Pipeline) Split(ctx context.Context, input <-chan []byte) (<-chan string, <-chan error) {
-	outCh := make(chan string)
+// Split reads JSONL sources and split them at newlines.
+// Sources are scanned concurrently. Send the lines through the channel.
+func (p *Pipeline) Split(ctx context.Context, input <-chan *Source) (<-chan *Line, <-chan error) {
+	outCh := make(chan *Line)
 	errCh := make(chan error, 1)
+	ctx, span := tracer.Start(ctx, "Pipeline.Split")
 	go func() {
-		defer fmt.Println("Finished splitting")
+		defer p.logger().DebugContext(ctx, "finished splitting")
+		defer close(errCh)
 		defer close(outCh)
 
-		// For each input source data
-		for data := range input { // Read from the channel
+		// For each input source start a scanner job.
+		var g errgroup.Group
+		for src := range input { // Read from the channel
+			g.Go(func() error {
+				return p.scan(ctx, src, outCh)
+			})
+		}
+		err := g.Wait()
+		end(span, err)
+		if err != nil {
+			errCh <- err
+		}
+	}()
+	return outCh, errCh
+
+}
+
+// scan steps through a source line by line and sends the lines through the channel.
+// It closes the body of the source when it returns.
+func (p *Pipeline) scan(ctx context.Context, src *Source, outCh chan<- *Line) error {
+	defer src.Body.Close()
+
+	// Read straight from the stream and keep track of the byte offset after each line.
+	r := bufio.NewReaderSize(src.Body, 64*1024)
+	offset := src.Offset
+
+	n := src.Line
+	for {
+		buf, size, err := readLine(r)
+		if err == io.EOF {
+			break
+		}
+		offset += size
+		bytesRead.Add(float64(size))
+		if err != nil && err != errLineTooLong {
+			return fmt.Errorf("%s: %w", src.Key, err)
+		}
+		n++
 
-			// Create a scanner job.
-			scanner := bufio.NewScanner(bytes.NewReader(data))
-			// Step through bytes line by line.
-			for scanner.Scan() {
+		// Discard lines, that are already processed.
+		if n <= src.Line+src.Skip {
+			continue
+		}
+
+		line := &Line{Source: src.Key, Number: n, End: offset, Text: string(buf), Err: err, progress: src.progress}
+		select {
+		case outCh <- line:
+			linesSplit.Inc()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	p.logger().InfoContext(ctx, "source finished", "source", src.Key, "lines", n)
+	return p.finish(ctx, src, n)
+}
 
-				// We use Text method instead of Bytes. Explanation is in the link.
-				// https://github.com/golang/go/issues/35725#issuecomment-556936725
+// readLine reads the next line of r without its line ending. It also returns the number of bytes
+// read, including the line ending. Lines longer than MaxLineSize are discarded and return
+// errLineTooLong. Returns io.EOF if there are no more lines.
+func readLine(r *bufio.Reader) ([]byte, int64, error) {
+	var (
+		line    []byte
+		size    int64
+		tooLong bool
+	)
+	for {
+		frag, err := r.ReadSlice('\n')
+		size += int64(len(frag))
+		if !tooLong {
+			line = append(line, frag...)
+		}
 
-				outCh <- scanner.Text()
+		switch {
+		case err == bufio.ErrBufferFull:
+			// The line goes on. Drop it, once it is too long, but keep reading up to its end.
+			if len(line) > MaxLineSize {
+				line, tooLong = nil, true
 			}
+			continue
+		case err == io.EOF && size == 0:
+			return nil, 0, io.EOF
+		case err != nil && err != io.EOF:
+			return nil, size, err
 		}
-	}()
-	return outCh, errCh
 
+		line = bytes.TrimSuffix(bytes.TrimSuffix(line, []byte("\n")), []byte("\r"))
+		if tooLong || len(line) > MaxLineSize {
+			return nil, size, errLineTooLong
+		}
+		return line, size, nil
+	}
 }
 
 // Convert takes a JSON line and converts it to Product type.
-func (p *Pipeline) ConvertJSON(ctx context.Context, input <-chan string) (<-chan *dataflow.Product, <-chan error) {
-	outCh := make(chan *dataflow.Product)
+// Lines that are not valid JSON or fail the product validation are rejected
+// and sent to the dead-letter sink. The pipeline keeps going until the error budget is used up.
+func (p *Pipeline) ConvertJSON(ctx context.Context, input <-chan *Line) (<-chan *Record, <-chan error) {
+	outCh := make(chan *Record)
 	errCh := make(chan error, 1)
+	ctx, span := tracer.Start(ctx, "Pipeline.ConvertJSON")
 	go func() {
+		defer close(errCh)
 		defer close(outCh)
-		for job := range input { // Read from the channel
-			var p dataflow.Product
-			err := json.Unmarshal([]byte(job), &p)
+		defer span.End()
+		for line := range input { // Read from the channel
+			var pr dataflow.Product
+			err := line.Err
+			if err == nil {
+				err = json.Unmarshal([]byte(line.Text), &pr)
+			}
+			if err == nil {
+				err = pr.Validate()
+			}
 			if err != nil {
-				errCh <- err
+				attrs := []any{"source", line.Source, "line", line.Number, "error", err}
+				if pr.ID != 0 {
+					attrs = append(attrs, "product_id", pr.ID)
+				}
+				p.logger().WarnContext(ctx, "line rejected", attrs...)
+				if err := p.reject(ctx, line, err); err != nil {
+					end(span, err)
+					errCh <- err
+					return
+				}
+				continue
+			}
+
+			select {
+			case outCh <- &Record{Line: line, Product: &pr}:
+			case <-ctx.Done():
+				return
 			}
-			outCh <- &p
 		}
 	}()
 	return outCh, errCh
 
 }
 
-// Save setups a concurrent pipeline stage that calls SendToDB method.
-func (p *Pipeline) Save(ctx context.Context, products <-chan *dataflow.Product) (<-chan error, error) {
-	// Create a semaphore to limit concurrent executions
-	sem := semaphore.NewWeighted(int64(p.NumThreads))
+// reject sends a line to the dead-letter sink and charges the error budget.
+// It returns an error if the sink fails or the budget is used up.
+func (p *Pipeline) reject(ctx context.Context, line *Line, reason error) error {
+	// Prefer the human-readable message of application errors.
+	msg := reason.Error()
+	var e *dataflow.Error
+	if errors.As(reason, &e) {
+		msg = e.Message
+	}
 
-	errc := make(chan error, 1)
+	if p.DeadLetters != nil {
+		err := p.DeadLetters.Put(ctx, &dataflow.DeadLetter{
+			Source: line.Source,
+			Line:   line.Number,
+			Raw:    line.Text,
+			Error:  msg,
+			Time:   time.Now().UTC(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	parseFailures.Inc()
+	n := p.Stats.Rejected.Add(1)
+	if p.ErrorBudget >= 0 && n > p.ErrorBudget {
+		return dataflow.Errorf(dataflow.EINVALID, "error budget of %d exceeded at %s:%d: %v", p.ErrorBudget, line.Source, line.Number, reason)
+	}
+
+	// A rejected line counts as processed.
+	return p.ack(ctx, line)
+}
+
+// Batch groups records into batches of BatchSize records.
+// A smaller batch is sent, once BatchLinger elapsed since its first record arrived.
+func (p *Pipeline) Batch(ctx context.Context, input <-chan *Record) <-chan []*Record {
+	outCh := make(chan []*Record)
+
+	size := p.BatchSize
+	if size <= 0 {
+		size = DefaultBatchSize
+	}
+	linger := p.BatchLinger
+	if linger <= 0 {
+		linger = DefaultBatchLinger
+	}
+
+	ctx, span := tracer.Start(ctx, "Pipeline.Batch")
 	go func() {
-		defer close(errc)
+		defer close(outCh)
+		defer span.End()
+
+		var (
+			batch   []*Record
+			timer   *time.Timer
+			timeout <-chan time.Time
+		)
+
+		// flush sends the current batch and resets the linger timer.
+		flush := func() bool {
+			if timer != nil {
+				timer.Stop()
+				timer, timeout = nil, nil
+			}
+			if len(batch) == 0 {
+				return true
+			}
+			select {
+			case outCh <- batch:
+				batch = make([]*Record, 0, size)
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
 
-		var g errgroup.Group
+		for {
+			select {
+			case r, ok := <-input:
+				if !ok {
+					flush()
+					return
+				}
 
-		for pr := range products {
-			// Acquire semaphore before starting goroutine
-			if err := sem.Acquire(ctx, 1); err != nil {
-				errc <- err
+				// Start the linger timer with the first record of a batch.
+				if len(batch) == 0 {
+					timer = time.NewTimer(linger)
+					timeout = timer.C
+				}
+				batch = append(batch, r)
+				if len(batch) >= size && !flush() {
+					return
+				}
+			case <-timeout:
+				if !flush() {
+					return
+				}
+			case <-ctx.Done():
+				return
 			}
-			// Start goroutine for each product
-			g.Go(func(pr *dataflow.Product) func() error {
-				return func() error {
-					defer sem.Release(1) // Release semaphore when goroutine finishes
+		}
+	}()
+	return outCh
+}
+
+// Save setups a concurrent pipeline stage that calls SendBatchToDB method.
+// NumThreads workers save batches concurrently.
+// Records are acknowledged to the checkpoint of their source, after they are saved.
+func (p *Pipeline) Save(ctx context.Context, batches <-chan []*Record) (<-chan error, error) {
+	errc := make(chan error, 1)
+	ctx, span := tracer.Start(ctx, "Pipeline.Save")
+	go func() {
+		defer close(errc)
+
+		// Stop all workers on the first error.
+		g, gctx := errgroup.WithContext(ctx)
+		for range max(p.NumThreads, 1) {
+			g.Go(func() error {
+				for {
 					select {
-					case errc <- p.SendToDB(ctx, pr):
-						return nil
-					case <-ctx.Done():
-						return ctx.Err()
+					case batch, ok := <-batches:
+						if !ok {
+							return nil
+						}
+						if err := p.saveBatch(gctx, batch); err != nil {
+							return err
+						}
+					case <-gctx.Done():
+						return gctx.Err()
 					}
 				}
-			}(pr))
+			})
 		}
 
 		// Wait for all goroutines to finish
-		if err := g.Wait(); err != nil {
+		err := g.Wait()
+		end(span, err)
+		if err != nil {
 			errc <- err
 		}
 	}()
 	return errc, nil
 }
 
-// SendToDB sends a Product type to a database.
-// It checks the cache first, looking up for the product ID.
-// If the ID already is in the cache, it will not visit database anymore.
+// saveBatch saves the products of a batch and acknowledges their lines.
+func (p *Pipeline) saveBatch(ctx context.Context, batch []*Record) error {
+	prs := make([]*dataflow.Product, len(batch))
+	for i, r := range batch {
+		prs[i] = r.Product
+	}
+
+	if err := p.SendBatchToDB(ctx, prs); err != nil {
+		return err
+	}
+	p.see(prs)
+
+	if p.SearchService != nil {
+		ctx, span := tracer.Start(ctx, "SearchService.IndexProducts")
+		err := p.SearchService.IndexProducts(ctx, prs)
+		end(span, err)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, r := range batch {
+		if err := p.ack(ctx, r.Line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SendBatchToDB sends a number of products to a database in one call.
+// Like SendToDB, it skips products whose fingerprint in the cache is unchanged,
+// and unlists changed products from the category or brand of their cache entry.
+// The cache is asked about all IDs at once, and updated at once.
+// If an ID occurs more than once in the batch, only its last product is written.
 // It is called by the method Save.
-func (p *Pipeline) SendToDB(ctx context.Context, pr *dataflow.Product) error {
+func (p *Pipeline) SendBatchToDB(ctx context.Context, prs []*dataflow.Product) (err error) {
+	if len(prs) == 0 {
+		return nil
+	}
+
+	ctx, span := tracer.Start(ctx, "Pipeline.SendBatchToDB", trace.WithAttributes(attribute.Int("pipeline.batch.size", len(prs))))
+	defer func() { end(span, err) }()
 
-	// Check cache if the ID is there.
-	ok, err := p.CacheService.Exists(context.TODO(), pr.ID)
+	// Keep the last product of each ID.
+	latest := make(map[uint32]int, len(prs))
+	for i, pr := range prs {
+		latest[pr.ID] = i
+	}
+	ids := make([]uint32, 0, len(latest))
+	for i, pr := range prs {
+		if latest[pr.ID] == i {
+			ids = append(ids, pr.ID)
+		}
+	}
+
+	cctx, cspan := tracer.Start(ctx, "Cache.GetMany")
+	entries, err := p.CacheService.GetMany(cctx, ids)
+	end(cspan, err)
 	if err != nil {
 		return err
 	}
 
-	// If the ID exists in the cache do nothing, just return.
-	if ok {
+	// Keep the products, that are new or changed, and the listings they moved from.
+	var inserted, updated, unchanged int64
+	changed := make([]*dataflow.Product, 0, len(ids))
+	fresh := make(map[uint32]string, len(ids))
+	moved := make(map[uint32]dataflow.ProductListing)
+	for i, id := range ids {
+		pr := prs[latest[id]]
+		fingerprint, prev := dataflow.ParseCacheEntry(entries[i])
+		switch fingerprint {
+		case pr.Fingerprint():
+			unchanged++
+			continue
+		case "":
+			inserted++
+		default:
+			updated++
+		}
+		changed = append(changed, pr)
+		fresh[id] = pr.CacheEntry()
+		if l := stale(prev, pr); l != (dataflow.ProductListing{}) {
+			moved[id] = l
+		}
+	}
+
+	span.SetAttributes(attribute.Int("pipeline.batch.changed", len(changed)))
+	if len(changed) > 0 {
+		// Save products in the DB.
+		dctx, dspan := tracer.Start(ctx, "ProductService.CreateProducts")
+		err := p.ProductService.CreateProducts(dctx, changed)
+		end(dspan, err)
+		if err != nil {
+			return err
+		}
+
+		// Remove moved products from their previous listings. The cache entries are
+		// saved afterwards, so a failure is retried with the next run.
+		if len(moved) > 0 {
+			dctx, dspan := tracer.Start(ctx, "ProductService.UnlistProducts")
+			err := p.ProductService.UnlistProducts(dctx, moved)
+			end(dspan, err)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Save the cache entries.
+		cctx, cspan := tracer.Start(ctx, "Cache.SetMany")
+		err = p.CacheService.SetMany(cctx, fresh)
+		end(cspan, err)
+		if err != nil {
+			return err
+		}
+	}
+
+	cacheHits.Add(float64(updated + unchanged))
+	cacheMisses.Add(float64(inserted))
+	dbWrites.WithLabelValues("upsert").Add(float64(len(changed)))
+	p.Stats.Inserted.Add(inserted)
+	p.Stats.Updated.Add(updated)
+	p.Stats.Unchanged.Add(unchanged)
+	return nil
+}
+
+// stale returns the fields of a previous listing, that a product moved from.
+// The other fields are empty.
+func stale(prev dataflow.ProductListing, pr *dataflow.Product) dataflow.ProductListing {
+	if prev.Category == pr.Category {
+		prev.Category = ""
+	}
+	if prev.Brand == pr.Brand {
+		prev.Brand = ""
+	}
+	return prev
+}
+
+// SendToDB sends a Product type to a database.
+// It checks the cache first, looking up for the fingerprint of the product ID.
+// If the fingerprint in the cache is unchanged, it will not visit database anymore.
+// It is called by the method Save.
+func (p *Pipeline) SendToDB(ctx context.Context, pr *dataflow.Product) (err error) {
+	ctx, span := tracer.Start(ctx, "Pipeline.SendToDB", trace.WithAttributes(attribute.Int64("product.id", int64(pr.ID))))
+	defer func() { end(span, err) }()
+
+	// Check cache for the fingerprint of the ID.
+	cctx, cspan := tracer.Start(ctx, "Cache.Get")
+	entry, err := p.CacheService.Get(cctx, pr.ID)
+	end(cspan, err)
+	if err != nil {
+		return err
+	}
+
+	// If the product is unchanged do nothing, just return.
+	cached, prev := dataflow.ParseCacheEntry(entry)
+	if cached == "" {
+		cacheMisses.Inc()
+	} else {
+		cacheHits.Inc()
+	}
+	if cached == pr.Fingerprint() {
+		p.Stats.Unchanged.Add(1)
 		return nil
 	}
 
-	// If the ID does not exist, save product in the DB.
-	err = p.ProductService.CreateProduct(context.TODO(), pr)
+	// If the product is new or changed, save product in the DB.
+	// CreateProducts replaces an existing product.
+	dctx, dspan := tracer.Start(ctx, "ProductService.CreateProducts")
+	err = p.ProductService.CreateProducts(dctx, []*dataflow.Product{pr})
+	end(dspan, err)
 	if err != nil {
 		return err
 	}
+	dbWrites.WithLabelValues("upsert").Inc()
+
+	// Remove a moved product from its previous listing.
+	if l := stale(prev, pr); l != (dataflow.ProductListing{}) {
+		dctx, dspan := tracer.Start(ctx, "ProductService.UnlistProducts")
+		err = p.ProductService.UnlistProducts(dctx, map[uint32]dataflow.ProductListing{pr.ID: l})
+		end(dspan, err)
+		if err != nil {
+			return err
+		}
+	}
 
-	// Save the ID it in the cache.
-	return p.CacheService.Set(context.TODO(), pr.ID)
+	// Save the entry in the cache.
+	cctx, cspan = tracer.Start(ctx, "Cache.Set")
+	err = p.CacheService.Set(cctx, pr.ID, pr.CacheEntry())
+	end(cspan, err)
+	if err != nil {
+		return err
+	}
 
+	if cached == "" {
+		p.Stats.Inserted.Add(1)
+	} else {
+		p.Stats.Updated.Add(1)
+	}
+	return nil
 }
 
 // Run setups and executes the pipeline. It constructs a list error channels out of
-// pipeline stage methods (LoadFiles, Split, ConvertJSON). After that it waits their executions.
+// pipeline stage methods (LoadFiles, Split, ConvertJSON, Batch, Save). After that it waits their executions.
 
-func (p *Pipeline) Run(ctx context.Context, paths ...string) error {
+func (p *Pipeline) Run(ctx context.Context, paths ...string) (err error) {
+	if p.Snapshot && p.Resume {
+		return dataflow.Errorf(dataflow.EINVALID, "snapshot mode can not be combined with resume")
+	}
+
+	// All stages are traced as children of the span of the run.
+	ctx, span := tracer.Start(ctx, "Pipeline.Run", trace.WithAttributes(attribute.Int("pipeline.sources", len(paths))))
+	defer func() { end(span, err) }()
 
+	// The stages run on a context of their own, that is canceled once they are done.
+	parent := ctx
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 	errcList := make([]<-chan error, 0)
@@ -207,46 +759,78 @@ func (p *Pipeline) Run(ctx context.Context, paths ...string) error {
 	lineCh, errc := p.Split(ctx, fileCh)
 	errcList = append(errcList, errc)
 
-	productCh, errc := p.ConvertJSON(ctx, lineCh)
+	recordCh, errc := p.ConvertJSON(ctx, lineCh)
 	errcList = append(errcList, errc)
 
+	// This stage groups records into batches.
+	batchCh := p.Batch(ctx, recordCh)
+
 	// This stage save Products into the DB and Cache.
-	errc, err = p.Save(ctx, productCh)
+	errc, err = p.Save(ctx, batchCh)
 	if err != nil {
 		return err
 	}
 
 	errcList = append(errcList, errc)
-	fmt.Println("Pipeline started. Waiting for pipeline to complete.")
-	fmt.Printf("Pipeline uses %d number of goroutines for interaction with DB\n", p.NumThreads)
-	return wait(ctx, errcList...)
+	p.logger().InfoContext(ctx, "pipeline started", "sources", len(paths), "threads", p.NumThreads)
+	err = wait(ctx, errcList...)
+
+	// Stop the remaining stages and wait until they are done,
+	// so no processed line is missing from the checkpoints.
+	cancel()
+	for _, c := range errcList {
+		for range c {
+		}
+	}
+
+	// Save the progress of all sources, even if the run is canceled.
+	if p.Checkpoints != nil {
+		if ferr := p.flush(context.WithoutCancel(ctx)); err == nil {
+			err = ferr
+		}
+	}
+
+	// Delete the products, that are missing from a complete snapshot.
+	if err == nil && p.Snapshot && p.Stats.Rejected.Load() == 0 {
+		err = p.DeleteMissing(parent)
+	}
+	return err
+}
+
+// end records the error of an operation, if any, and ends its span.
+func end(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
 }
 
 // merge merges a number of error channel, and merges into one channel.
+// The merged channel is closed after all input channels are closed.
 func merge(ctx context.Context, cs ...<-chan error) <-chan error {
 	out := make(chan error)
-	g, ctx := errgroup.WithContext(ctx)
+	var wg sync.WaitGroup
 
 	// Start goroutines for each error channel..
 	for _, c := range cs {
-		g.Go(func() error {
-			defer close(out)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
 			for err := range c {
 				select {
 				case out <- err:
 				case <-ctx.Done():
-					return ctx.Err()
+					return
 				}
 			}
-			return nil
-		})
+		}()
 	}
 
 	// Wait for all goroutines to finish.
 	go func() {
-		if err := g.Wait(); err != nil {
-			out <- err
-		}
+		wg.Wait()
+		close(out)
 	}()
 
 	return out
@@ -3,30 +3,29 @@ package pipeline_test
 import (
 	"bytes"
 	"context"
+	"io"
+	"maps"
 	"os"
 	"path/filepath"
+	"reflect"
 	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	dataflow "github.com/narslan/pipeline"
 	"github.com/narslan/pipeline/cassandra"
 	"github.com/narslan/pipeline/container"
+	"github.com/narslan/pipeline/file"
+	"github.com/narslan/pipeline/inmem"
+	"github.com/narslan/pipeline/mock"
 	"github.com/narslan/pipeline/pipeline"
 	"github.com/narslan/pipeline/redis"
 )
 
-// FileReader represents a file reader for local filesytem. It mimicks the S3FetchService.
-// It is used just for testing.
-type FileReader struct{}
-
-// Ensure that S3FetchService implements dataflow.Fetch.
-var _ dataflow.Fetch = (*FileReader)(nil)
-
-// Get method reads a local file and return data of the file as byte slice.
-func (s *FileReader) Get(ctx context.Context, path string) ([]byte, error) {
-	return os.ReadFile(path)
-}
-
 // Assign how many worker goroutines for the pipeline should use.
 var n = runtime.NumCPU()
 
@@ -48,19 +47,28 @@ func TestLoadFiles(t *testing.T) {
 			t.Run(path, func(t *testing.T) {
 
 				// The pipeline needs a fetcher.
-				f := &FileReader{}
+				f := file.NewFetchService()
 
 				// Provide reader and the name of the file to the pipeline.
 				pipe := pipeline.NewPipeline(f, n)
 
-				// Read JSONL files and return them as a channel of byte slice.
+				// Open JSONL files and return them as a channel of sources.
 				fileCh, _, err := pipe.LoadFiles(context.TODO(), path)
 				if err != nil {
 					t.Fatal(err)
 				}
 
 				// Step through the channel, capture the content of the files.
-				for got := range fileCh {
+				for src := range fileCh {
+					got, err := io.ReadAll(src.Body)
+					if err != nil {
+						t.Fatal(err)
+					}
+					src.Body.Close()
+
+					if src.Key != path {
+						t.Fatalf("key mismatch; expected %q, got %q", path, src.Key)
+					}
 
 					// Load local file for comparison.
 					want, err := os.ReadFile(path)
@@ -80,7 +88,7 @@ func TestLoadFiles(t *testing.T) {
 		// Ensure that without a input source error returns.
 		// Assign how many worker goroutines for the pipeline.
 		n := runtime.NumCPU()
-		f := &FileReader{}
+		f := file.NewFetchService()
 
 		// Provide reader and no file.
 		// Provide reader and the name of the file to the pipeline.
@@ -113,7 +121,7 @@ func TestSplitFiles(t *testing.T) {
 	want := 5000
 
 	// The pipeline needs a fetcher.
-	f := &FileReader{}
+	f := file.NewFetchService()
 
 	// Context for pipeline methods.
 	ctx := context.Background()
@@ -121,7 +129,7 @@ func TestSplitFiles(t *testing.T) {
 	// Provide reader and the name of the file to the pipeline.
 	pipe := pipeline.NewPipeline(f, n)
 
-	// Read JSONL files and return them as a channel of byte slice.
+	// Open JSONL files and return them as a channel of sources.
 	fileCh, _, err := pipe.LoadFiles(context.TODO(), paths...)
 
 	if err != nil {
@@ -143,6 +151,61 @@ func TestSplitFiles(t *testing.T) {
 	}
 }
 
+// lineStream generates JSONL lines on the fly, without holding them in memory.
+type lineStream struct {
+	n, lines int
+	buf      []byte
+}
+
+// Read implements io.Reader.
+func (s *lineStream) Read(p []byte) (int, error) {
+	for len(s.buf) < len(p) && s.n < s.lines {
+		s.buf = append(s.buf, `{"id": 1, "title": "title1", "price": 1.0, "category": "c", "brand": "b"}`+"\n"...)
+		s.n++
+	}
+	if len(s.buf) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, s.buf)
+	s.buf = s.buf[n:]
+	return n, nil
+}
+
+// StreamReader represents a fetcher that generates a number of lines per source.
+type StreamReader struct {
+	Lines int
+}
+
+// Open method returns a generated stream of lines.
+func (s *StreamReader) Open(ctx context.Context, path string) (io.ReadCloser, error) {
+	return io.NopCloser(&lineStream{lines: s.Lines}), nil
+}
+
+func TestSplitStream(t *testing.T) {
+	// Ensure that large sources are scanned straight off the stream.
+	f := &StreamReader{Lines: 200000}
+	pipe := pipeline.NewPipeline(f, n)
+
+	fileCh, _, err := pipe.LoadFiles(context.TODO(), "a", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	linesCh, errCh := pipe.Split(context.TODO(), fileCh)
+
+	var got int
+	for range linesCh {
+		got++
+	}
+	if err := <-errCh; err != nil {
+		t.Fatal(err)
+	}
+
+	if want := 2 * f.Lines; got != want {
+		t.Fatalf("content mismatch; expected %d, got %d", want, got)
+	}
+}
+
 func TestConvertLine(t *testing.T) {
 	// Ensure that json lines are converted into Product entities.
 
@@ -157,14 +220,14 @@ func TestConvertLine(t *testing.T) {
 	want := 5000
 
 	// The pipeline needs a fetcher.
-	f := &FileReader{}
+	f := file.NewFetchService()
 	// Context for pipeline methods.
 	ctx := context.Background()
 
 	// Provide reader and the path of the files to the pipeline.
 	pipe := pipeline.NewPipeline(f, n)
 
-	// Read JSONL files and return them as a channel of byte slice.
+	// Open JSONL files and return them as a channel of sources.
 	fileCh, _, err := pipe.LoadFiles(context.TODO(), paths...)
 
 	if err != nil {
@@ -180,7 +243,7 @@ func TestConvertLine(t *testing.T) {
 	// A container for the output of the pipeline.
 	products := make([]*dataflow.Product, 0)
 	for v := range convertCh {
-		products = append(products, v)
+		products = append(products, v.Product)
 	}
 
 	got := len(products)
@@ -223,8 +286,8 @@ func TestRunPipeline(t *testing.T) {
 	// Pass redis instance to the IDCacheService.
 	idcs := redis.NewIDCacheService(cache)
 
-	// Make an instance of FileReader.
-	f := &FileReader{}
+	// Make an instance of the local file fetcher.
+	f := file.NewFetchService()
 
 	// Make a pipeline from file reader and pathnames.
 	pipe := pipeline.NewPipeline(f, n)
@@ -262,3 +325,603 @@ func TestRunPipeline(t *testing.T) {
 	}
 
 }
+
+// DeadLetterSink represents an in-memory dead-letter sink. It is used just for testing.
+type DeadLetterSink struct {
+	mu      sync.Mutex
+	Letters []*dataflow.DeadLetter
+}
+
+// Put stores the rejected record.
+func (s *DeadLetterSink) Put(ctx context.Context, d *dataflow.DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Letters = append(s.Letters, d)
+	return nil
+}
+
+func TestConvertLine_DeadLetter(t *testing.T) {
+	// The file has three malformed or invalid lines out of six.
+	path := filepath.Join("testdata", "malformed", "products-bad.jsonl")
+
+	// Ensure rejected lines are sent to the sink and the run keeps going.
+	t.Run("OK", func(t *testing.T) {
+		sink := &DeadLetterSink{}
+		pipe := pipeline.NewPipeline(file.NewFetchService(), n)
+		pipe.DeadLetters = sink
+		pipe.ErrorBudget = 3
+
+		ctx := context.Background()
+		fileCh, _, err := pipe.LoadFiles(ctx, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		linesCh, _ := pipe.Split(ctx, fileCh)
+		convertCh, errCh := pipe.ConvertJSON(ctx, linesCh)
+
+		var ids []uint32
+		for r := range convertCh {
+			ids = append(ids, r.Product.ID)
+		}
+		if err := <-errCh; err != nil {
+			t.Fatal(err)
+		}
+
+		if want := []uint32{1, 3, 6}; !reflect.DeepEqual(ids, want) {
+			t.Fatalf("products mismatch; expected %v, got %v", want, ids)
+		}
+
+		var lines []int64
+		for _, d := range sink.Letters {
+			if d.Source != path {
+				t.Fatalf("source mismatch; expected %q, got %q", path, d.Source)
+			}
+			lines = append(lines, d.Line)
+		}
+		if want := []int64{2, 4, 5}; !reflect.DeepEqual(lines, want) {
+			t.Fatalf("lines mismatch; expected %v, got %v", want, lines)
+		}
+
+		if got, want := sink.Letters[1].Error, "ID must be greater than 0."; got != want {
+			t.Fatalf("error mismatch; expected %q, got %q", want, got)
+		}
+		if got := pipe.Stats.Rejected.Load(); got != 3 {
+			t.Fatalf("rejected mismatch; expected 3, got %d", got)
+		}
+	})
+
+	// Ensure the run fails once the error budget is used up.
+	t.Run("ErrBudgetExceeded", func(t *testing.T) {
+		pipe := pipeline.NewPipeline(file.NewFetchService(), n)
+		pipe.ErrorBudget = 2
+
+		ctx := context.Background()
+		fileCh, _, err := pipe.LoadFiles(ctx, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		linesCh, _ := pipe.Split(ctx, fileCh)
+		convertCh, errCh := pipe.ConvertJSON(ctx, linesCh)
+
+		for range convertCh {
+		}
+		if err := <-errCh; dataflow.ErrorCode(err) != dataflow.EINVALID {
+			t.Fatalf("unexpected error: %#v", err)
+		}
+	})
+
+	// Ensure a line longer than MaxLineSize is rejected, and the lines after it are read.
+	t.Run("LineTooLong", func(t *testing.T) {
+		var buf bytes.Buffer
+		buf.WriteString(`{"id":1,"title":"title1","price":1,"category":"bilgisayar","brand":"brand1"}` + "\n")
+		buf.WriteString(`{"id":2,"title":"` + strings.Repeat("x", pipeline.MaxLineSize) + `"}` + "\n")
+		buf.WriteString(`{"id":3,"title":"title3","price":1,"category":"bilgisayar","brand":"brand1"}` + "\n")
+		path := filepath.Join(t.TempDir(), "products-long.jsonl")
+		if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		sink := &DeadLetterSink{}
+		pipe := pipeline.NewPipeline(file.NewFetchService(), n)
+		pipe.DeadLetters = sink
+		pipe.ErrorBudget = 1
+
+		ctx := context.Background()
+		fileCh, _, err := pipe.LoadFiles(ctx, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		linesCh, splitErrCh := pipe.Split(ctx, fileCh)
+		convertCh, errCh := pipe.ConvertJSON(ctx, linesCh)
+
+		var records []*pipeline.Record
+		for r := range convertCh {
+			records = append(records, r)
+		}
+		if err := <-errCh; err != nil {
+			t.Fatal(err)
+		} else if err := <-splitErrCh; err != nil {
+			t.Fatal(err)
+		}
+
+		if len(records) != 2 || records[0].Product.ID != 1 || records[1].Product.ID != 3 {
+			t.Fatalf("unexpected records: %v", records)
+		} else if got, want := records[1].End, int64(buf.Len()); got != want {
+			t.Fatalf("end mismatch; expected %d, got %d", want, got)
+		}
+
+		if len(sink.Letters) != 1 {
+			t.Fatalf("expected 1 dead letter, got %d", len(sink.Letters))
+		} else if d := sink.Letters[0]; d.Source != path || d.Line != 2 || !strings.HasPrefix(d.Error, "Line too long") {
+			t.Fatalf("unexpected dead letter: %#v", d)
+		}
+		if got := pipe.Stats.Rejected.Load(); got != 1 {
+			t.Fatalf("rejected mismatch; expected 1, got %d", got)
+		}
+	})
+}
+
+func TestRunPipeline_Resume(t *testing.T) {
+	// Ensure that a resumed run continues after the last processed line.
+	// Compressed sources are read from the beginning and skip processed lines.
+	for _, path := range []string{
+		filepath.Join("testdata", "products-1.jsonl"),
+		filepath.Join("testdata", "compressed", "products-1.jsonl.gz"),
+	} {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			testRunPipelineResume(t, path)
+		})
+	}
+}
+
+// testRunPipelineResume runs a pipeline, that crashes on path, and resumes it.
+// The source must contain products-1.jsonl.
+func testRunPipelineResume(t *testing.T, path string) {
+	// The file has 1000 lines, with ids starting at 151000.
+	first := uint32(151000)
+
+	checkpoints, err := file.NewCheckpointService(filepath.Join(t.TempDir(), "checkpoints.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The cache never knows about any product.
+	cache := &mock.Cache{
+		GetManyFn: func(ctx context.Context, ids []uint32) ([]string, error) { return make([]string, len(ids)), nil },
+		SetManyFn: func(ctx context.Context, fingerprints map[uint32]string) error { return nil },
+	}
+
+	// newPipeline returns a pipeline, that saves each product with fn.
+	newPipeline := func(fn func(ctx context.Context, p *dataflow.Product) error) *pipeline.Pipeline {
+		pipe := pipeline.NewPipeline(file.NewFetchService(), n)
+		pipe.ProductService = &mock.ProductService{CreateProductsFn: func(ctx context.Context, ps []*dataflow.Product) error {
+			for _, p := range ps {
+				if err := fn(ctx, p); err != nil {
+					return err
+				}
+			}
+			return nil
+		}}
+		pipe.CacheService = cache
+		pipe.Checkpoints = checkpoints
+		pipe.Resume = true
+		return pipe
+	}
+
+	// The first run crashes at the batch of line 501.
+	pipe := newPipeline(func(ctx context.Context, p *dataflow.Product) error {
+		if p.ID == first+500 {
+			return dataflow.Errorf(dataflow.EINTERNAL, "crash")
+		}
+		return nil
+	})
+	if err := pipe.Run(context.Background(), path); err == nil {
+		t.Fatal("expected error")
+	}
+
+	cp, err := checkpoints.FindCheckpoint(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	} else if cp.Status != dataflow.CheckpointRunning || cp.Line > 500 {
+		t.Fatalf("unexpected checkpoint: %#v", cp)
+	}
+
+	// The second run starts right after the checkpoint.
+	var created, min atomic.Int64
+	min.Store(int64(first) + 1000)
+	pipe = newPipeline(func(ctx context.Context, p *dataflow.Product) error {
+		created.Add(1)
+		for {
+			m := min.Load()
+			if int64(p.ID) >= m || min.CompareAndSwap(m, int64(p.ID)) {
+				return nil
+			}
+		}
+	})
+	if err := pipe.Run(context.Background(), path); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := created.Load(), 1000-cp.Line; got != want {
+		t.Fatalf("created mismatch; expected %d, got %d", want, got)
+	} else if got, want := min.Load(), int64(first)+cp.Line; got != want {
+		t.Fatalf("first id mismatch; expected %d, got %d", want, got)
+	}
+
+	if cp, err := checkpoints.FindCheckpoint(context.Background(), path); err != nil {
+		t.Fatal(err)
+	} else if cp.Status != dataflow.CheckpointComplete || cp.Line != 1000 {
+		t.Fatalf("unexpected checkpoint: %#v", cp)
+	}
+
+	// The third run skips the complete source.
+	pipe = newPipeline(func(ctx context.Context, p *dataflow.Product) error {
+		t.Fatalf("unexpected product: %d", p.ID)
+		return nil
+	})
+	if err := pipe.Run(context.Background(), path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// statStreamReader represents a fetcher of generated streams with fixed metadata,
+// that fails to open streams at an offset.
+type statStreamReader struct {
+	StreamReader
+	Info dataflow.ObjectInfo
+}
+
+// Stat returns the fixed metadata of a stream.
+func (s *statStreamReader) Stat(ctx context.Context, path string) (*dataflow.ObjectInfo, error) {
+	info := s.Info
+	return &info, nil
+}
+
+// OpenAt fails, like a range request past the end of a stream with an unknown size.
+func (s *statStreamReader) OpenAt(ctx context.Context, path string, offset int64) (io.ReadCloser, error) {
+	return nil, dataflow.Errorf(dataflow.EINVALID, "range not satisfiable")
+}
+
+func TestRunPipeline_ResumeWithoutMetadata(t *testing.T) {
+	// Ensure sources, whose change can not be detected, are read from the beginning,
+	// instead of being resumed at the offset of a checkpoint.
+	for _, tt := range []struct {
+		name    string
+		fetcher dataflow.StreamFetch
+	}{
+		{"NoStat", &StreamReader{Lines: 10}},
+		{"NoSize", &statStreamReader{StreamReader: StreamReader{Lines: 10}, Info: dataflow.ObjectInfo{ETag: "abc"}}},
+		{"NoETag", &statStreamReader{StreamReader: StreamReader{Lines: 10}, Info: dataflow.ObjectInfo{Size: 740}}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			checkpoints, err := file.NewCheckpointService(filepath.Join(t.TempDir(), "checkpoints.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The previous checkpoint has the same empty metadata, that the fetcher reports.
+			info := dataflow.ObjectInfo{}
+			if f, ok := tt.fetcher.(*statStreamReader); ok {
+				info = f.Info
+			}
+			if err := checkpoints.SaveCheckpoint(context.Background(), &dataflow.Checkpoint{
+				Key: "a", ETag: info.ETag, Size: info.Size, Line: 5, Offset: 370, Status: dataflow.CheckpointRunning,
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			var created atomic.Int64
+			pipe := pipeline.NewPipeline(tt.fetcher, n)
+			pipe.ProductService = &mock.ProductService{CreateProductsFn: func(ctx context.Context, ps []*dataflow.Product) error {
+				created.Add(int64(len(ps)))
+				return nil
+			}}
+			pipe.CacheService = &mock.Cache{
+				GetManyFn: func(ctx context.Context, ids []uint32) ([]string, error) { return make([]string, len(ids)), nil },
+				SetManyFn: func(ctx context.Context, fingerprints map[uint32]string) error { return nil },
+			}
+			pipe.Checkpoints = checkpoints
+			pipe.Resume = true
+
+			// The lines have the same ID, so each batch holds a single line to count them.
+			pipe.BatchSize = 1
+
+			if err := pipe.Run(context.Background(), "a"); err != nil {
+				t.Fatal(err)
+			} else if got := created.Load(); got != 10 {
+				t.Fatalf("created mismatch; expected 10, got %d", got)
+			}
+
+			if cp, err := checkpoints.FindCheckpoint(context.Background(), "a"); err != nil {
+				t.Fatal(err)
+			} else if cp.Status != dataflow.CheckpointComplete || cp.Line != 10 {
+				t.Fatalf("unexpected checkpoint: %#v", cp)
+			}
+		})
+	}
+}
+
+func TestSplitCompressed(t *testing.T) {
+	// Ensure that compressed sources are decompressed transparently.
+	// The format is detected by extension, or by magic bytes for products-3.data.
+	paths, err := filepath.Glob(filepath.Join("testdata", "compressed", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Those files has 6000 lines in total.
+	want := 6000
+
+	pipe := pipeline.NewPipeline(file.NewFetchService(), n)
+
+	fileCh, _, err := pipe.LoadFiles(context.TODO(), paths...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	linesCh, _ := pipe.Split(context.TODO(), fileCh)
+	convertCh, errCh := pipe.ConvertJSON(context.TODO(), linesCh)
+
+	var got int
+	for range convertCh {
+		got++
+	}
+	if err := <-errCh; err != nil {
+		t.Fatal(err)
+	}
+
+	if got != want {
+		t.Fatalf("content mismatch; expected %d, got %d", want, got)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	// Ensure that records are grouped into batches of BatchSize.
+	t.Run("Size", func(t *testing.T) {
+		pipe := pipeline.NewPipeline(file.NewFetchService(), n)
+		pipe.BatchSize = 100
+		pipe.BatchLinger = time.Hour
+
+		input := make(chan *pipeline.Record)
+		go func() {
+			defer close(input)
+			for i := range 250 {
+				input <- &pipeline.Record{Line: &pipeline.Line{Number: int64(i + 1)}}
+			}
+		}()
+
+		var sizes []int
+		for batch := range pipe.Batch(context.Background(), input) {
+			sizes = append(sizes, len(batch))
+		}
+		if want := []int{100, 100, 50}; !reflect.DeepEqual(sizes, want) {
+			t.Fatalf("sizes mismatch; expected %v, got %v", want, sizes)
+		}
+	})
+
+	// Ensure that a partial batch is sent after BatchLinger.
+	t.Run("Linger", func(t *testing.T) {
+		pipe := pipeline.NewPipeline(file.NewFetchService(), n)
+		pipe.BatchSize = 100
+		pipe.BatchLinger = 10 * time.Millisecond
+
+		input := make(chan *pipeline.Record)
+		defer close(input)
+		batchCh := pipe.Batch(context.Background(), input)
+
+		for i := range 3 {
+			input <- &pipeline.Record{Line: &pipeline.Line{Number: int64(i + 1)}}
+		}
+
+		select {
+		case batch := <-batchCh:
+			if len(batch) != 3 {
+				t.Fatalf("expected 3 records, got %d", len(batch))
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for batch")
+		}
+	})
+}
+
+func TestSendBatchToDB(t *testing.T) {
+	// Ensure that only new and changed products are written, and that they are counted.
+	t.Run("OK", func(t *testing.T) {
+		// The cache keeps fingerprints in a map.
+		fingerprints := make(map[uint32]string)
+		cache := &mock.Cache{
+			GetManyFn: func(ctx context.Context, ids []uint32) ([]string, error) {
+				a := make([]string, len(ids))
+				for i, id := range ids {
+					a[i] = fingerprints[id]
+				}
+				return a, nil
+			},
+			SetManyFn: func(ctx context.Context, m map[uint32]string) error {
+				maps.Copy(fingerprints, m)
+				return nil
+			},
+		}
+
+		var written []uint32
+		pipe := pipeline.NewPipeline(file.NewFetchService(), n)
+		pipe.CacheService = cache
+		pipe.ProductService = &mock.ProductService{CreateProductsFn: func(ctx context.Context, ps []*dataflow.Product) error {
+			for _, p := range ps {
+				written = append(written, p.ID)
+			}
+			return nil
+		}}
+
+		prs := []*dataflow.Product{
+			{ID: 1, Title: "title1", Price: 10, Category: "bilgisayar", Brand: "brand1"},
+			{ID: 2, Title: "title2", Price: 20, Category: "bilgisayar", Brand: "brand1"},
+		}
+		if err := pipe.SendBatchToDB(context.Background(), prs); err != nil {
+			t.Fatal(err)
+		}
+
+		// Send the products again, with a changed price of the second one.
+		changed := *prs[1]
+		changed.Price = 25
+		if err := pipe.SendBatchToDB(context.Background(), []*dataflow.Product{prs[0], &changed}); err != nil {
+			t.Fatal(err)
+		}
+
+		if want := []uint32{1, 2, 2}; !reflect.DeepEqual(written, want) {
+			t.Fatalf("written mismatch; expected %v, got %v", want, written)
+		}
+		if got := pipe.Stats.Inserted.Load(); got != 2 {
+			t.Fatalf("expected 2 inserted, got %d", got)
+		} else if got := pipe.Stats.Updated.Load(); got != 1 {
+			t.Fatalf("expected 1 updated, got %d", got)
+		} else if got := pipe.Stats.Unchanged.Load(); got != 1 {
+			t.Fatalf("expected 1 unchanged, got %d", got)
+		}
+	})
+
+	// Ensure a product, that moved to another category, is removed from the previous one.
+	t.Run("Moved", func(t *testing.T) {
+		pr := &dataflow.Product{ID: 1, Title: "title1", Price: 10, Category: "bilgisayar", Brand: "brand1"}
+		prev := *pr
+		prev.Category = "telefon"
+
+		// Entries cached before the listing hold only a fingerprint, which lists the product nowhere.
+		entries := map[uint32]string{1: prev.CacheEntry(), 2: "stale"}
+		cache := &mock.Cache{
+			GetManyFn: func(ctx context.Context, ids []uint32) ([]string, error) {
+				a := make([]string, len(ids))
+				for i, id := range ids {
+					a[i] = entries[id]
+				}
+				return a, nil
+			},
+			SetManyFn: func(ctx context.Context, m map[uint32]string) error {
+				maps.Copy(entries, m)
+				return nil
+			},
+		}
+
+		var unlisted map[uint32]dataflow.ProductListing
+		pipe := pipeline.NewPipeline(file.NewFetchService(), n)
+		pipe.CacheService = cache
+		pipe.ProductService = &mock.ProductService{
+			CreateProductsFn: func(ctx context.Context, ps []*dataflow.Product) error { return nil },
+			UnlistProductsFn: func(ctx context.Context, prev map[uint32]dataflow.ProductListing) error {
+				unlisted = prev
+				return nil
+			},
+		}
+
+		other := &dataflow.Product{ID: 2, Title: "title2", Price: 20, Category: "bilgisayar", Brand: "brand1"}
+		if err := pipe.SendBatchToDB(context.Background(), []*dataflow.Product{pr, other}); err != nil {
+			t.Fatal(err)
+		}
+
+		if want := map[uint32]dataflow.ProductListing{1: {Category: "telefon"}}; !reflect.DeepEqual(unlisted, want) {
+			t.Fatalf("unlisted mismatch; expected %v, got %v", want, unlisted)
+		} else if fingerprint, listing := dataflow.ParseCacheEntry(entries[1]); fingerprint != pr.Fingerprint() || listing.Category != "bilgisayar" {
+			t.Fatalf("unexpected cache entry: %q", entries[1])
+		}
+	})
+}
+
+func TestRunPipeline_Snapshot(t *testing.T) {
+	// newPipeline returns a snapshot pipeline on products, that have the IDs 1, 2, 3 and 151000.
+	// Deleted IDs are recorded in deleted, IDs removed from the cache in uncached.
+	newPipeline := func(deleted, uncached *[]uint32) *pipeline.Pipeline {
+		var mu sync.Mutex
+		pipe := pipeline.NewPipeline(file.NewFetchService(), n)
+		pipe.Snapshot = true
+		pipe.ErrorBudget = -1
+		pipe.ProductService = &mock.ProductService{
+			CreateProductsFn: func(ctx context.Context, ps []*dataflow.Product) error { return nil },
+			FindProductIDsFn: func(ctx context.Context) ([]uint32, error) { return []uint32{1, 2, 3, 151000}, nil },
+			DeleteProductFn: func(ctx context.Context, id uint32) error {
+				mu.Lock()
+				defer mu.Unlock()
+				*deleted = append(*deleted, id)
+				return nil
+			},
+		}
+		pipe.CacheService = &mock.Cache{
+			GetManyFn: func(ctx context.Context, ids []uint32) ([]string, error) { return make([]string, len(ids)), nil },
+			SetManyFn: func(ctx context.Context, fingerprints map[uint32]string) error { return nil },
+			DeleteManyFn: func(ctx context.Context, ids []uint32) error {
+				mu.Lock()
+				defer mu.Unlock()
+				*uncached = append(*uncached, ids...)
+				return nil
+			},
+		}
+		return pipe
+	}
+
+	// Ensure that products missing from the sources are deleted from the DB and the cache.
+	t.Run("OK", func(t *testing.T) {
+		var deleted, uncached []uint32
+		pipe := newPipeline(&deleted, &uncached)
+		if err := pipe.Run(context.Background(), filepath.Join("testdata", "products-1.jsonl")); err != nil {
+			t.Fatal(err)
+		}
+
+		slices.Sort(deleted)
+		slices.Sort(uncached)
+		if want := []uint32{1, 2, 3}; !reflect.DeepEqual(deleted, want) {
+			t.Fatalf("deleted mismatch; expected %v, got %v", want, deleted)
+		} else if !reflect.DeepEqual(uncached, want) {
+			t.Fatalf("uncached mismatch; expected %v, got %v", want, uncached)
+		} else if got := pipe.Stats.Deleted.Load(); got != 3 {
+			t.Fatalf("expected 3 deleted, got %d", got)
+		}
+	})
+
+	// Ensure that nothing is deleted, if lines were rejected.
+	t.Run("Rejected", func(t *testing.T) {
+		var deleted, uncached []uint32
+		pipe := newPipeline(&deleted, &uncached)
+		if err := pipe.Run(context.Background(), filepath.Join("testdata", "malformed", "products-bad.jsonl")); err != nil {
+			t.Fatal(err)
+		}
+		if len(deleted) != 0 || len(uncached) != 0 {
+			t.Fatalf("expected no deletion, got %v and %v", deleted, uncached)
+		}
+	})
+
+	// Ensure that snapshot mode can not be resumed.
+	t.Run("ErrResume", func(t *testing.T) {
+		var deleted, uncached []uint32
+		pipe := newPipeline(&deleted, &uncached)
+		pipe.Resume = true
+		if err := pipe.Run(context.Background(), filepath.Join("testdata", "products-1.jsonl")); dataflow.ErrorCode(err) != dataflow.EINVALID {
+			t.Fatalf("unexpected error: %#v", err)
+		}
+	})
+}
+
+func TestRunPipeline_Search(t *testing.T) {
+	// Ensure that saved products are added to the search index.
+	t.Run("OK", func(t *testing.T) {
+		index := inmem.NewSearchIndex()
+		pipe := pipeline.NewPipeline(file.NewFetchService(), n)
+		pipe.SearchService = index
+		pipe.ErrorBudget = -1
+		pipe.ProductService = &mock.ProductService{
+			CreateProductsFn: func(ctx context.Context, ps []*dataflow.Product) error { return nil },
+		}
+		pipe.CacheService = &mock.Cache{
+			GetManyFn: func(ctx context.Context, ids []uint32) ([]string, error) { return make([]string, len(ids)), nil },
+			SetManyFn: func(ctx context.Context, fingerprints map[uint32]string) error { return nil },
+		}
+
+		if err := pipe.Run(context.Background(), filepath.Join("testdata", "malformed", "products-bad.jsonl")); err != nil {
+			t.Fatal(err)
+		}
+
+		ps, _, err := index.SearchProducts(context.Background(), dataflow.SearchFilter{Query: "title3"})
+		if err != nil {
+			t.Fatal(err)
+		} else if len(ps) != 1 || ps[0].ID != 3 {
+			t.Fatalf("unexpected products: %v", ps)
+		}
+	})
+}
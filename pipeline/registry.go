@@ -0,0 +1,138 @@
+package pipeline
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/narslan/pipeline"
+)
+
+// Ensure that FetchRegistry implements the fetch interfaces.
+var _ dataflow.StreamFetch = (*FetchRegistry)(nil)
+var _ dataflow.StatFetch = (*FetchRegistry)(nil)
+var _ dataflow.RangeFetch = (*FetchRegistry)(nil)
+var _ dataflow.ListFetch = (*FetchRegistry)(nil)
+
+// FetchRegistry picks a fetcher by the URI scheme of a source, like s3, file or https.
+// Sources without a scheme are passed to the fetcher registered for the empty scheme.
+// The full source is passed to the fetcher, so a single run can mix schemes.
+type FetchRegistry struct {
+	fetchers map[string]dataflow.StreamFetch
+}
+
+// NewFetchRegistry returns a new instance of FetchRegistry.
+func NewFetchRegistry() *FetchRegistry {
+	return &FetchRegistry{fetchers: make(map[string]dataflow.StreamFetch)}
+}
+
+// Register binds a fetcher to a scheme. It replaces a previously registered fetcher.
+func (r *FetchRegistry) Register(scheme string, f dataflow.StreamFetch) {
+	r.fetchers[strings.ToLower(scheme)] = f
+}
+
+// Open opens a source with the fetcher of its scheme.
+func (r *FetchRegistry) Open(ctx context.Context, url string) (io.ReadCloser, error) {
+	f, err := r.lookup(url)
+	if err != nil {
+		return nil, err
+	}
+	return f.Open(ctx, url)
+}
+
+// OpenAt opens a source at offset with the fetcher of its scheme.
+// If the fetcher can not open at an offset, the leading bytes are discarded.
+func (r *FetchRegistry) OpenAt(ctx context.Context, url string, offset int64) (io.ReadCloser, error) {
+	f, err := r.lookup(url)
+	if err != nil {
+		return nil, err
+	}
+
+	if f, ok := f.(dataflow.RangeFetch); ok {
+		return f.OpenAt(ctx, url, offset)
+	}
+
+	body, err := f.Open(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.CopyN(io.Discard, body, offset); err != nil {
+		body.Close()
+		return nil, err
+	}
+	return body, nil
+}
+
+// Stat retrieves the metadata of a source with the fetcher of its scheme.
+// Empty metadata is returned, if the fetcher can not report it.
+func (r *FetchRegistry) Stat(ctx context.Context, url string) (*dataflow.ObjectInfo, error) {
+	f, err := r.lookup(url)
+	if err != nil {
+		return nil, err
+	}
+
+	if f, ok := f.(dataflow.StatFetch); ok {
+		return f.Stat(ctx, url)
+	}
+	return &dataflow.ObjectInfo{Key: url}, nil
+}
+
+// List returns the sources matching a pattern with the fetcher of its scheme.
+// Returns EINVALID, if the fetcher can not list sources.
+func (r *FetchRegistry) List(ctx context.Context, pattern string) ([]string, error) {
+	f, err := r.lookup(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	l, ok := f.(dataflow.ListFetch)
+	if !ok {
+		return nil, dataflow.Errorf(dataflow.EINVALID, "listing is not supported for %q", pattern)
+	}
+	return l.List(ctx, pattern)
+}
+
+// CanList reports whether the fetcher of the scheme of url can list sources.
+func (r *FetchRegistry) CanList(url string) bool {
+	f, err := r.lookup(url)
+	if err != nil {
+		return false
+	}
+	_, ok := f.(dataflow.ListFetch)
+	return ok
+}
+
+// lookup returns the fetcher registered for the scheme of url.
+func (r *FetchRegistry) lookup(url string) (dataflow.StreamFetch, error) {
+	scheme := Scheme(url)
+	f, ok := r.fetchers[scheme]
+	if !ok {
+		return nil, dataflow.Errorf(dataflow.EINVALID, "no fetcher registered for scheme %q of %q", scheme, url)
+	}
+	return f, nil
+}
+
+// Scheme returns the lower-cased URI scheme of a source, or an empty string if it has none.
+func Scheme(url string) string {
+	scheme, _, ok := strings.Cut(url, "://")
+	if !ok {
+		return ""
+	}
+	return strings.ToLower(scheme)
+}
+
+// IsPattern reports whether a source is a glob pattern or a prefix ending with '/'.
+// Only the path of a URL is checked, so a query string like "?page=1" is not taken for a glob.
+// A '?' in a URL always starts its query. Single character globs are only supported in sources without a scheme.
+func IsPattern(src string) bool {
+	path := src
+	if Scheme(src) != "" {
+		u, err := url.Parse(src)
+		if err != nil {
+			return false
+		}
+		path = u.Path
+	}
+	return strings.ContainsAny(path, `*?[`) || strings.HasSuffix(path, "/")
+}
@@ -0,0 +1,118 @@
+package pipeline_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"path/filepath"
+	"testing"
+
+	dataflow "github.com/narslan/pipeline"
+	"github.com/narslan/pipeline/file"
+	"github.com/narslan/pipeline/pipeline"
+)
+
+func TestFetchRegistry(t *testing.T) {
+	r := pipeline.NewFetchRegistry()
+	r.Register("file", file.NewFetchService())
+	r.Register("gen", &StreamReader{Lines: 3})
+
+	path, err := filepath.Abs(filepath.Join("testdata", "products-1.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Ensure sources of different schemes flow through one pipeline.
+	t.Run("Mixed", func(t *testing.T) {
+		pipe := pipeline.NewPipeline(r, n)
+
+		fileCh, _, err := pipe.LoadFiles(context.TODO(), "file://"+path, "gen://a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		linesCh, _ := pipe.Split(context.TODO(), fileCh)
+
+		var got int
+		for range linesCh {
+			got++
+		}
+		if want := 1003; got != want {
+			t.Fatalf("content mismatch; expected %d, got %d", want, got)
+		}
+	})
+
+	// Ensure the offset is skipped for fetchers without range support.
+	t.Run("OpenAt", func(t *testing.T) {
+		body, err := r.Open(context.TODO(), "gen://a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := io.ReadAll(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body, err = r.OpenAt(context.TODO(), "gen://a", 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer body.Close()
+
+		if got, err := io.ReadAll(body); err != nil {
+			t.Fatal(err)
+		} else if !bytes.Equal(got, want[10:]) {
+			t.Fatalf("content mismatch: %q", got)
+		}
+	})
+
+	// Ensure an error is returned for an unknown scheme.
+	t.Run("ErrUnknownScheme", func(t *testing.T) {
+		if _, err := r.Open(context.TODO(), "ftp://host/products-1.jsonl"); dataflow.ErrorCode(err) != dataflow.EINVALID {
+			t.Fatalf("unexpected error: %#v", err)
+		}
+	})
+
+	// Ensure only fetchers, that implement ListFetch, can list.
+	t.Run("CanList", func(t *testing.T) {
+		if !r.CanList("file:///tmp/*.jsonl") {
+			t.Fatal("expected file fetcher to list")
+		} else if r.CanList("gen://*") {
+			t.Fatal("expected gen fetcher not to list")
+		} else if r.CanList("ftp://host/*") {
+			t.Fatal("expected unknown scheme not to list")
+		}
+	})
+
+	// Ensure an error is returned, if the fetcher can not list.
+	t.Run("ErrListNotSupported", func(t *testing.T) {
+		if _, err := r.List(context.TODO(), "gen://*"); dataflow.ErrorCode(err) != dataflow.EINVALID {
+			t.Fatalf("unexpected error: %#v", err)
+		}
+	})
+}
+
+func TestIsPattern(t *testing.T) {
+	testCases := []struct {
+		src  string
+		want bool
+	}{
+		{"products-*.jsonl", true},
+		{"products-?.jsonl", true},
+		{"daily/", true},
+		{"products-1.jsonl", false},
+		{"s3://casestudy/daily/*.jsonl", true},
+		{"file:///data/products-[12].jsonl", true},
+		{"file:///data/", true},
+		{"https://example.com/products.jsonl", false},
+		{"https://example.com/export?format=jsonl&page=*", false},
+		{"https://example.com/products/?limit=10", true},
+		{"https://example.com/products.jsonl#*", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.src, func(t *testing.T) {
+			if got := pipeline.IsPattern(tc.src); got != tc.want {
+				t.Fatalf("IsPattern(%q)=%v, want %v", tc.src, got, tc.want)
+			}
+		})
+	}
+}
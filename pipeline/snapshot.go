@@ -0,0 +1,82 @@
+package pipeline
+
+import (
+	"context"
+	"slices"
+
+	"github.com/narslan/pipeline"
+	"golang.org/x/sync/errgroup"
+)
+
+// see records the IDs of saved products, if the pipeline runs in snapshot mode.
+func (p *Pipeline) see(prs []*dataflow.Product) {
+	if !p.Snapshot {
+		return
+	}
+
+	p.seenMu.Lock()
+	defer p.seenMu.Unlock()
+	if p.seen == nil {
+		p.seen = make(map[uint32]struct{})
+	}
+	for _, pr := range prs {
+		p.seen[pr.ID] = struct{}{}
+	}
+}
+
+// DeleteMissing deletes the products, that are not in the sources of the run,
+// from the DB, the cache and the search index. It is called by Run in snapshot mode, after all sources are saved.
+func (p *Pipeline) DeleteMissing(ctx context.Context) (err error) {
+	ctx, span := tracer.Start(ctx, "Pipeline.DeleteMissing")
+	defer func() { end(span, err) }()
+
+	ids, err := p.ProductService.FindProductIDs(ctx)
+	if err != nil {
+		return err
+	}
+
+	p.seenMu.Lock()
+	ids = slices.DeleteFunc(ids, func(id uint32) bool {
+		_, ok := p.seen[id]
+		return ok
+	})
+	p.seenMu.Unlock()
+	p.logger().InfoContext(ctx, "deleting missing products", "count", len(ids))
+
+	size := p.BatchSize
+	if size <= 0 {
+		size = DefaultBatchSize
+	}
+	for chunk := range slices.Chunk(ids, size) {
+		// Remove the IDs from the cache first. Otherwise a product, that is deleted
+		// from the DB but still cached, would never be written again.
+		if err := p.CacheService.DeleteMany(ctx, chunk); err != nil {
+			return err
+		}
+		if p.SearchService != nil {
+			if err := p.SearchService.RemoveProducts(ctx, chunk); err != nil {
+				return err
+			}
+		}
+
+		g, gctx := errgroup.WithContext(ctx)
+		g.SetLimit(max(p.NumThreads, 1))
+		for _, id := range chunk {
+			g.Go(func() error {
+				if err := p.ProductService.DeleteProduct(gctx, id); dataflow.ErrorCode(err) == dataflow.ENOTFOUND {
+					return nil
+				} else if err != nil {
+					return err
+				}
+				p.logger().DebugContext(gctx, "product deleted", "product_id", id)
+				dbWrites.WithLabelValues("delete").Inc()
+				p.Stats.Deleted.Add(1)
+				return nil
+			})
+		}
+		if err := g.Wait(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package pipeline_test
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	dataflow "github.com/narslan/pipeline"
+	"github.com/narslan/pipeline/file"
+	"github.com/narslan/pipeline/mock"
+	"github.com/narslan/pipeline/pipeline"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Ensure the stages and the writes to the DB are traced in the trace of the caller.
+func TestTracing(t *testing.T) {
+	rec := MustRecordSpans(t)
+
+	t.Run("Stages", func(t *testing.T) {
+		paths, err := filepath.Glob(filepath.Join("testdata", "*.jsonl"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, root := otel.Tracer("test").Start(context.Background(), "Test")
+		pipe := pipeline.NewPipeline(file.NewFetchService(), n)
+		fileCh, _, err := pipe.LoadFiles(ctx, paths...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lineCh, _ := pipe.Split(ctx, fileCh)
+		for range lineCh {
+		}
+		root.End()
+
+		spans := Spans(rec, root)
+		if n := len(spans["Fetch.Open"]); n != len(paths) {
+			t.Fatalf("Fetch.Open spans=%d, want %d", n, len(paths))
+		} else if spans["Fetch.Open"][0].Parent().SpanID() != spans["Pipeline.LoadFiles"][0].SpanContext().SpanID() {
+			t.Fatal("Fetch.Open is not a child of Pipeline.LoadFiles")
+		} else if len(spans["Pipeline.Split"]) != 1 {
+			t.Fatal("Pipeline.Split not traced")
+		}
+	})
+
+	t.Run("SendBatchToDB", func(t *testing.T) {
+		ctx, root := otel.Tracer("test").Start(context.Background(), "Test")
+
+		pipe := pipeline.NewPipeline(file.NewFetchService(), n)
+		pipe.CacheService = &mock.Cache{
+			GetManyFn: func(ctx context.Context, ids []uint32) ([]string, error) {
+				return make([]string, len(ids)), nil
+			},
+			SetManyFn: func(ctx context.Context, m map[uint32]string) error { return nil },
+		}
+		pipe.ProductService = &mock.ProductService{CreateProductsFn: func(ctx context.Context, ps []*dataflow.Product) error {
+			// The trace context is passed on to the product service.
+			if trace.SpanContextFromContext(ctx).TraceID() != root.SpanContext().TraceID() {
+				t.Fatal("trace context not propagated")
+			}
+			return nil
+		}}
+		prs := []*dataflow.Product{{ID: 1, Title: "title1", Price: 10, Category: "bilgisayar", Brand: "brand1"}}
+		if err := pipe.SendBatchToDB(ctx, prs); err != nil {
+			t.Fatal(err)
+		}
+		root.End()
+
+		spans := Spans(rec, root)
+		if len(spans["Pipeline.SendBatchToDB"]) != 1 {
+			t.Fatal("Pipeline.SendBatchToDB not traced")
+		}
+		batch := spans["Pipeline.SendBatchToDB"][0].SpanContext().SpanID()
+		for _, name := range []string{"Cache.GetMany", "ProductService.CreateProducts", "Cache.SetMany"} {
+			if len(spans[name]) != 1 {
+				t.Fatalf("%s not traced", name)
+			} else if spans[name][0].Parent().SpanID() != batch {
+				t.Fatalf("%s is not a child of Pipeline.SendBatchToDB", name)
+			}
+		}
+	})
+}
+
+var (
+	spanRecorder *tracetest.SpanRecorder
+	recordOnce   sync.Once
+)
+
+// MustRecordSpans installs a global tracer provider, that records all spans.
+// The global provider can only be installed once, so all tests share the recorder.
+func MustRecordSpans(tb testing.TB) *tracetest.SpanRecorder {
+	tb.Helper()
+	recordOnce.Do(func() {
+		spanRecorder = tracetest.NewSpanRecorder()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spanRecorder)))
+	})
+	return spanRecorder
+}
+
+// Spans returns the ended spans of the trace of root by name.
+func Spans(rec *tracetest.SpanRecorder, root trace.Span) map[string][]sdktrace.ReadOnlySpan {
+	spans := make(map[string][]sdktrace.ReadOnlySpan)
+	for _, s := range rec.Ended() {
+		if s.SpanContext().TraceID() == root.SpanContext().TraceID() {
+			spans[s.Name()] = append(spans[s.Name()], s)
+		}
+	}
+	return spans
+}
@@ -2,6 +2,12 @@ package dataflow
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"slices"
+	"strings"
+	"time"
 )
 
 // Product represents a product in the database.
@@ -14,6 +20,12 @@ type Product struct {
 	Brand       string  `json:"brand,omitempty"`
 	URL         string  `json:"url,omitempty"`
 	Description string  `json:"description,omitempty"`
+
+	// Bookkeeping fields, set by ProductService on each write.
+	// Version is a time-based UUID, that changes with each write. It is empty for products
+	// written before it was tracked.
+	Version   string    `json:"version,omitempty"`
+	UpdatedAt time.Time `json:"updated_at,omitzero" msgpack:"updated_at,omitempty"`
 }
 
 // Validate returns an error if the product contains invalid fields.
@@ -38,13 +50,199 @@ func (p *Product) Validate() error {
 	return nil
 }
 
+// Fingerprint returns a hash of the canonical JSON of the product content.
+// Products with the same content have the same fingerprint. It is used to detect
+// changed products, without reading them from the database.
+func (p *Product) Fingerprint() string {
+	// The ID and the content fields are hashed in a fixed order. Version and UpdatedAt
+	// are set by each write, so they must not change the fingerprint of an unchanged product.
+	buf, _ := json.Marshal(struct {
+		ID          uint32  `json:"id"`
+		Title       string  `json:"title"`
+		Price       float32 `json:"price"`
+		Category    string  `json:"category"`
+		Brand       string  `json:"brand"`
+		URL         string  `json:"url"`
+		Description string  `json:"description"`
+	}{p.ID, p.Title, p.Price, p.Category, p.Brand, p.URL, p.Description})
+
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:16])
+}
+
+// ProductListing holds the category and brand of a product, under which it is listed.
+type ProductListing struct {
+	Category string
+	Brand    string
+}
+
+// cacheEntrySep separates the fields of a cache entry.
+const cacheEntrySep = "\x1f"
+
+// CacheEntry returns the entry of the product in a Cache. It holds the fingerprint of the
+// product, followed by its category and brand, so a later write of a changed product knows
+// where it was listed.
+func (p *Product) CacheEntry() string {
+	return p.Fingerprint() + cacheEntrySep + p.Category + cacheEntrySep + p.Brand
+}
+
+// ParseCacheEntry returns the fingerprint and the listing of a cache entry. Entries, that were
+// written before the listing was cached, hold only a fingerprint and return an empty listing.
+func ParseCacheEntry(entry string) (fingerprint string, listing ProductListing) {
+	fingerprint, rest, ok := strings.Cut(entry, cacheEntrySep)
+	if ok {
+		listing.Category, listing.Brand, _ = strings.Cut(rest, cacheEntrySep)
+	}
+	return fingerprint, listing
+}
+
+// ProductFields are the names of the product fields in their JSON form and canonical order.
+// A subset of them can be selected as a projection of product reads.
+var ProductFields = []string{"id", "title", "price", "category", "brand", "url", "description", "version", "updated_at"}
+
+// NormalizeProductFields returns the fields of a projection in canonical order without duplicates.
+// The ID is always selected. Empty fields select all fields.
+// Returns EINVALID if a field is unknown.
+func NormalizeProductFields(fields []string) ([]string, error) {
+	if len(fields) == 0 {
+		return slices.Clone(ProductFields), nil
+	}
+	for _, f := range fields {
+		if !slices.Contains(ProductFields, f) {
+			return nil, Errorf(EINVALID, "Unknown field: %q", f)
+		}
+	}
+
+	normalized := []string{"id"}
+	for _, f := range ProductFields[1:] {
+		if slices.Contains(fields, f) {
+			normalized = append(normalized, f)
+		}
+	}
+	return normalized, nil
+}
+
+// Project returns a copy of the product, in which only the given fields are set.
+// Empty fields select all fields. Unknown fields are ignored.
+func (p *Product) Project(fields []string) *Product {
+	if len(fields) == 0 {
+		other := *p
+		return &other
+	}
+
+	other := &Product{ID: p.ID}
+	for _, f := range fields {
+		switch f {
+		case "title":
+			other.Title = p.Title
+		case "price":
+			other.Price = p.Price
+		case "category":
+			other.Category = p.Category
+		case "brand":
+			other.Brand = p.Brand
+		case "url":
+			other.URL = p.URL
+		case "description":
+			other.Description = p.Description
+		case "version":
+			other.Version = p.Version
+		case "updated_at":
+			other.UpdatedAt = p.UpdatedAt
+		}
+	}
+	return other
+}
+
 // ProductService represents a service for managing products.
 type ProductService interface {
 
-	// Retrieves a product by ID.
-	// Returns ENOTFOUND if product does not exist.
-	FindProductByID(ctx context.Context, id uint32) (*Product, error)
+	// Retrieves a product by ID. If fields are given, only those fields and the ID are read.
+	// Returns ENOTFOUND if product does not exist, or EINVALID if a field is unknown.
+	FindProductByID(ctx context.Context, id uint32, fields ...string) (*Product, error)
 
-	// Creates a new product.
+	// Retrieves a number of products by ID. If fields are given, only those fields and the ID are read.
+	// Found products are returned in the order of ids. Missing products are left out.
+	FindProductsByIDs(ctx context.Context, ids []uint32, fields ...string) ([]*Product, error)
+
+	// Creates a new product. Sets the version and update time of p.
+	// Returns ECONFLICT if a product with the same ID exists.
 	CreateProduct(ctx context.Context, p *Product) error
+
+	// Creates a number of products at once. Existing products with the same IDs are replaced.
+	// Sets the version and update time of each product. No product is written, if any of them is invalid.
+	// Replaced products are not read, so they stay listed under a previous category or brand,
+	// until UnlistProducts is called.
+	CreateProducts(ctx context.Context, ps []*Product) error
+
+	// Removes products from the listings of a previous category or brand, keyed by product ID.
+	// Empty fields of a listing are skipped.
+	UnlistProducts(ctx context.Context, prev map[uint32]ProductListing) error
+
+	// Updates a product by ID. Returns the new product state, even if there was an error.
+	// Returns ENOTFOUND if product does not exist.
+	UpdateProduct(ctx context.Context, id uint32, upd ProductUpdate) (*Product, error)
+
+	// Permanently deletes a product by ID.
+	// Returns ENOTFOUND if product does not exist.
+	DeleteProduct(ctx context.Context, id uint32) error
+
+	// Retrieves the IDs of all products.
+	FindProductIDs(ctx context.Context) ([]uint32, error)
+
+	// Retrieves a page of products in a stable order. Also returns the cursor
+	// of the next page, which is empty if there are no more products.
+	// Returns EINVALID if the cursor is malformed or a field of the filter is unknown.
+	ListProducts(ctx context.Context, filter ProductFilter) ([]*Product, string, error)
+}
+
+// ProductUpdate represents a set of fields to be updated via UpdateProduct.
+// Fields, that are nil, keep their value.
+type ProductUpdate struct {
+	Title       *string  `json:"title"`
+	Price       *float32 `json:"price"`
+	Category    *string  `json:"category"`
+	Brand       *string  `json:"brand"`
+	URL         *string  `json:"url"`
+	Description *string  `json:"description"`
+}
+
+// Apply sets the fields of the update on a product.
+func (u *ProductUpdate) Apply(p *Product) {
+	if v := u.Title; v != nil {
+		p.Title = *v
+	}
+	if v := u.Price; v != nil {
+		p.Price = *v
+	}
+	if v := u.Category; v != nil {
+		p.Category = *v
+	}
+	if v := u.Brand; v != nil {
+		p.Brand = *v
+	}
+	if v := u.URL; v != nil {
+		p.URL = *v
+	}
+	if v := u.Description; v != nil {
+		p.Description = *v
+	}
+}
+
+// ProductFilter represents a filter passed to ListProducts.
+type ProductFilter struct {
+	// Filtering fields. Empty fields match all products.
+	Category string `json:"category"`
+	Brand    string `json:"brand"`
+
+	// Opaque cursor of the page, as returned by a previous call.
+	// An empty cursor starts at the first page.
+	Cursor string `json:"cursor"`
+
+	// Maximum number of products in the page.
+	// The service picks a default if it is not set.
+	Limit int `json:"limit"`
+
+	// Fields to read of each product, besides the ID. Empty fields select all fields.
+	Fields []string `json:"fields"`
 }
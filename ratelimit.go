@@ -0,0 +1,38 @@
+package dataflow
+
+import (
+	"context"
+	"time"
+)
+
+// RateLimiter represents a service for limiting the rate of requests by key.
+// Each key has a token bucket, that holds up to Burst tokens and is refilled at Rate tokens per second.
+type RateLimiter interface {
+	// Takes a token from the bucket of key, if there is one.
+	Allow(ctx context.Context, key string, limit RateLimit) (*RateLimitResult, error)
+}
+
+// RateLimit represents the size and refill rate of a token bucket.
+type RateLimit struct {
+	// Number of tokens added per second. Requests are not limited, if it is not positive.
+	Rate float64 `toml:"rate"`
+
+	// Maximum number of tokens, which is the size of a burst of requests.
+	// It is at least 1.
+	Burst int `toml:"burst"`
+}
+
+// RateLimitResult represents the state of a token bucket after a request.
+type RateLimitResult struct {
+	// Allowed is true, if a token was taken.
+	Allowed bool
+
+	// Number of whole tokens left in the bucket.
+	Remaining int
+
+	// Time until the next token is available. It is 0, if the request was allowed.
+	RetryAfter time.Duration
+
+	// Time until the bucket is full again.
+	Reset time.Duration
+}
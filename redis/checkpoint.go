@@ -0,0 +1,51 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/narslan/pipeline"
+	"github.com/redis/go-redis/v9"
+)
+
+// CheckpointPrefix is prepended to the source key of each checkpoint entry.
+const CheckpointPrefix = "checkpoint:"
+
+// CheckpointService represents a service for managing checkpoints in redis.
+type CheckpointService struct {
+	cache *Cache
+}
+
+// Ensure service implements interface.
+var _ dataflow.CheckpointService = (*CheckpointService)(nil)
+
+// NewCheckpointService returns a new instance of CheckpointService.
+func NewCheckpointService(cache *Cache) *CheckpointService {
+	return &CheckpointService{cache: cache}
+}
+
+// FindCheckpoint retrieves the checkpoint of a source.
+// Returns ENOTFOUND if checkpoint does not exist.
+func (s *CheckpointService) FindCheckpoint(ctx context.Context, key string) (*dataflow.Checkpoint, error) {
+	buf, err := s.cache.Get(ctx, CheckpointPrefix+key).Bytes()
+	if err == redis.Nil {
+		return nil, dataflow.Errorf(dataflow.ENOTFOUND, "checkpoint of %s is not found", key)
+	} else if err != nil {
+		return nil, err
+	}
+
+	var c dataflow.Checkpoint
+	if err := json.Unmarshal(buf, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// SaveCheckpoint creates or replaces the checkpoint of a source.
+func (s *CheckpointService) SaveCheckpoint(ctx context.Context, c *dataflow.Checkpoint) error {
+	buf, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return s.cache.Set(ctx, CheckpointPrefix+c.Key, buf, 0).Err()
+}
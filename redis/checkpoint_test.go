@@ -0,0 +1,57 @@
+package redis_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	dataflow "github.com/narslan/pipeline"
+	"github.com/narslan/pipeline/container"
+	"github.com/narslan/pipeline/redis"
+)
+
+func TestCheckpointService_SaveCheckpoint(t *testing.T) {
+	// Start containers for test.
+	ctx := context.Background()
+	rdbc, redisConnectionString := container.MustDeployRedis(ctx)
+	defer container.MustCleanRedisContainer(ctx, rdbc)
+
+	// Ensure checkpoint can be saved and found.
+	t.Run("OK", func(t *testing.T) {
+		db := MustOpenCache(t, redisConnectionString)
+		defer MustCloseCache(t, db)
+
+		s := redis.NewCheckpointService(db)
+
+		c := &dataflow.Checkpoint{
+			Key:       "products-1.jsonl",
+			ETag:      `"abc"`,
+			Size:      1024,
+			Line:      10,
+			Offset:    512,
+			Status:    dataflow.CheckpointComplete,
+			UpdatedAt: time.Unix(1, 0).UTC(),
+		}
+		if err := s.SaveCheckpoint(context.Background(), c); err != nil {
+			t.Fatal(err)
+		}
+
+		if got, err := s.FindCheckpoint(context.Background(), c.Key); err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(got, c) {
+			t.Fatalf("mismatch: %#v != %#v", got, c)
+		}
+	})
+
+	// Ensure an error is returned if fetching a non-existent checkpoint.
+	t.Run("ErrNotFound", func(t *testing.T) {
+		db := MustOpenCache(t, redisConnectionString)
+		defer MustCloseCache(t, db)
+
+		s := redis.NewCheckpointService(db)
+		if _, err := s.FindCheckpoint(context.Background(), "products-2.jsonl"); dataflow.ErrorCode(err) != dataflow.ENOTFOUND {
+			t.Fatalf("unexpected error: %#v", err)
+		}
+	})
+}
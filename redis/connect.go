@@ -1,7 +1,9 @@
 package redis
 
 import (
+	"cmp"
 	"context"
+	"log/slog"
 
 	"github.com/redis/go-redis/v9"
 )
@@ -9,6 +11,9 @@ import (
 // Cache represents a connection to the Redis database.
 type Cache struct {
 	*redis.Client
+
+	// Logger of the services using the cache. Defaults to slog.Default().
+	Logger *slog.Logger
 }
 
 // NewCache returns a new instance of Cache associated with the given connection params.
@@ -27,7 +32,7 @@ func NewCache(addr, pass string, db int) (*Cache, error) {
 		return nil, err
 	}
 
-	return &Cache{Client: rdb}, nil
+	return &Cache{Client: rdb, Logger: slog.Default()}, nil
 
 }
 
@@ -37,3 +42,8 @@ func NewCache(addr, pass string, db int) (*Cache, error) {
 func (db *Cache) ShutDown() error {
 	return db.Close()
 }
+
+// logger returns the logger of the cache, or the default logger if it is not set.
+func (db *Cache) logger() *slog.Logger {
+	return cmp.Or(db.Logger, slog.Default())
+}
@@ -8,7 +8,8 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
-// IDCacheService represent a service for managing ids in redis cache.
+// IDCacheService represent a service for managing product fingerprints in redis cache.
+// The fingerprint of a product is stored under its id.
 type IDCacheService struct {
 	cache *Cache
 }
@@ -21,18 +22,18 @@ func NewIDCacheService(cache *Cache) *IDCacheService {
 	return &IDCacheService{cache: cache}
 }
 
-// Set stores a given id into redis cache.
-func (s *IDCacheService) Set(ctx context.Context, id uint32) error {
+// Set stores the fingerprint of a given id into redis cache.
+func (s *IDCacheService) Set(ctx context.Context, id uint32, fingerprint string) error {
 
 	// Convert id to a string.
 	// FormatUInt is the fastest way to convert a uint to a string.
 	uid := strconv.FormatUint(uint64(id), 10)
 
 	// Save to redis and return error.
-	return s.cache.Set(ctx, uid, "", 0).Err()
+	return s.cache.Set(ctx, uid, fingerprint, 0).Err()
 }
 
-// Set stores a given id into redis cache.
+// Exists reports whether a given id is in redis cache.
 func (s *IDCacheService) Exists(ctx context.Context, id uint32) (bool, error) {
 
 	// Convert id to a string.
@@ -49,3 +50,67 @@ func (s *IDCacheService) Exists(ctx context.Context, id uint32) (bool, error) {
 
 	return true, nil // When we reach here, we have the key.
 }
+
+// Get retrieves the fingerprint of a given id from redis cache.
+// Returns an empty string if the id does not exist.
+func (s *IDCacheService) Get(ctx context.Context, id uint32) (string, error) {
+	fingerprint, err := s.cache.Get(ctx, strconv.FormatUint(uint64(id), 10)).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return fingerprint, err
+}
+
+// SetMany stores the given fingerprints into redis cache with a single MSET command.
+func (s *IDCacheService) SetMany(ctx context.Context, fingerprints map[uint32]string) error {
+	if len(fingerprints) == 0 {
+		return nil
+	}
+
+	// MSET takes alternating keys and values.
+	pairs := make([]any, 0, 2*len(fingerprints))
+	for id, fingerprint := range fingerprints {
+		pairs = append(pairs, strconv.FormatUint(uint64(id), 10), fingerprint)
+	}
+	return s.cache.MSet(ctx, pairs...).Err()
+}
+
+// GetMany retrieves the fingerprints of the given ids from redis cache.
+// All ids are looked up with a single MGET command.
+func (s *IDCacheService) GetMany(ctx context.Context, ids []uint32) ([]string, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = strconv.FormatUint(uint64(id), 10)
+	}
+
+	// MGET returns nil for each key, that does not exist.
+	vals, err := s.cache.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	fingerprints := make([]string, len(vals))
+	for i, v := range vals {
+		if v, ok := v.(string); ok {
+			fingerprints[i] = v
+		}
+	}
+	return fingerprints, nil
+}
+
+// DeleteMany removes the given ids from redis cache with a single DEL command.
+func (s *IDCacheService) DeleteMany(ctx context.Context, ids []uint32) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = strconv.FormatUint(uint64(id), 10)
+	}
+	return s.cache.Del(ctx, keys...).Err()
+}
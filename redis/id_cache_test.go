@@ -2,6 +2,7 @@ package redis_test
 
 import (
 	"context"
+	"reflect"
 	"testing"
 
 	"github.com/narslan/pipeline/container"
@@ -23,7 +24,7 @@ func TestIDCacheService_Set(t *testing.T) {
 
 		// set an id.
 		want := uint32(42)
-		err := s.Set(context.Background(), want)
+		err := s.Set(context.Background(), want, "fingerprint")
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -62,3 +63,141 @@ func TestIDCacheService_Exists(t *testing.T) {
 		}
 	})
 }
+
+func TestIDCacheService_Get(t *testing.T) {
+	// Start containers for test.
+	ctx := context.Background()
+	rdbc, redisConnectionString := container.MustDeployRedis(ctx)
+	defer container.MustCleanRedisContainer(ctx, rdbc)
+
+	// Ensure the fingerprint of an id can be retrieved.
+	t.Run("OK", func(t *testing.T) {
+		db := MustOpenCache(t, redisConnectionString)
+		defer MustCloseCache(t, db)
+
+		s := redis.NewIDCacheService(db)
+
+		if err := s.Set(context.Background(), 42, "abc"); err != nil {
+			t.Fatal(err)
+		}
+
+		if fingerprint, err := s.Get(context.Background(), 42); err != nil {
+			t.Fatal(err)
+		} else if fingerprint != "abc" {
+			t.Fatalf("Get=%q, want %q", fingerprint, "abc")
+		}
+	})
+
+	// Ensure an empty fingerprint is returned if id does not exist.
+	t.Run("NotFound", func(t *testing.T) {
+		db := MustOpenCache(t, redisConnectionString)
+		defer MustCloseCache(t, db)
+
+		s := redis.NewIDCacheService(db)
+		if fingerprint, err := s.Get(context.Background(), 42); err != nil {
+			t.Fatal(err)
+		} else if fingerprint != "" {
+			t.Fatalf("Get=%q, want empty", fingerprint)
+		}
+	})
+}
+
+func TestIDCacheService_GetMany(t *testing.T) {
+	// Start containers for test.
+	ctx := context.Background()
+	rdbc, redisConnectionString := container.MustDeployRedis(ctx)
+	defer container.MustCleanRedisContainer(ctx, rdbc)
+
+	// Ensure a number of fingerprints can be set and retrieved at once.
+	t.Run("OK", func(t *testing.T) {
+		db := MustOpenCache(t, redisConnectionString)
+		defer MustCloseCache(t, db)
+
+		s := redis.NewIDCacheService(db)
+
+		if err := s.SetMany(context.Background(), map[uint32]string{1: "a", 3: "c"}); err != nil {
+			t.Fatal(err)
+		}
+
+		fingerprints, err := s.GetMany(context.Background(), []uint32{1, 2, 3, 4})
+		if err != nil {
+			t.Fatal(err)
+		} else if want := []string{"a", "", "c", ""}; !reflect.DeepEqual(fingerprints, want) {
+			t.Fatalf("GetMany=%v, want %v", fingerprints, want)
+		}
+	})
+}
+
+func TestIDCacheService_DeleteMany(t *testing.T) {
+	// Start containers for test.
+	ctx := context.Background()
+	rdbc, redisConnectionString := container.MustDeployRedis(ctx)
+	defer container.MustCleanRedisContainer(ctx, rdbc)
+
+	// Ensure a number of ids can be removed at once.
+	t.Run("OK", func(t *testing.T) {
+		db := MustOpenCache(t, redisConnectionString)
+		defer MustCloseCache(t, db)
+
+		s := redis.NewIDCacheService(db)
+
+		if err := s.SetMany(context.Background(), map[uint32]string{1: "a", 2: "b"}); err != nil {
+			t.Fatal(err)
+		} else if err := s.DeleteMany(context.Background(), []uint32{1, 3}); err != nil {
+			t.Fatal(err)
+		}
+
+		fingerprints, err := s.GetMany(context.Background(), []uint32{1, 2})
+		if err != nil {
+			t.Fatal(err)
+		} else if want := []string{"", "b"}; !reflect.DeepEqual(fingerprints, want) {
+			t.Fatalf("GetMany=%v, want %v", fingerprints, want)
+		}
+	})
+}
+
+// BenchmarkIDCacheService compares looking up and storing ids one by one
+// with doing it in batches of the pipeline's default batch size.
+func BenchmarkIDCacheService(b *testing.B) {
+	ctx := context.Background()
+	rdbc, redisConnectionString := container.MustDeployRedis(ctx)
+	defer container.MustCleanRedisContainer(ctx, rdbc)
+
+	db := MustOpenCache(b, redisConnectionString)
+	defer MustCloseCache(b, db)
+
+	s := redis.NewIDCacheService(db)
+
+	const batchSize = 100
+	ids := make([]uint32, batchSize)
+	fingerprints := make(map[uint32]string, batchSize)
+
+	b.Run("Single", func(b *testing.B) {
+		for i := 0; b.Loop(); i++ {
+			id := uint32(i)
+			if _, err := s.Get(ctx, id); err != nil {
+				b.Fatal(err)
+			} else if err := s.Set(ctx, id, "fingerprint"); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N), "ns/id")
+	})
+
+	b.Run("Batch", func(b *testing.B) {
+		for i := 0; b.Loop(); i++ {
+			// Each iteration handles a batch, so report the time per id.
+			clear(fingerprints)
+			for j := range ids {
+				ids[j] = uint32(i*batchSize + j)
+				fingerprints[ids[j]] = "fingerprint"
+			}
+			if _, err := s.GetMany(ctx, ids); err != nil {
+				b.Fatal(err)
+			} else if err := s.SetMany(ctx, fingerprints); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*batchSize), "ns/id")
+	})
+}
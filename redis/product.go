@@ -0,0 +1,319 @@
+package redis
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/narslan/pipeline"
+	"github.com/redis/go-redis/v9"
+)
+
+// ProductPrefix is prepended to the product ID of each cached product.
+// It keeps products apart from the fingerprints of IDCacheService.
+const ProductPrefix = "product:"
+
+// Default lifetimes of cached entries.
+const (
+	DefaultProductTTL      = 5 * time.Minute
+	DefaultNotFoundTTL     = 30 * time.Second
+	DefaultInvalidationTTL = 5 * time.Second
+)
+
+// notFound is cached for IDs, that do not exist. A serialized product is never empty.
+const notFound = ""
+
+// invalidated replaces the entry of a written product. Entries are only filled, if their
+// key is not set, so a read, that fetched a product before it was written, can not cache
+// its stale state, until invalidated expires.
+const invalidated = "-"
+
+// Ensure service implements interface.
+var _ dataflow.ProductService = (*ProductService)(nil)
+
+// ProductService represents a read-through cache of products in redis.
+// It wraps another ProductService, that holds the products.
+// Lookups by ID are served from the cache, writes invalidate the cached entries.
+// Lookups fail open: if redis fails, they are logged and served by the underlying service.
+type ProductService struct {
+	cache   *Cache
+	service dataflow.ProductService
+
+	// Lifetime of a cached product.
+	TTL time.Duration
+
+	// Lifetime of a cached miss. It keeps lookups of missing IDs from reaching the database.
+	NotFoundTTL time.Duration
+
+	// Lifetime of the entry of a written product, during which it is not cached.
+	// It must exceed the time of a lookup in the underlying service.
+	InvalidationTTL time.Duration
+
+	// Fingerprints of the job, that are removed along with the cached entries of written products.
+	// Otherwise the job skips a product changed by another writer, as long as its feed is unchanged.
+	Fingerprints dataflow.Cache
+}
+
+// NewProductService returns a new instance of ProductService, that caches the products of service.
+func NewProductService(cache *Cache, service dataflow.ProductService) *ProductService {
+	return &ProductService{
+		cache:           cache,
+		service:         service,
+		TTL:             DefaultProductTTL,
+		NotFoundTTL:     DefaultNotFoundTTL,
+		InvalidationTTL: DefaultInvalidationTTL,
+	}
+}
+
+// productKey returns the key of a cached product.
+func productKey(id uint32) string {
+	return ProductPrefix + strconv.FormatUint(uint64(id), 10)
+}
+
+// FindProductByID retrieves a product by ID from the cache, or from the underlying service on a miss.
+// Whole products are cached, so the projection of fields is applied to the cached product.
+// On a miss, a projection is passed to the underlying service, so it only reads those fields,
+// and the partial product is not cached.
+// Returns ENOTFOUND if product does not exist, or EINVALID if a field is unknown.
+func (s *ProductService) FindProductByID(ctx context.Context, id uint32, fields ...string) (*dataflow.Product, error) {
+	if _, err := dataflow.NormalizeProductFields(fields); err != nil {
+		return nil, err
+	}
+
+	// Serve the product from the cache. Errors of the cache are logged, and the product
+	// is fetched from the underlying service without caching it.
+	fill := true
+	buf, err := s.cache.Get(ctx, productKey(id)).Result()
+	if err == nil && buf != invalidated {
+		p, err := decodeProduct(id, buf)
+		if err == nil || dataflow.ErrorCode(err) == dataflow.ENOTFOUND {
+			s.logger(ctx).DebugContext(ctx, "cache hit", "product_id", id)
+			if err != nil {
+				return nil, err
+			}
+			return p.Project(fields), nil
+		}
+		s.logger(ctx).WarnContext(ctx, "cache read failed", "product_id", id, "error", err)
+		fill = false
+	} else if err != nil && err != redis.Nil {
+		s.logger(ctx).WarnContext(ctx, "cache read failed", "product_id", id, "error", err)
+		fill = false
+	} else {
+		s.logger(ctx).DebugContext(ctx, "cache miss", "product_id", id)
+	}
+
+	// Fetch product from the underlying service and cache the result, even a miss.
+	p, err := s.service.FindProductByID(ctx, id, fields...)
+	if dataflow.ErrorCode(err) == dataflow.ENOTFOUND {
+		if fill {
+			s.fill(ctx, s.cache.SetNX(ctx, productKey(id), notFound, s.NotFoundTTL).Err(), 1)
+		}
+		return nil, err
+	} else if err != nil {
+		return nil, err
+	}
+
+	if fill && len(fields) == 0 {
+		s.fill(ctx, s.set(ctx, s.cache, p), 1)
+	}
+	return p.Project(fields), nil
+}
+
+// FindProductsByIDs retrieves a number of products by ID. Cached products are read with a
+// single MGET command, the others are fetched from the underlying service at once.
+// The projection of fields is applied to the cached products, and passed to the underlying
+// service for the misses. Partial products are not cached.
+// Found products are returned in the order of ids. Missing products are left out.
+func (s *ProductService) FindProductsByIDs(ctx context.Context, ids []uint32, fields ...string) ([]*dataflow.Product, error) {
+	if _, err := dataflow.NormalizeProductFields(fields); err != nil {
+		return nil, err
+	} else if len(ids) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = productKey(id)
+	}
+
+	// Errors of the cache are logged, and all products are fetched from the underlying
+	// service without caching them.
+	fill := true
+	vals, err := s.cache.MGet(ctx, keys...).Result()
+	if err != nil {
+		s.logger(ctx).WarnContext(ctx, "cache read failed", "products", len(ids), "error", err)
+		vals, fill = make([]any, len(ids)), false
+	}
+
+	// Decode hits and collect misses.
+	found := make(map[uint32]*dataflow.Product, len(ids))
+	var misses []uint32
+	for i, v := range vals {
+		buf, ok := v.(string)
+		if !ok || buf == invalidated {
+			misses = append(misses, ids[i])
+			continue
+		}
+
+		p, err := decodeProduct(ids[i], buf)
+		if dataflow.ErrorCode(err) == dataflow.ENOTFOUND {
+			continue
+		} else if err != nil {
+			s.logger(ctx).WarnContext(ctx, "cache read failed", "product_id", ids[i], "error", err)
+			misses = append(misses, ids[i])
+			continue
+		}
+		found[p.ID] = p
+	}
+
+	s.logger(ctx).DebugContext(ctx, "cache lookup", "hits", len(ids)-len(misses), "misses", len(misses))
+
+	// Fetch the misses from the underlying service and cache them in one round trip.
+	if len(misses) > 0 {
+		ps, err := s.service.FindProductsByIDs(ctx, misses, fields...)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range ps {
+			found[p.ID] = p
+		}
+
+		if fill {
+			pipe := s.cache.Pipeline()
+			if len(fields) == 0 {
+				for _, p := range ps {
+					if err := s.set(ctx, pipe, p); err != nil {
+						return nil, err
+					}
+				}
+			}
+			for _, id := range misses {
+				if _, ok := found[id]; !ok {
+					pipe.SetNX(ctx, productKey(id), notFound, s.NotFoundTTL)
+				}
+			}
+			_, err := pipe.Exec(ctx)
+			s.fill(ctx, err, len(misses))
+		}
+	}
+
+	ps := make([]*dataflow.Product, 0, len(found))
+	for _, id := range ids {
+		if p, ok := found[id]; ok {
+			ps = append(ps, p.Project(fields))
+		}
+	}
+	return ps, nil
+}
+
+// CreateProduct creates a new product and invalidates its cached entry.
+// Returns ECONFLICT if a product with the same ID exists.
+func (s *ProductService) CreateProduct(ctx context.Context, p *dataflow.Product) error {
+	err := s.service.CreateProduct(ctx, p)
+	return s.invalidate(ctx, err, p.ID)
+}
+
+// CreateProducts creates a number of products and invalidates their cached entries.
+func (s *ProductService) CreateProducts(ctx context.Context, ps []*dataflow.Product) error {
+	err := s.service.CreateProducts(ctx, ps)
+
+	ids := make([]uint32, len(ps))
+	for i, p := range ps {
+		ids[i] = p.ID
+	}
+	return s.invalidate(ctx, err, ids...)
+}
+
+// UnlistProducts removes products from the listings of a previous category or brand.
+// Listings are not cached, so it only calls the underlying service.
+func (s *ProductService) UnlistProducts(ctx context.Context, prev map[uint32]dataflow.ProductListing) error {
+	return s.service.UnlistProducts(ctx, prev)
+}
+
+// UpdateProduct updates a product by ID and invalidates its cached entry.
+// Returns ENOTFOUND if product does not exist.
+func (s *ProductService) UpdateProduct(ctx context.Context, id uint32, upd dataflow.ProductUpdate) (*dataflow.Product, error) {
+	p, err := s.service.UpdateProduct(ctx, id, upd)
+	return p, s.invalidate(ctx, err, id)
+}
+
+// DeleteProduct permanently deletes a product by ID and invalidates its cached entry.
+// Returns ENOTFOUND if product does not exist.
+func (s *ProductService) DeleteProduct(ctx context.Context, id uint32) error {
+	err := s.service.DeleteProduct(ctx, id)
+	return s.invalidate(ctx, err, id)
+}
+
+// FindProductIDs retrieves the IDs of all products from the underlying service.
+func (s *ProductService) FindProductIDs(ctx context.Context) ([]uint32, error) {
+	return s.service.FindProductIDs(ctx)
+}
+
+// ListProducts retrieves a page of products from the underlying service.
+// Pages are not cached.
+func (s *ProductService) ListProducts(ctx context.Context, filter dataflow.ProductFilter) ([]*dataflow.Product, string, error) {
+	return s.service.ListProducts(ctx, filter)
+}
+
+// set caches a product with the product lifetime, unless its key is set.
+func (s *ProductService) set(ctx context.Context, c redis.Cmdable, p *dataflow.Product) error {
+	buf, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return c.SetNX(ctx, productKey(p.ID), buf, s.TTL).Err()
+}
+
+// fill logs the error of caching the results of a lookup, which have been served anyway.
+func (s *ProductService) fill(ctx context.Context, err error, n int) {
+	if err != nil {
+		s.logger(ctx).WarnContext(ctx, "cache fill failed", "products", n, "error", err)
+	}
+}
+
+// invalidate replaces the cached entries of products after a write, and removes their fingerprints.
+// A failed write may still have changed a product, so entries are replaced in any case.
+// It returns the error of the write, if there is one.
+func (s *ProductService) invalidate(ctx context.Context, err error, ids ...uint32) error {
+	if len(ids) == 0 {
+		return err
+	}
+
+	pipe := s.cache.Pipeline()
+	for _, id := range ids {
+		pipe.Set(ctx, productKey(id), invalidated, s.InvalidationTTL)
+	}
+	_, derr := pipe.Exec(ctx)
+	if derr == nil && s.Fingerprints != nil {
+		derr = s.Fingerprints.DeleteMany(ctx, ids)
+	}
+	if err == nil {
+		err = derr
+	} else if derr != nil {
+		// The error of the write is returned, so the stale entries are only logged.
+		s.logger(ctx).WarnContext(ctx, "cache invalidation failed", "products", len(ids), "error", derr)
+	}
+	return err
+}
+
+// logger returns the logger in the context, like the one of an HTTP request,
+// or the logger of the cache.
+func (s *ProductService) logger(ctx context.Context) *slog.Logger {
+	return cmp.Or(dataflow.LoggerFromContext(ctx), s.cache.logger())
+}
+
+// decodeProduct decodes a cached entry. Returns ENOTFOUND for a cached miss.
+func decodeProduct(id uint32, buf string) (*dataflow.Product, error) {
+	if buf == notFound {
+		return nil, dataflow.Errorf(dataflow.ENOTFOUND, "product with id: %d is not found", id)
+	}
+
+	var p dataflow.Product
+	if err := json.Unmarshal([]byte(buf), &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
@@ -0,0 +1,306 @@
+package redis_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	dataflow "github.com/narslan/pipeline"
+	"github.com/narslan/pipeline/container"
+	"github.com/narslan/pipeline/mock"
+	"github.com/narslan/pipeline/redis"
+)
+
+func TestProductService_FindProductByID(t *testing.T) {
+	// Start containers for test.
+	ctx := context.Background()
+	rdbc, redisConnectionString := container.MustDeployRedis(ctx)
+	defer container.MustCleanRedisContainer(ctx, rdbc)
+
+	// Ensure a product is read from the underlying service only once.
+	t.Run("OK", func(t *testing.T) {
+		db := MustOpenCache(t, redisConnectionString)
+		defer MustCloseCache(t, db)
+
+		p := &dataflow.Product{ID: 1, Title: "title1", Price: 42.01, Category: "bilgisayar", Brand: "brand1"}
+
+		var calls int
+		s := redis.NewProductService(db, &mock.ProductService{
+			FindProductByIDFn: func(ctx context.Context, id uint32, fields ...string) (*dataflow.Product, error) {
+				calls++
+				return p, nil
+			},
+		})
+
+		for range 2 {
+			if other, err := s.FindProductByID(context.Background(), 1); err != nil {
+				t.Fatal(err)
+			} else if !reflect.DeepEqual(p, other) {
+				t.Fatalf("mismatch: %#v != %#v", p, other)
+			}
+		}
+		if calls != 1 {
+			t.Fatalf("expected 1 call, got %d", calls)
+		}
+	})
+
+	// Ensure a miss only reads the fields of the projection, and the projection
+	// of a later read is applied to the cached product.
+	t.Run("Fields", func(t *testing.T) {
+		db := MustOpenCache(t, redisConnectionString)
+		defer MustCloseCache(t, db)
+
+		p := &dataflow.Product{ID: 3, Title: "title3", Price: 42.01, Category: "bilgisayar", Brand: "brand1"}
+		var read [][]string
+		s := redis.NewProductService(db, &mock.ProductService{
+			FindProductByIDFn: func(ctx context.Context, id uint32, fields ...string) (*dataflow.Product, error) {
+				read = append(read, fields)
+				return p.Project(fields), nil
+			},
+		})
+
+		// The partial product is not cached, so the full product is read afterwards.
+		want := &dataflow.Product{ID: 3, Price: 42.01}
+		for _, fields := range [][]string{{"price"}, nil, {"price"}} {
+			if other, err := s.FindProductByID(context.Background(), 3, fields...); err != nil {
+				t.Fatal(err)
+			} else if fields != nil && !reflect.DeepEqual(other, want) {
+				t.Fatalf("mismatch: %#v != %#v", other, want)
+			}
+		}
+		if want := [][]string{{"price"}, nil}; !reflect.DeepEqual(read, want) {
+			t.Fatalf("read=%v, want %v", read, want)
+		}
+		if _, err := s.FindProductByID(context.Background(), 3, "colour"); dataflow.ErrorCode(err) != dataflow.EINVALID {
+			t.Fatalf("unexpected error: %#v", err)
+		}
+	})
+
+	// Ensure a missing product is cached as well.
+	t.Run("ErrNotFound", func(t *testing.T) {
+		db := MustOpenCache(t, redisConnectionString)
+		defer MustCloseCache(t, db)
+
+		var calls int
+		s := redis.NewProductService(db, &mock.ProductService{
+			FindProductByIDFn: func(ctx context.Context, id uint32, fields ...string) (*dataflow.Product, error) {
+				calls++
+				return nil, dataflow.Errorf(dataflow.ENOTFOUND, "product with id: %d is not found", id)
+			},
+		})
+
+		for range 2 {
+			if _, err := s.FindProductByID(context.Background(), 2); dataflow.ErrorCode(err) != dataflow.ENOTFOUND {
+				t.Fatalf("unexpected error: %#v", err)
+			}
+		}
+		if calls != 1 {
+			t.Fatalf("expected 1 call, got %d", calls)
+		}
+	})
+
+	// Ensure a product is served from the underlying service, if redis fails.
+	t.Run("CacheDown", func(t *testing.T) {
+		db := MustOpenCache(t, redisConnectionString)
+		MustCloseCache(t, db)
+
+		p := &dataflow.Product{ID: 1, Title: "title1", Price: 42.01, Category: "bilgisayar", Brand: "brand1"}
+		s := redis.NewProductService(db, &mock.ProductService{
+			FindProductByIDFn: func(ctx context.Context, id uint32, fields ...string) (*dataflow.Product, error) {
+				return p, nil
+			},
+		})
+
+		if other, err := s.FindProductByID(context.Background(), 1); err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(p, other) {
+			t.Fatalf("mismatch: %#v != %#v", p, other)
+		}
+	})
+
+	// Ensure the failure of redis is logged to the default logger, if the cache has no logger.
+	t.Run("NilLogger", func(t *testing.T) {
+		db := MustOpenCache(t, redisConnectionString)
+		db.Logger = nil
+		MustCloseCache(t, db)
+
+		p := &dataflow.Product{ID: 1, Title: "title1", Price: 42.01, Category: "bilgisayar", Brand: "brand1"}
+		s := redis.NewProductService(db, &mock.ProductService{
+			FindProductByIDFn: func(ctx context.Context, id uint32, fields ...string) (*dataflow.Product, error) {
+				return p, nil
+			},
+		})
+
+		if other, err := s.FindProductByID(context.Background(), 1); err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(p, other) {
+			t.Fatalf("mismatch: %#v != %#v", p, other)
+		}
+	})
+}
+
+func TestProductService_FindProductsByIDs(t *testing.T) {
+	// Start containers for test.
+	ctx := context.Background()
+	rdbc, redisConnectionString := container.MustDeployRedis(ctx)
+	defer container.MustCleanRedisContainer(ctx, rdbc)
+
+	// Ensure only misses are read from the underlying service.
+	t.Run("OK", func(t *testing.T) {
+		db := MustOpenCache(t, redisConnectionString)
+		defer MustCloseCache(t, db)
+
+		var requested [][]uint32
+		s := redis.NewProductService(db, &mock.ProductService{
+			FindProductsByIDsFn: func(ctx context.Context, ids []uint32, fields ...string) ([]*dataflow.Product, error) {
+				requested = append(requested, ids)
+				var ps []*dataflow.Product
+				for _, id := range ids {
+					if id != 3 {
+						ps = append(ps, &dataflow.Product{ID: id, Title: "title"})
+					}
+				}
+				return ps, nil
+			},
+		})
+
+		if ps, err := s.FindProductsByIDs(context.Background(), []uint32{2, 1, 3}); err != nil {
+			t.Fatal(err)
+		} else if len(ps) != 2 || ps[0].ID != 2 || ps[1].ID != 1 {
+			t.Fatalf("unexpected products: %v", ps)
+		}
+
+		if ps, err := s.FindProductsByIDs(context.Background(), []uint32{1, 3, 4}); err != nil {
+			t.Fatal(err)
+		} else if len(ps) != 2 || ps[0].ID != 1 || ps[1].ID != 4 {
+			t.Fatalf("unexpected products: %v", ps)
+		}
+
+		if want := [][]uint32{{2, 1, 3}, {4}}; !reflect.DeepEqual(requested, want) {
+			t.Fatalf("requested=%v, want %v", requested, want)
+		}
+	})
+
+	// Ensure products are served from the underlying service, if redis fails.
+	t.Run("CacheDown", func(t *testing.T) {
+		db := MustOpenCache(t, redisConnectionString)
+		MustCloseCache(t, db)
+
+		s := redis.NewProductService(db, &mock.ProductService{
+			FindProductsByIDsFn: func(ctx context.Context, ids []uint32, fields ...string) ([]*dataflow.Product, error) {
+				return []*dataflow.Product{{ID: 1, Title: "title"}}, nil
+			},
+		})
+
+		if ps, err := s.FindProductsByIDs(context.Background(), []uint32{1, 2}); err != nil {
+			t.Fatal(err)
+		} else if len(ps) != 1 || ps[0].ID != 1 {
+			t.Fatalf("unexpected products: %v", ps)
+		}
+	})
+}
+
+func TestProductService_CreateProducts(t *testing.T) {
+	// Start containers for test.
+	ctx := context.Background()
+	rdbc, redisConnectionString := container.MustDeployRedis(ctx)
+	defer container.MustCleanRedisContainer(ctx, rdbc)
+
+	// Ensure a write invalidates the cached product.
+	t.Run("OK", func(t *testing.T) {
+		db := MustOpenCache(t, redisConnectionString)
+		defer MustCloseCache(t, db)
+
+		p := &dataflow.Product{ID: 1, Title: "title1", Price: 42.01, Category: "bilgisayar", Brand: "brand1"}
+		s := redis.NewProductService(db, &mock.ProductService{
+			FindProductByIDFn: func(ctx context.Context, id uint32, fields ...string) (*dataflow.Product, error) {
+				other := *p
+				return &other, nil
+			},
+			CreateProductsFn: func(ctx context.Context, ps []*dataflow.Product) error {
+				p = ps[0]
+				return nil
+			},
+		})
+
+		if _, err := s.FindProductByID(context.Background(), 1); err != nil {
+			t.Fatal(err)
+		}
+
+		changed := &dataflow.Product{ID: 1, Title: "title2", Price: 42.01, Category: "bilgisayar", Brand: "brand1"}
+		if err := s.CreateProducts(context.Background(), []*dataflow.Product{changed}); err != nil {
+			t.Fatal(err)
+		}
+
+		if other, err := s.FindProductByID(context.Background(), 1); err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(changed, other) {
+			t.Fatalf("mismatch: %#v != %#v", changed, other)
+		}
+	})
+
+	// Ensure a lookup, that read the product before a write, does not cache its old state.
+	t.Run("StaleFill", func(t *testing.T) {
+		db := MustOpenCache(t, redisConnectionString)
+		defer MustCloseCache(t, db)
+
+		p := &dataflow.Product{ID: 1, Title: "title1", Price: 42.01, Category: "bilgisayar", Brand: "brand1"}
+		changed := &dataflow.Product{ID: 1, Title: "title2", Price: 42.01, Category: "bilgisayar", Brand: "brand1"}
+
+		var s *redis.ProductService
+		s = redis.NewProductService(db, &mock.ProductService{
+			FindProductByIDFn: func(ctx context.Context, id uint32, fields ...string) (*dataflow.Product, error) {
+				// Write the product, after its old state has been read.
+				old := *p
+				if err := s.CreateProducts(ctx, []*dataflow.Product{changed}); err != nil {
+					t.Fatal(err)
+				}
+				return &old, nil
+			},
+			CreateProductsFn: func(ctx context.Context, ps []*dataflow.Product) error {
+				p = ps[0]
+				return nil
+			},
+		})
+
+		if _, err := s.FindProductByID(context.Background(), 1); err != nil {
+			t.Fatal(err)
+		} else if other, err := s.FindProductByID(context.Background(), 1); err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(changed, other) {
+			t.Fatalf("mismatch: %#v != %#v", changed, other)
+		}
+	})
+}
+
+func TestProductService_DeleteProduct(t *testing.T) {
+	// Start containers for test.
+	ctx := context.Background()
+	rdbc, redisConnectionString := container.MustDeployRedis(ctx)
+	defer container.MustCleanRedisContainer(ctx, rdbc)
+
+	// Ensure a delete removes the fingerprint of the product, so the job writes it again.
+	t.Run("Fingerprint", func(t *testing.T) {
+		db := MustOpenCache(t, redisConnectionString)
+		defer MustCloseCache(t, db)
+
+		p := &dataflow.Product{ID: 1, Title: "title1", Price: 42.01, Category: "bilgisayar", Brand: "brand1"}
+		fingerprints := redis.NewIDCacheService(db)
+		if err := fingerprints.Set(context.Background(), p.ID, p.Fingerprint()); err != nil {
+			t.Fatal(err)
+		}
+
+		s := redis.NewProductService(db, &mock.ProductService{
+			DeleteProductFn: func(ctx context.Context, id uint32) error { return nil },
+		})
+		s.Fingerprints = fingerprints
+
+		if err := s.DeleteProduct(context.Background(), 1); err != nil {
+			t.Fatal(err)
+		} else if fingerprint, err := fingerprints.Get(context.Background(), 1); err != nil {
+			t.Fatal(err)
+		} else if fingerprint != "" {
+			t.Fatalf("unexpected fingerprint: %q", fingerprint)
+		}
+	})
+}
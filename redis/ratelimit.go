@@ -0,0 +1,77 @@
+package redis
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/narslan/pipeline"
+	"github.com/redis/go-redis/v9"
+)
+
+// RateLimitPrefix is prepended to the key of each token bucket.
+const RateLimitPrefix = "ratelimit:"
+
+// Ensure service implements interface.
+var _ dataflow.RateLimiter = (*RateLimiter)(nil)
+
+// allowScript refills and takes a token from a bucket atomically. The bucket is a hash of
+// the tokens and the time of the last request in milliseconds. The time of the Redis server
+// is used, so that replicas with skewed clocks share the buckets. A bucket expires, once it
+// is full again.
+var allowScript = redis.NewScript(`
+local rate = tonumber(ARGV[1]) / 1000
+local burst = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local b = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(b[1]) or burst
+local ts = tonumber(b[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate)
+
+local allowed, retry = 0, 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	retry = math.ceil((1 - tokens) / rate)
+end
+local reset = math.ceil((burst - tokens) / rate)
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.max(reset, 1))
+return {allowed, math.floor(tokens), retry, reset}
+`)
+
+// RateLimiter represents token buckets in redis, which are shared between replicas.
+type RateLimiter struct {
+	cache *Cache
+}
+
+// NewRateLimiter returns a new instance of RateLimiter.
+func NewRateLimiter(cache *Cache) *RateLimiter {
+	return &RateLimiter{cache: cache}
+}
+
+// Allow takes a token from the bucket of key, if there is one.
+// A new bucket starts full.
+func (l *RateLimiter) Allow(ctx context.Context, key string, limit dataflow.RateLimit) (*dataflow.RateLimitResult, error) {
+	burst := max(limit.Burst, 1)
+	if limit.Rate <= 0 {
+		return &dataflow.RateLimitResult{Allowed: true, Remaining: burst}, nil
+	}
+
+	vals, err := allowScript.Run(ctx, l.cache, []string{RateLimitPrefix + key},
+		strconv.FormatFloat(limit.Rate, 'f', -1, 64), burst).Int64Slice()
+	if err != nil {
+		return nil, err
+	}
+
+	return &dataflow.RateLimitResult{
+		Allowed:    vals[0] == 1,
+		Remaining:  int(vals[1]),
+		RetryAfter: time.Duration(vals[2]) * time.Millisecond,
+		Reset:      time.Duration(vals[3]) * time.Millisecond,
+	}, nil
+}
@@ -0,0 +1,47 @@
+package redis_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/narslan/pipeline"
+	"github.com/narslan/pipeline/container"
+	"github.com/narslan/pipeline/redis"
+)
+
+func TestRateLimiter_Allow(t *testing.T) {
+	// Start containers for test.
+	ctx := context.Background()
+	rdbc, redisConnectionString := container.MustDeployRedis(ctx)
+	defer container.MustCleanRedisContainer(ctx, rdbc)
+
+	// Ensure a burst is allowed and limiters share the buckets.
+	t.Run("OK", func(t *testing.T) {
+		db := MustOpenCache(t, redisConnectionString)
+		defer MustCloseCache(t, db)
+
+		// Refill slowly, so that no token is added during the test.
+		limit := dataflow.RateLimit{Rate: 0.01, Burst: 2}
+		l1, l2 := redis.NewRateLimiter(db), redis.NewRateLimiter(db)
+
+		for i, l := range []*redis.RateLimiter{l1, l2} {
+			if res, err := l.Allow(context.Background(), "a", limit); err != nil {
+				t.Fatal(err)
+			} else if !res.Allowed || res.Remaining != 1-i {
+				t.Fatalf("request %d: unexpected result: %#v", i, res)
+			}
+		}
+
+		if res, err := l1.Allow(context.Background(), "a", limit); err != nil {
+			t.Fatal(err)
+		} else if res.Allowed || res.RetryAfter <= 0 || res.Reset <= 0 {
+			t.Fatalf("unexpected result: %#v", res)
+		}
+
+		if ttl, err := db.PTTL(context.Background(), redis.RateLimitPrefix+"a").Result(); err != nil {
+			t.Fatal(err)
+		} else if ttl <= 0 {
+			t.Fatalf("expected bucket to expire, got %v", ttl)
+		}
+	})
+}
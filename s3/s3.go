@@ -1,9 +1,13 @@
 package s3
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"io"
+	"log/slog"
+	"path"
+	"strings"
 
 	"github.com/narslan/pipeline"
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -11,13 +15,32 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 )
 
-// Ensure that S3FetchService implements dataflow.Fetch.
+// Ensure that S3FetchService implements the fetch interfaces.
 var _ dataflow.Fetch = (*S3FetchService)(nil)
+var _ dataflow.StreamFetch = (*S3FetchService)(nil)
+var _ dataflow.StatFetch = (*S3FetchService)(nil)
+var _ dataflow.RangeFetch = (*S3FetchService)(nil)
+var _ dataflow.ListFetch = (*S3FetchService)(nil)
+
+// Ensure that the AWS client implements Client.
+var _ Client = (*s3.Client)(nil)
+
+// Client represents the subset of the S3 API, that S3FetchService uses.
+// It is implemented by *s3.Client and can be replaced by a fake in tests.
+type Client interface {
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+}
 
 // S3FetchService represents a connection to the AWS S3 bucket.
+// Sources are either plain keys in Bucket or URLs like s3://bucket/key.
 type S3FetchService struct {
-	S3Client *s3.Client
+	S3Client Client
 	Bucket   string
+
+	// Logger of the downloads. Defaults to slog.Default().
+	Logger *slog.Logger
 }
 
 // NewS3FetchService initializes the S3FetchService struct.
@@ -35,23 +58,158 @@ func NewS3FetchService(bucket string) (*S3FetchService, error) {
 	return &S3FetchService{
 		S3Client: client,
 		Bucket:   bucket,
+		Logger:   slog.Default(),
 	}, err
 }
 
+// logger returns the logger of the downloads, or the default logger if it is not set.
+func (s *S3FetchService) logger() *slog.Logger {
+	return cmp.Or(s.Logger, slog.Default())
+}
+
 // Get method downloads the S3 object represented by key.
 func (s *S3FetchService) Get(ctx context.Context, key string) ([]byte, error) {
 
-	fmt.Printf("Downloading: %s \n", key)
+	body, err := s.Open(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	//Read the data out of object.
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	s.logger().DebugContext(ctx, "finished downloading", "source", key, "bytes", len(data))
+	return data, nil
+}
+
+// Open method returns the body of the S3 object represented by key as a stream.
+// The object is downloaded while the caller reads from it.
+func (s *S3FetchService) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+
+	s.logger().InfoContext(ctx, "downloading", "source", key)
+	bucket, k := s.location(key)
 	result, err := s.S3Client.GetObject(ctx, &s3.GetObjectInput{
-		Bucket: aws.String(s.Bucket),
-		Key:    aws.String(key),
+		Bucket: aws.String(bucket),
+		Key:    aws.String(k),
 	})
 	if err != nil {
 		return nil, err
 	}
-	defer result.Body.Close()
-	fmt.Printf("Finished downloading: %s \n", key)
-	//Read the data out of object.
-	return io.ReadAll(result.Body)
+	return &object{ReadCloser: result.Body, encoding: aws.ToString(result.ContentEncoding)}, nil
+}
+
+// OpenAt method returns the body of the S3 object represented by key,
+// starting at the given byte offset.
+func (s *S3FetchService) OpenAt(ctx context.Context, key string, offset int64) (io.ReadCloser, error) {
+
+	s.logger().InfoContext(ctx, "downloading", "source", key, "offset", offset)
+	bucket, k := s.location(key)
+	result, err := s.S3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(k),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-", offset)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &object{ReadCloser: result.Body, encoding: aws.ToString(result.ContentEncoding)}, nil
+}
 
+// object represents the body of an S3 object together with its Content-Encoding.
+type object struct {
+	io.ReadCloser
+	encoding string
+}
+
+// ContentEncoding implements dataflow.EncodedReader.
+func (o *object) ContentEncoding() string {
+	return o.encoding
+}
+
+// Stat method retrieves the ETag and the size of the S3 object represented by key.
+func (s *S3FetchService) Stat(ctx context.Context, key string) (*dataflow.ObjectInfo, error) {
+
+	bucket, k := s.location(key)
+	result, err := s.S3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(k),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &dataflow.ObjectInfo{
+		Key:  key,
+		ETag: aws.ToString(result.ETag),
+		Size: aws.ToInt64(result.ContentLength),
+	}, nil
+}
+
+// List method returns the keys, that match a glob pattern like "prefix/*.jsonl".
+// The syntax of the pattern is the one of path.Match, so '*' does not match '/'.
+// A pattern ending with '/' matches every key under the prefix.
+// The bucket is listed page by page, starting at the static prefix of the pattern.
+// If the pattern is an s3:// URL, the keys are returned as URLs too.
+func (s *S3FetchService) List(ctx context.Context, pattern string) ([]string, error) {
+
+	bucket, glob := s.location(pattern)
+
+	// Validate the pattern once, before listing.
+	if _, err := path.Match(glob, ""); err != nil {
+		return nil, dataflow.Errorf(dataflow.EINVALID, "invalid pattern %q: %v", pattern, err)
+	}
+
+	// Only the part before the first meta character narrows down the listing.
+	prefix := glob
+	if i := strings.IndexAny(glob, `*?[\`); i >= 0 {
+		prefix = glob[:i]
+	}
+
+	keys := make([]string, 0)
+	p := s3.NewListObjectsV2Paginator(s.S3Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	})
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, obj := range page.Contents {
+			key := aws.ToString(obj.Key)
+			if !match(glob, key) {
+				continue
+			}
+
+			if strings.HasPrefix(pattern, "s3://") {
+				key = "s3://" + bucket + "/" + key
+			}
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// match reports whether key matches the glob pattern.
+func match(glob, key string) bool {
+	if glob == "" || strings.HasSuffix(glob, "/") {
+		return strings.HasPrefix(key, glob)
+	}
+	ok, _ := path.Match(glob, key)
+	return ok
+}
+
+// location splits a source into a bucket and a key.
+// A source is either a plain key in the default bucket or an URL like s3://bucket/key.
+func (s *S3FetchService) location(source string) (bucket, key string) {
+	rest, ok := strings.CutPrefix(source, "s3://")
+	if !ok {
+		return s.Bucket, source
+	}
+	bucket, key, _ = strings.Cut(rest, "/")
+	return bucket, key
 }
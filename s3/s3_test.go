@@ -4,11 +4,19 @@ import (
 	"context"
 	"errors"
 	"flag"
+	"io"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"testing"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awss3 "github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	dataflow "github.com/narslan/pipeline"
 	"github.com/narslan/pipeline/s3"
 )
 
@@ -116,3 +124,134 @@ func fileExists(filename string) bool {
 	}
 	return !info.IsDir()
 }
+
+// Client represents an in-memory fake of the S3 API.
+// It returns at most PageSize keys per listing page.
+type Client struct {
+	Objects  map[string]string
+	PageSize int
+	Pages    int
+}
+
+// GetObject returns the content of an object.
+func (c *Client) GetObject(ctx context.Context, params *awss3.GetObjectInput, optFns ...func(*awss3.Options)) (*awss3.GetObjectOutput, error) {
+	body, ok := c.Objects[aws.ToString(params.Key)]
+	if !ok {
+		return nil, &types.NoSuchKey{}
+	}
+	return &awss3.GetObjectOutput{Body: io.NopCloser(strings.NewReader(body))}, nil
+}
+
+// HeadObject returns the size of an object.
+func (c *Client) HeadObject(ctx context.Context, params *awss3.HeadObjectInput, optFns ...func(*awss3.Options)) (*awss3.HeadObjectOutput, error) {
+	body, ok := c.Objects[aws.ToString(params.Key)]
+	if !ok {
+		return nil, &types.NotFound{}
+	}
+	return &awss3.HeadObjectOutput{ContentLength: aws.Int64(int64(len(body)))}, nil
+}
+
+// ListObjectsV2 returns a page of keys in lexicographic order.
+func (c *Client) ListObjectsV2(ctx context.Context, params *awss3.ListObjectsV2Input, optFns ...func(*awss3.Options)) (*awss3.ListObjectsV2Output, error) {
+	c.Pages++
+
+	keys := make([]string, 0)
+	for k := range c.Objects {
+		if strings.HasPrefix(k, aws.ToString(params.Prefix)) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	// The continuation token is the index of the first key of the page.
+	start, _ := strconv.Atoi(aws.ToString(params.ContinuationToken))
+	end := min(start+c.PageSize, len(keys))
+
+	out := &awss3.ListObjectsV2Output{}
+	for _, k := range keys[start:end] {
+		out.Contents = append(out.Contents, types.Object{Key: aws.String(k)})
+	}
+	if end < len(keys) {
+		out.IsTruncated = aws.Bool(true)
+		out.NextContinuationToken = aws.String(strconv.Itoa(end))
+	}
+	return out, nil
+}
+
+func TestS3FetchService_List(t *testing.T) {
+	client := &Client{
+		PageSize: 2,
+		Objects: map[string]string{
+			"daily/2024-01-01/products-1.jsonl": "",
+			"daily/2024-01-01/products-2.jsonl": "",
+			"daily/2024-01-01/readme.txt":       "",
+			"daily/2024-01-02/products-1.jsonl": "",
+			"daily/2024-01-02/nested/a.jsonl":   "",
+			"products-1.jsonl":                  "",
+		},
+	}
+	s := &s3.S3FetchService{S3Client: client, Bucket: "casestudy"}
+
+	testCases := []struct {
+		name    string
+		pattern string
+		want    []string
+	}{
+		{
+			name:    "Glob",
+			pattern: "daily/2024-01-01/*.jsonl",
+			want:    []string{"daily/2024-01-01/products-1.jsonl", "daily/2024-01-01/products-2.jsonl"},
+		},
+		{
+			name:    "GlobAcrossPrefixes",
+			pattern: "daily/*/products-1.jsonl",
+			want:    []string{"daily/2024-01-01/products-1.jsonl", "daily/2024-01-02/products-1.jsonl"},
+		},
+		{
+			name:    "Prefix",
+			pattern: "daily/2024-01-02/",
+			want:    []string{"daily/2024-01-02/nested/a.jsonl", "daily/2024-01-02/products-1.jsonl"},
+		},
+		{
+			name:    "URL",
+			pattern: "s3://casestudy/products-*.jsonl",
+			want:    []string{"s3://casestudy/products-1.jsonl"},
+		},
+		{
+			name:    "NoMatch",
+			pattern: "weekly/*.jsonl",
+			want:    []string{},
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.name, func(t *testing.T) {
+			got, err := s.List(context.Background(), tC.pattern)
+			if err != nil {
+				t.Fatal(err)
+			} else if !reflect.DeepEqual(got, tC.want) {
+				t.Fatalf("mismatch: %#v != %#v", got, tC.want)
+			}
+		})
+	}
+
+	// Ensure all pages are requested.
+	t.Run("Pagination", func(t *testing.T) {
+		client.Pages = 0
+		got, err := s.List(context.Background(), "daily/")
+		if err != nil {
+			t.Fatal(err)
+		} else if len(got) != 5 {
+			t.Fatalf("expected 5 keys, got %d", len(got))
+		} else if client.Pages != 3 {
+			t.Fatalf("expected 3 pages, got %d", client.Pages)
+		}
+	})
+
+	// Ensure an error is returned for a malformed pattern.
+	t.Run("ErrInvalidPattern", func(t *testing.T) {
+		if _, err := s.List(context.Background(), "daily/[a"); dataflow.ErrorCode(err) != dataflow.EINVALID {
+			t.Fatalf("unexpected error: %#v", err)
+		}
+	})
+}
@@ -0,0 +1,13 @@
+#!/bin/bash
+set -e
+
+#fill the lookup tables of products by category and brand from the products table.
+#products written before the lookup tables existed have no lookup rows, and the job skips them as long as they are unchanged.
+#run it once, while the job is not running, after scripts/migrate_product_version.sh. Rows are upserted, so it can be run again.
+docker exec -it cassandra-service  cqlsh -e  "copy case_study_devel.products (category, id, title, price, brand, url, description, version, updated_at) to '/tmp/products_by_category.csv';"
+docker exec -it cassandra-service  cqlsh -e  "copy case_study_devel.products_by_category (category, id, title, price, brand, url, description, version, updated_at) from '/tmp/products_by_category.csv';"
+
+docker exec -it cassandra-service  cqlsh -e  "copy case_study_devel.products (brand, id, title, price, category, url, description, version, updated_at) to '/tmp/products_by_brand.csv';"
+docker exec -it cassandra-service  cqlsh -e  "copy case_study_devel.products_by_brand (brand, id, title, price, category, url, description, version, updated_at) from '/tmp/products_by_brand.csv';"
+
+docker exec cassandra-service  rm /tmp/products_by_category.csv /tmp/products_by_brand.csv
@@ -0,0 +1,8 @@
+#!/bin/bash
+set -e
+
+#add the version and update time of products to a keyspace provisioned before they were tracked.
+#existing products have no version until they are written again.
+for table in products products_by_category products_by_brand; do
+    docker exec -it cassandra-service  cqlsh -e  "alter table case_study_devel.$table add (version timeuuid, updated_at timestamp);"
+done
@@ -13,7 +13,32 @@ docker exec -it cassandra-service  cqlsh -e  "create table case_study_devel.prod
                                  brand text, 
                                  url text, 
                                  description text,  
+                                 version timeuuid,
+                                 updated_at timestamp,
                                  PRIMARY KEY(id));"
 
+#create lookup tables of products by category and brand. ProductService keeps them in sync with products.
+docker exec -it cassandra-service  cqlsh -e  "create table case_study_devel.products_by_category(category text,
+                                id int,
+                                title text,
+                                price float,
+                                brand text,
+                                url text,
+                                description text,
+                                version timeuuid,
+                                updated_at timestamp,
+                                PRIMARY KEY((category), id));"
+
+docker exec -it cassandra-service  cqlsh -e  "create table case_study_devel.products_by_brand(brand text,
+                                id int,
+                                title text,
+                                price float,
+                                category text,
+                                url text,
+                                description text,
+                                version timeuuid,
+                                updated_at timestamp,
+                                PRIMARY KEY((brand), id));"
+
 #If you're done with testing, you can release the resources with:
 # docker-compose down --remove-orphans
@@ -0,0 +1,29 @@
+package dataflow
+
+import "context"
+
+// SearchService represents a service for full-text search of products.
+// Products are searched by their title, description and brand.
+type SearchService interface {
+	// Adds a number of products to the index. Indexed products with the same IDs are replaced.
+	IndexProducts(ctx context.Context, ps []*Product) error
+
+	// Removes a number of products from the index. Missing IDs are ignored.
+	RemoveProducts(ctx context.Context, ids []uint32) error
+
+	// Retrieves a page of products matching the query, ranked by relevance.
+	// Also returns the total number of matching products.
+	// Returns EINVALID if the query has no terms.
+	SearchProducts(ctx context.Context, filter SearchFilter) ([]*Product, int, error)
+}
+
+// SearchFilter represents a filter passed to SearchProducts.
+type SearchFilter struct {
+	// Free text query. Products matching any of its terms are returned.
+	Query string `json:"q"`
+
+	// Restrict to a subset of the ranked results.
+	// The service picks a default limit if it is not set.
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
+}
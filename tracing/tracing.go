@@ -0,0 +1,125 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// Exporters of spans.
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+)
+
+// Provider represents the tracer provider, that exports the OpenTelemetry spans of the process.
+// Packages trace their operations with the global tracer provider, which records nothing
+// until a Provider is opened. Once opened, it is installed as the global tracer provider,
+// and the W3C trace context is propagated.
+type Provider struct {
+	tp   *sdktrace.TracerProvider
+	file *os.File
+
+	// Name of the service, that spans are recorded for.
+	ServiceName string
+
+	// Exporter of spans: "otlp", "stdout" or "none". Empty is the same as "none".
+	Exporter string
+
+	// Address of the OTLP/HTTP collector, like "localhost:4318". Empty uses the
+	// OTEL_EXPORTER_OTLP_ENDPOINT environment variable or the default of the exporter.
+	Endpoint string
+
+	// Insecure sends spans to the collector without TLS.
+	Insecure bool
+
+	// Path of the file, that the stdout exporter appends spans to. Empty writes to stdout.
+	Path string
+
+	// Ratio of traces sampled, unless the parent span of a request is sampled.
+	// Zero samples all traces.
+	SampleRatio float64
+}
+
+// NewProvider returns a new instance of Provider for a service.
+func NewProvider(serviceName string) *Provider {
+	return &Provider{ServiceName: serviceName}
+}
+
+// Open creates the exporter and installs the provider. It does nothing,
+// if no exporter is configured.
+func (p *Provider) Open(ctx context.Context) error {
+	var exp sdktrace.SpanExporter
+	switch p.Exporter {
+	case "", ExporterNone:
+		return nil
+
+	case ExporterOTLP:
+		var opts []otlptracehttp.Option
+		if p.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(p.Endpoint))
+		}
+		if p.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		var err error
+		if exp, err = otlptracehttp.New(ctx, opts...); err != nil {
+			return err
+		}
+
+	case ExporterStdout:
+		var w io.Writer = os.Stdout
+		if p.Path != "" {
+			f, err := os.OpenFile(p.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+			if err != nil {
+				return err
+			}
+			p.file, w = f, f
+		}
+		var err error
+		if exp, err = stdouttrace.New(stdouttrace.WithWriter(w)); err != nil {
+			return err
+		}
+
+	default:
+		return fmt.Errorf("unknown tracing exporter: %s", p.Exporter)
+	}
+
+	sampler := sdktrace.AlwaysSample()
+	if p.SampleRatio > 0 && p.SampleRatio < 1 {
+		sampler = sdktrace.TraceIDRatioBased(p.SampleRatio)
+	}
+
+	p.tp = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithSampler(sdktrace.ParentBased(sampler)),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(p.ServiceName))),
+	)
+	otel.SetTracerProvider(p.tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return nil
+}
+
+// Close exports the pending spans and shuts down the provider.
+func (p *Provider) Close(ctx context.Context) error {
+	if p.tp == nil {
+		return nil
+	}
+	err := p.tp.Shutdown(ctx)
+	if p.file != nil {
+		if cerr := p.file.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,58 @@
+package tracing_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/narslan/pipeline/tracing"
+	"go.opentelemetry.io/otel"
+)
+
+func TestProvider(t *testing.T) {
+	// Ensure spans are written to the file of the stdout exporter, once the provider is closed.
+	t.Run("Stdout", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "spans.jsonl")
+		tp := tracing.NewProvider("dataflow-test")
+		tp.Exporter, tp.Path = tracing.ExporterStdout, path
+		if err := tp.Open(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		_, span := otel.Tracer("test").Start(context.Background(), "Test.Span")
+		span.End()
+		if err := tp.Close(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		buf, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		} else if !strings.Contains(string(buf), `"Name":"Test.Span"`) {
+			t.Fatalf("span not exported: %s", buf)
+		} else if !strings.Contains(string(buf), "dataflow-test") {
+			t.Fatalf("service name not exported: %s", buf)
+		}
+	})
+
+	// Ensure no exporter is created, if tracing is disabled.
+	t.Run("None", func(t *testing.T) {
+		tp := tracing.NewProvider("dataflow-test")
+		if err := tp.Open(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if err := tp.Close(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	// Ensure an unknown exporter is rejected.
+	t.Run("ErrUnknownExporter", func(t *testing.T) {
+		tp := tracing.NewProvider("dataflow-test")
+		tp.Exporter = "zipkin"
+		if err := tp.Open(context.Background()); err == nil || err.Error() != "unknown tracing exporter: zipkin" {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}